@@ -0,0 +1,445 @@
+package submit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/slack"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	slackLinkCollection     = "slack_links"
+	slackLinkUserCollection = "slack_link_users"
+
+	slackLinkSync  = "sync"
+	slackLinkOAuth = "oauth"
+
+	slackOAuthStateExpiry = 10 * time.Minute
+
+	jobSlackSync  = "slack.sync"
+	jobTeamNotify = "team.notify"
+	jobSlackDM    = "slack.dm"
+)
+
+var (
+	slackLinksLock sync.Mutex
+
+	errSlackUnlinked = fmt.Errorf("Slack account unlinked, connect it again from the settings page")
+)
+
+// SlackLink maps a roster ID to a Slack user. Links made by a student through
+// OAuth, and unlinks, take precedence over the email matching of the sync.
+type SlackLink struct {
+	StudentID string
+	SlackID   string
+	SlackName string
+	Source    string
+	Unlinked  bool
+	LinkedAt  time.Time
+}
+
+func slackLinkFind(studentID string) *SlackLink {
+	link := &SlackLink{}
+	if found, _ := store.Get(slackLinkCollection, studentID, link); !found {
+		return &SlackLink{StudentID: studentID}
+	}
+
+	return link
+}
+
+// slackLinkBySlackID returns the link of a Slack user, or nil.
+func slackLinkBySlackID(slackID string) *SlackLink {
+	var studentID string
+	if found, _ := store.Get(slackLinkUserCollection, slackID, &studentID); !found {
+		return nil
+	}
+
+	link := slackLinkFind(studentID)
+	if link.SlackID != slackID {
+		return nil
+	}
+
+	return link
+}
+
+// slackLinkSet links a student to a Slack user, taking the Slack user off any
+// other student. Syncs leave OAuth links and unlinks alone.
+func slackLinkSet(studentID, slackID, slackName, source string) error {
+	slackLinksLock.Lock()
+	defer slackLinksLock.Unlock()
+
+	link := slackLinkFind(studentID)
+	if source == slackLinkSync && (link.Source == slackLinkOAuth || link.Unlinked) {
+		return nil
+	}
+	if link.SlackID == slackID && link.Source == source && (slackName == "" || link.SlackName == slackName) {
+		return nil
+	}
+
+	if other := slackLinkBySlackID(slackID); other != nil && other.StudentID != studentID {
+		if source == slackLinkSync && other.Source == slackLinkOAuth {
+			return nil
+		}
+		err := store.Update(slackLinkCollection, other.StudentID, other, func(found bool) error {
+			other.SlackID = ""
+			other.SlackName = ""
+			other.Source = ""
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if link.SlackID != "" && link.SlackID != slackID {
+		if err := store.Delete(slackLinkUserCollection, link.SlackID); err != nil {
+			return err
+		}
+	}
+
+	err := store.Update(slackLinkCollection, studentID, link, func(found bool) error {
+		link.StudentID = studentID
+		link.SlackID = slackID
+		link.SlackName = slackName
+		link.Source = source
+		link.Unlinked = false
+		link.LinkedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.Put(slackLinkUserCollection, slackID, studentID)
+}
+
+// slackUnlink removes the link of a student and keeps the sync from linking
+// them again, until they connect through OAuth.
+func slackUnlink(studentID string) error {
+	slackLinksLock.Lock()
+	defer slackLinksLock.Unlock()
+
+	link := slackLinkFind(studentID)
+	if link.SlackID != "" {
+		if err := store.Delete(slackLinkUserCollection, link.SlackID); err != nil {
+			return err
+		}
+	}
+
+	return store.Update(slackLinkCollection, studentID, link, func(found bool) error {
+		link.StudentID = studentID
+		link.SlackID = ""
+		link.SlackName = ""
+		link.Source = ""
+		link.Unlinked = true
+		return nil
+	})
+}
+
+// slackIDFor returns the Slack user of a student, looking them up by email
+// and linking them when they have no link yet.
+func slackIDFor(studentID, email string) (string, error) {
+	link := slackLinkFind(studentID)
+	if link.SlackID != "" {
+		return link.SlackID, nil
+	}
+	if link.Unlinked {
+		return "", errSlackUnlinked
+	}
+
+	slackID, err := slack.UsersLookupByEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	if studentID != "" {
+		slackLinkSet(studentID, slackID, "", slackLinkSync)
+	}
+
+	return slackID, nil
+}
+
+// notifyTeam DMs every member of a team in the background.
+func notifyTeam(teamName, text string) {
+	jobs.Enqueue(jobTeamNotify, map[string]string{"Team": teamName, "Text": text})
+}
+
+// jobTeamNotifyHandler enqueues one DM per member, so a failed DM is retried
+// without sending the others again.
+func jobTeamNotifyHandler(args map[string]string) error {
+	members, err := google.SheetsTeamMembers(args["Team"])
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		_, err := jobs.Enqueue(jobSlackDM, map[string]string{
+			"ID":       member["ID"],
+			"UserName": member["UserName"],
+			"Text":     args["Text"],
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func jobSlackDMHandler(args map[string]string) error {
+	user := &User{UserName: args["UserName"]}
+	slackID, err := slackIDFor(args["ID"], user.Email())
+	if err == errSlackUnlinked {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return slack.ChatPostMessage(slackID, args["Text"])
+}
+
+// studentForSlackUser finds the student behind a Slack user through their
+// link, falling back to their email and linking them on the way. Students
+// who unlinked their account aren't found by email.
+func studentForSlackUser(slackID string) (map[string]string, error) {
+	if link := slackLinkBySlackID(slackID); link != nil {
+		return google.SheetsUserInfoBy("ID", link.StudentID)
+	}
+
+	info, err := slack.UsersInfo(slackID)
+	if err != nil {
+		return nil, err
+	}
+
+	student, err := google.SheetsUserInfoBy("Email", info[1])
+	if err != nil {
+		return nil, err
+	}
+	if slackLinkFind(student["ID"]).Unlinked {
+		return nil, errSlackUnlinked
+	}
+	slackLinkSet(student["ID"], slackID, info[0], slackLinkSync)
+
+	return student, nil
+}
+
+// startSlackSync enqueues a sync right away and then every SlackSyncInterval.
+func startSlackSync() {
+	interval, err := time.ParseDuration(config.SlackSyncInterval)
+	if err != nil || interval <= 0 || config.SlackBotToken == "" {
+		return
+	}
+
+	jobs.Enqueue(jobSlackSync, map[string]string{})
+	go func() {
+		for range time.NewTicker(interval).C {
+			jobs.Enqueue(jobSlackSync, map[string]string{})
+		}
+	}()
+}
+
+// jobSlackSyncHandler links the students on the roster to the workspace
+// members with the same email.
+func jobSlackSyncHandler(args map[string]string) error {
+	students, err := google.SheetsStudents()
+	if err != nil {
+		return err
+	}
+
+	ids := map[string]string{}
+	for _, student := range students {
+		ids[strings.ToLower(student["Email"])] = student["ID"]
+	}
+
+	members := [][]string{}
+	err = slack.UsersList(func(member []string) {
+		members = append(members, member)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		studentID, ok := ids[strings.ToLower(member[1])]
+		if !ok {
+			continue
+		}
+
+		if err := slackLinkSet(studentID, member[4], member[0], slackLinkSync); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// settingsData returns what the settings page shows for the current user.
+func settingsData(r *http.Request) map[string]interface{} {
+	user := CurrentUser(r)
+	link := slackLinkFind(user.ID)
+
+	return map[string]interface{}{
+		"SlackID":      link.SlackID,
+		"SlackName":    link.SlackName,
+		"SlackConnect": config.SlackClientID != "",
+		"Reminders":    reminderSettingsFind(user.UserName),
+	}
+}
+
+// slackOAuthStateNew makes a random state for the session, replacing any
+// earlier one.
+func slackOAuthStateNew(r *http.Request) (string, error) {
+	session := currentSession(r)
+	if session == nil {
+		return "", fmt.Errorf("No session")
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	session.slackState = state
+	session.slackStateExpires = time.Now().Add(slackOAuthStateExpiry)
+
+	return state, nil
+}
+
+// slackOAuthStateCheck consumes the session's state, so each one is only
+// accepted once and only before it expires.
+func slackOAuthStateCheck(r *http.Request, state string) bool {
+	session := currentSession(r)
+	if session == nil {
+		return false
+	}
+
+	sessionsLock.Lock()
+	want, expires := session.slackState, session.slackStateExpires
+	session.slackState, session.slackStateExpires = "", time.Time{}
+	sessionsLock.Unlock()
+
+	return want != "" && time.Now().Before(expires) && hmac.Equal([]byte(state), []byte(want))
+}
+
+func slackOAuthRedirectURI(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   r.Host,
+		Path:   "/settings/slack/callback",
+	}
+
+	return u.String()
+}
+
+func settingsSlackConnect() (string, http.HandlerFunc) {
+	return "/settings/slack/connect", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("settings") || config.SlackClientID == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		state, err := slackOAuthStateNew(r)
+		if err != nil {
+			data := settingsData(r)
+			data["Flash"] = fmt.Sprintf("Could not connect Slack: %v", err)
+			Render(w, r, "settings", data)
+			return
+		}
+
+		http.Redirect(w, r, slack.OAuthAuthorizeURL(slackOAuthRedirectURI(r), state), http.StatusFound)
+	}
+}
+
+func settingsSlackCallback() (string, http.HandlerFunc) {
+	return "/settings/slack/callback", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("settings") || config.SlackClientID == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		user := CurrentUser(r)
+
+		var err error
+		if !slackOAuthStateCheck(r, r.FormValue("state")) {
+			err = fmt.Errorf("Invalid state, please try again")
+		} else if e := r.FormValue("error"); e != "" {
+			err = fmt.Errorf("Slack said: %s", e)
+		} else {
+			var slackID string
+			if slackID, err = slack.OAuthAccess(r.FormValue("code"), slackOAuthRedirectURI(r)); err == nil {
+				slackName := ""
+				if info, err := slack.UsersInfo(slackID); err == nil {
+					slackName = info[0]
+				}
+				err = slackLinkSet(user.ID, slackID, slackName, slackLinkOAuth)
+			}
+		}
+
+		data := settingsData(r)
+		if err != nil {
+			data["Flash"] = fmt.Sprintf("Could not connect Slack: %v", err)
+		} else {
+			data["Success"] = "Your Slack account is connected."
+		}
+
+		Render(w, r, "settings", data)
+	}
+}
+
+func settingsSlackUnlink() (string, http.HandlerFunc) {
+	return "/settings/slack/unlink", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("settings") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/settings", http.StatusFound)
+			return
+		}
+
+		err := slackUnlink(CurrentUser(r).ID)
+
+		data := settingsData(r)
+		if err != nil {
+			data["Flash"] = err.Error()
+		} else {
+			data["Success"] = "Your Slack account was unlinked."
+		}
+
+		Render(w, r, "settings", data)
+	}
+}
@@ -0,0 +1,113 @@
+package submit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/lib/store"
+)
+
+func openStore(t *testing.T) {
+	if err := store.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loggedInRequest returns a request carrying the cookie of a new session.
+func loggedInRequest(t *testing.T, user *User) *http.Request {
+	w := httptest.NewRecorder()
+	persistUser(w, user)
+
+	r := httptest.NewRequest(http.MethodGet, "/settings/slack/callback", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	t.Cleanup(func() { unpersistUser(httptest.NewRecorder(), r) })
+
+	return r
+}
+
+func TestSlackOAuthState(t *testing.T) {
+	r := loggedInRequest(t, &User{UserName: "student"})
+	other := loggedInRequest(t, &User{UserName: "student"})
+
+	state, err := slackOAuthStateNew(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := slackOAuthStateNew(other); again == state {
+		t.Fatal("two sessions got the same state")
+	}
+
+	if slackOAuthStateCheck(other, state) {
+		t.Error("the state was accepted by another session")
+	}
+	if slackOAuthStateCheck(r, "x"+state) {
+		t.Error("a wrong state was accepted")
+	}
+	if slackOAuthStateCheck(r, state) {
+		t.Error("the state was accepted after a failed check")
+	}
+
+	state, _ = slackOAuthStateNew(r)
+	if !slackOAuthStateCheck(r, state) {
+		t.Error("a fresh state was rejected")
+	}
+	if slackOAuthStateCheck(r, state) {
+		t.Error("the state was accepted twice")
+	}
+
+	state, _ = slackOAuthStateNew(r)
+	session := currentSession(r)
+	sessionsLock.Lock()
+	session.slackStateExpires = time.Now().Add(-time.Second)
+	sessionsLock.Unlock()
+	if slackOAuthStateCheck(r, state) {
+		t.Error("an expired state was accepted")
+	}
+}
+
+func TestSlackUnlink(t *testing.T) {
+	openStore(t)
+
+	if err := slackLinkSet("37-1234", "U1", "student", slackLinkSync); err != nil {
+		t.Fatal(err)
+	}
+	if slackID, err := slackIDFor("37-1234", "student@example.com"); err != nil || slackID != "U1" {
+		t.Fatalf("slackIDFor = %q, %v", slackID, err)
+	}
+	if link := slackLinkBySlackID("U1"); link == nil || link.StudentID != "37-1234" {
+		t.Fatalf("slackLinkBySlackID = %+v", link)
+	}
+
+	if err := slackUnlink("37-1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := slackIDFor("37-1234", "student@example.com"); err != errSlackUnlinked {
+		t.Errorf("slackIDFor after unlinking = %v, want errSlackUnlinked", err)
+	}
+	if link := slackLinkBySlackID("U1"); link != nil {
+		t.Errorf("slackLinkBySlackID after unlinking = %+v", link)
+	}
+
+	// The sync doesn't link them again, and DMs to them are dropped rather
+	// than retried.
+	slackLinkSet("37-1234", "U1", "student", slackLinkSync)
+	if link := slackLinkFind("37-1234"); link.SlackID != "" || !link.Unlinked {
+		t.Errorf("sync relinked an unlinked student: %+v", link)
+	}
+	if err := jobSlackDMHandler(map[string]string{"ID": "37-1234", "UserName": "student", "Text": "hi"}); err != nil {
+		t.Errorf("DM to an unlinked student = %v, want nil", err)
+	}
+
+	// Connecting through OAuth links them again.
+	if err := slackLinkSet("37-1234", "U1", "student", slackLinkOAuth); err != nil {
+		t.Fatal(err)
+	}
+	if slackID, err := slackIDFor("37-1234", ""); err != nil || slackID != "U1" {
+		t.Errorf("slackIDFor after connecting = %q, %v", slackID, err)
+	}
+}
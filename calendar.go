@@ -0,0 +1,151 @@
+package submit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/ical"
+	"github.com/ramin0/submit/lib/scheduler"
+)
+
+const (
+	calendarFeedTeam      = "team"
+	calendarFeedEvaluator = "evaluator"
+)
+
+// calendarFeed serves the tokenized .ics subscriptions, which calendar apps
+// fetch without a session: /calendar/team.ics and /calendar/evaluator.ics.
+func calendarFeed() (string, http.HandlerFunc) {
+	return "/calendar/", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") || config.EvaluationsFeedSecret == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		kind := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+		name := r.URL.Query().Get("name")
+		token := r.URL.Query().Get("token")
+		if (kind != calendarFeedTeam && kind != calendarFeedEvaluator) || name == "" ||
+			!hmac.Equal([]byte(token), []byte(calendarToken(kind, name))) {
+			http.NotFound(w, r)
+			return
+		}
+
+		slots, err := scheduler.Get().Slots()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		cal := &ical.Calendar{Name: fmt.Sprintf("%s Evaluations: %s", config.SubmitName, name)}
+		for _, slot := range slots {
+			if (kind == calendarFeedTeam && slot.Has(name)) ||
+				(kind == calendarFeedEvaluator && slot.HasEvaluator(name) && len(slot.Teams) > 0) {
+				cal.Events = append(cal.Events, calendarEvent(slot))
+			}
+		}
+
+		writeCalendar(w, cal, "")
+	}
+}
+
+func evaluationInvite() (string, http.HandlerFunc) {
+	return "/evaluation/invite.ics", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		slot, err := scheduler.Get().TeamSlot(CurrentUser(r).TeamName())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if slot == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		writeCalendar(w, &ical.Calendar{
+			Method: "PUBLISH",
+			Events: []*ical.Event{calendarEvent(slot)},
+		}, "evaluation.ics")
+	}
+}
+
+func calendarEvent(slot *scheduler.Slot) *ical.Event {
+	hasher := sha256.New()
+	hasher.Write([]byte(slot.ID))
+
+	event := &ical.Event{
+		UID:      hex.EncodeToString(hasher.Sum(nil))[:32] + "@submit",
+		Start:    slot.Start,
+		End:      slot.End,
+		Summary:  fmt.Sprintf("%s Evaluation: %s", config.SubmitName, strings.Join(slot.Teams, ", ")),
+		Location: slot.Location,
+	}
+	if event.Location == "" {
+		event.Location = slot.VideoURL
+	}
+
+	description := []string{}
+	if len(slot.Evaluators) > 0 {
+		description = append(description, "Evaluators: "+strings.Join(slot.Evaluators, ", "))
+	}
+	if slot.VideoURL != "" {
+		description = append(description, "Video: "+slot.VideoURL)
+	}
+	event.Description = strings.Join(description, "\n")
+
+	return event
+}
+
+func writeCalendar(w http.ResponseWriter, cal *ical.Calendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	fmt.Fprint(w, cal.String())
+}
+
+func calendarToken(kind, name string) string {
+	mac := hmac.New(sha256.New, []byte(config.EvaluationsFeedSecret))
+	mac.Write([]byte(kind + ":" + name))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// calendarFeedURL returns the subscription URL of a feed, or "" if feeds are
+// not configured.
+func calendarFeedURL(r *http.Request, kind, name string) string {
+	if config.EvaluationsFeedSecret == "" || name == "" {
+		return ""
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   r.Host,
+		Path:   fmt.Sprintf("/calendar/%s.ics", kind),
+		RawQuery: url.Values{
+			"name":  {name},
+			"token": {calendarToken(kind, name)},
+		}.Encode(),
+	}
+
+	return u.String()
+}
@@ -0,0 +1,325 @@
+package submit
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	checkInCollection = "checkins"
+
+	checkInScheduled  = "scheduled"
+	checkInCheckedIn  = "checked-in"
+	checkInInProgress = "in-progress"
+	checkInDone       = "done"
+	checkInNoShow     = "no-show"
+)
+
+var (
+	checkInStatuses = []string{checkInScheduled, checkInCheckedIn, checkInInProgress, checkInDone, checkInNoShow}
+
+	checkInSubscribersLock sync.Mutex
+	checkInSubscribers     = map[chan *CheckIn]bool{}
+)
+
+// CheckIn struct
+type CheckIn struct {
+	Key       string
+	SlotID    string
+	Team      string
+	Status    string
+	UpdatedAt time.Time
+	UpdatedBy string
+}
+
+// CheckInRow struct
+type CheckInRow struct {
+	Slot    *Slot
+	Start   time.Time
+	CheckIn *CheckIn
+}
+
+func slotTeamKey(slotID, team string) string {
+	hasher := md5.New()
+	hasher.Write([]byte(slotID + "|" + team))
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func checkInFind(slotID, team string) *CheckIn {
+	checkIn := &CheckIn{}
+	if found, _ := store.Get(checkInCollection, slotTeamKey(slotID, team), checkIn); !found {
+		return &CheckIn{
+			Key:    slotTeamKey(slotID, team),
+			SlotID: slotID,
+			Team:   team,
+			Status: checkInScheduled,
+		}
+	}
+
+	return checkIn
+}
+
+func checkInSet(slotID, team, status, by string) error {
+	valid := false
+	for _, s := range checkInStatuses {
+		valid = valid || s == status
+	}
+	if !valid {
+		return fmt.Errorf("Invalid status: %s", status)
+	}
+
+	checkIn := &CheckIn{}
+	err := store.Update(checkInCollection, slotTeamKey(slotID, team), checkIn, func(found bool) error {
+		checkIn.Key = slotTeamKey(slotID, team)
+		checkIn.SlotID = slotID
+		checkIn.Team = team
+		checkIn.Status = status
+		checkIn.UpdatedAt = time.Now()
+		checkIn.UpdatedBy = by
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	checkInPublish(checkIn)
+	return nil
+}
+
+// checkInTeam lets a team mark itself present, from EvaluationsCheckInWindow
+// before its slot starts until the slot ends.
+func checkInTeam(user *User) error {
+	slot, err := scheduler.Get().TeamSlot(user.TeamName())
+	if err != nil {
+		return err
+	}
+	if slot == nil {
+		return fmt.Errorf("Your team has no slot to check in to")
+	}
+
+	window, _ := time.ParseDuration(config.EvaluationsCheckInWindow)
+	now := time.Now()
+	if now.After(slot.End) {
+		return fmt.Errorf("Your slot has ended")
+	}
+	if now.Before(slot.Start.Add(-window)) {
+		return fmt.Errorf("Check-in opens %v before your slot starts", window)
+	}
+
+	if checkInFind(slot.ID, user.TeamName()).Status != checkInScheduled {
+		return nil
+	}
+
+	return checkInSet(slot.ID, user.TeamName(), checkInCheckedIn, user.UserName)
+}
+
+// checkInRows lists every booking of the day, one row per team.
+func checkInRows(day time.Time) ([]*CheckInRow, error) {
+	slots, err := scheduler.Get().Slots()
+	if err != nil {
+		return nil, err
+	}
+
+	dayEnd := day.AddDate(0, 0, 1)
+	rows := []*CheckInRow{}
+	for _, slot := range slots {
+		if slot.Start.Before(day) || !slot.Start.Before(dayEnd) {
+			continue
+		}
+
+		for _, team := range slot.Teams {
+			rows = append(rows, &CheckInRow{
+				Slot:    newSlot(slot),
+				Start:   slot.Start,
+				CheckIn: checkInFind(slot.ID, team),
+			})
+		}
+	}
+
+	return rows, nil
+}
+
+func checkInPublish(checkIn *CheckIn) {
+	checkInSubscribersLock.Lock()
+	defer checkInSubscribersLock.Unlock()
+
+	for ch := range checkInSubscribers {
+		select {
+		case ch <- checkIn:
+		default:
+		}
+	}
+}
+
+func checkInSubscribe() chan *CheckIn {
+	checkInSubscribersLock.Lock()
+	defer checkInSubscribersLock.Unlock()
+
+	ch := make(chan *CheckIn, 16)
+	checkInSubscribers[ch] = true
+
+	return ch
+}
+
+func checkInUnsubscribe(ch chan *CheckIn) {
+	checkInSubscribersLock.Lock()
+	defer checkInSubscribersLock.Unlock()
+
+	delete(checkInSubscribers, ch)
+}
+
+func adminEvaluations() (string, http.HandlerFunc) {
+	return "/admin/evaluations", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		loc, err := time.LoadLocation(config.EvaluationsTimeZone)
+		if err != nil {
+			loc = time.Local
+		}
+
+		date := r.URL.Query().Get("date")
+		day, err := time.ParseInLocation("2006-01-02", date, loc)
+		if err != nil {
+			now := time.Now().In(loc)
+			day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+			date = day.Format("2006-01-02")
+		}
+
+		data := map[string]interface{}{
+			"Date":     date,
+			"Statuses": checkInStatuses,
+		}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			switch r.FormValue("action") {
+			case "status":
+				err = checkInSet(r.FormValue("checkin[slot]"), r.FormValue("checkin[team]"),
+					r.FormValue("checkin[status]"), CurrentUser(r).UserName)
+			case "noshows":
+				err = checkInMarkNoShows(day, CurrentUser(r).UserName)
+			}
+
+			if err != nil {
+				data["Flash"] = err.Error()
+			}
+		}
+
+		rows, err := checkInRows(day)
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+
+		noShows := []*CheckInRow{}
+		for _, row := range rows {
+			if row.CheckIn.Status == checkInNoShow {
+				noShows = append(noShows, row)
+			}
+		}
+
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"no-shows-%s.csv\"", date))
+
+			out := csv.NewWriter(w)
+			out.Write([]string{"Date", "Time", "Team", "Location", "Evaluators"})
+			for _, row := range noShows {
+				out.Write([]string{row.Slot.Date, row.Slot.Time, row.CheckIn.Team, row.Slot.Location, strings.Join(row.Slot.Evaluators, ", ")})
+			}
+			out.Flush()
+			return
+		}
+
+		data["Rows"] = rows
+		data["NoShows"] = noShows
+
+		Render(w, r, "admin/evaluations", data)
+	}
+}
+
+// checkInMarkNoShows marks every team of the day that never checked in to a
+// slot that has already started as a no-show.
+func checkInMarkNoShows(day time.Time, by string) error {
+	rows, err := checkInRows(day)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		if row.CheckIn.Status != checkInScheduled || row.Start.After(now) {
+			continue
+		}
+
+		if err := checkInSet(row.CheckIn.SlotID, row.CheckIn.Team, checkInNoShow, by); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adminEvaluationsEvents streams check-in changes to the dashboard as
+// Server-Sent Events.
+func adminEvaluationsEvents() (string, http.HandlerFunc) {
+	return "/admin/evaluations/events", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		flusher.Flush()
+
+		ch := checkInSubscribe()
+		defer checkInUnsubscribe(ch)
+
+		heartbeat := time.NewTicker(30 * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case checkIn := <-ch:
+				data, _ := json.Marshal(checkIn)
+				fmt.Fprintf(w, "event: checkin\ndata: %s\n\n", data)
+			}
+			flusher.Flush()
+		}
+	}
+}
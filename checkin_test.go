@@ -0,0 +1,115 @@
+package submit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/scheduler"
+)
+
+func TestCheckInTeam(t *testing.T) {
+	oldWindow := config.EvaluationsCheckInWindow
+	t.Cleanup(func() { config.EvaluationsCheckInWindow = oldWindow })
+	config.EvaluationsCheckInWindow = "30m"
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		start  time.Duration
+		booked bool
+		status string
+		err    string
+		want   string
+	}{
+		{name: "no slot", err: "no slot"},
+		{name: "ended", start: -2 * time.Hour, booked: true, err: "has ended", want: checkInScheduled},
+		{name: "too early", start: time.Hour, booked: true, err: "opens", want: checkInScheduled},
+		{name: "within window", start: 10 * time.Minute, booked: true, want: checkInCheckedIn},
+		{name: "started", start: -10 * time.Minute, booked: true, want: checkInCheckedIn},
+		{name: "already in progress", start: -10 * time.Minute, booked: true, status: checkInInProgress, want: checkInInProgress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot := &scheduler.Slot{ID: "s1", Start: now.Add(tt.start), End: now.Add(tt.start + time.Hour)}
+			if tt.booked {
+				slot.Teams = []string{"Team 01"}
+			}
+			withLocalSlots(t, slot)
+
+			if tt.status != "" {
+				if err := checkInSet("s1", "Team 01", tt.status, "alice"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := checkInTeam(student("a"))
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("checkInTeam() = %v, want %q", err, tt.err)
+			}
+			if tt.want != "" {
+				if got := checkInFind("s1", "Team 01").Status; got != tt.want {
+					t.Errorf("status = %s, want %s", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckInSet(t *testing.T) {
+	openStore(t)
+
+	ch := checkInSubscribe()
+	defer checkInUnsubscribe(ch)
+
+	if err := checkInSet("s1", "Team 01", "late", "alice"); err == nil {
+		t.Error("set an invalid status")
+	}
+
+	if err := checkInSet("s1", "Team 01", checkInDone, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case checkIn := <-ch:
+		if checkIn.Team != "Team 01" || checkIn.Status != checkInDone || checkIn.UpdatedBy != "alice" {
+			t.Errorf("published %+v", checkIn)
+		}
+	default:
+		t.Error("the change wasn't published")
+	}
+
+	if got := checkInFind("s1", "Team 02").Status; got != checkInScheduled {
+		t.Errorf("status of a team never checked in = %s, want %s", got, checkInScheduled)
+	}
+}
+
+func TestCheckInMarkNoShows(t *testing.T) {
+	now := time.Now()
+	withLocalSlots(t,
+		&scheduler.Slot{ID: "started", Start: now.Add(-30 * time.Minute), End: now.Add(30 * time.Minute), Capacity: 2, Teams: []string{"Absent", "Present"}},
+		&scheduler.Slot{ID: "later", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour), Teams: []string{"Later"}},
+	)
+
+	if err := checkInSet("started", "Present", checkInCheckedIn, "Present"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkInMarkNoShows(now.Add(-12*time.Hour), "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		slot, team, want string
+	}{
+		{"started", "Absent", checkInNoShow},
+		{"started", "Present", checkInCheckedIn},
+		{"later", "Later", checkInScheduled},
+	}
+
+	for _, tt := range tests {
+		if got := checkInFind(tt.slot, tt.team).Status; got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.team, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package submit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ramin0/submit/lib/slack"
+	"github.com/ramin0/submit/lib/util"
+)
+
+var (
+	teamIDRegexp     = regexp.MustCompile("^\\d+$")
+	slotActionRegexp = regexp.MustCompile("^(show|free|book|cancel)$")
+)
+
+type command struct {
+	Name        string
+	Description string
+	Feature     string
+	Args        []*commandArg
+	Allow       func(c *commandContext) error
+	Run         func(c *commandContext) (string, error)
+}
+
+type commandArg struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Optional bool
+}
+
+type commandContext struct {
+	Event   event
+	Command *command
+	Args    map[string]string
+	student map[string]string
+}
+
+// slackCommands lists the commands understood both as their own slash command
+// and as a subcommand of /submit.
+func slackCommands() []*command {
+	return []*command{
+		{
+			Name:        "help",
+			Description: "List the commands, or show how to use one",
+			Args:        []*commandArg{{Name: "command", Optional: true}},
+			Run:         commandHelp,
+		},
+		{
+			Name:        "id",
+			Description: "Show the student info of a Slack user",
+			Args:        []*commandArg{{Name: "@user", Pattern: slackIDRegexp}},
+			Allow:       commandAdminOrSelf,
+			Run:         commandID,
+		},
+		{
+			Name:        "team",
+			Description: "List the members of a team",
+			Args:        []*commandArg{{Name: "team", Pattern: teamIDRegexp}},
+			Allow:       commandAdminOrTeam,
+			Run:         commandTeam,
+		},
+		{
+			Name:        "proposal",
+			Description: "Show the proposal of a team",
+			Args:        []*commandArg{{Name: "team", Pattern: teamIDRegexp}},
+			Allow:       commandAdminOrTeam,
+			Run:         commandProposal,
+		},
+		{
+			Name:        "grades",
+			Description: "Show your released grades; admins can pass a student ID",
+			Feature:     "grades",
+			Args:        []*commandArg{{Name: "id", Pattern: studentApplicationNoRegexp, Optional: true}},
+			Allow:       commandAdminOrOwnID,
+			Run:         commandGrades,
+		},
+		{
+			Name:        "slot",
+			Description: "Show your team's evaluation slot, list the free ones, book or cancel",
+			Feature:     "evaluations",
+			Args: []*commandArg{
+				{Name: "show|free|book|cancel", Pattern: slotActionRegexp, Optional: true},
+				{Name: "slot", Optional: true},
+			},
+			Allow: commandStudent,
+			Run:   commandSlot,
+		},
+	}
+}
+
+func commandFind(name string) *command {
+	for _, cmd := range slackCommands() {
+		if cmd.Name == name && (cmd.Feature == "" || featureEnabled(cmd.Feature)) {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+// Usage func
+func (cmd *command) Usage() string {
+	usage := "/submit " + cmd.Name
+	for _, arg := range cmd.Args {
+		if arg.Optional {
+			usage += fmt.Sprintf(" [%s]", arg.Name)
+		} else {
+			usage += fmt.Sprintf(" <%s>", arg.Name)
+		}
+	}
+
+	return usage
+}
+
+func (cmd *command) parse(text string) (map[string]string, error) {
+	fields := strings.Fields(text)
+	if len(fields) > len(cmd.Args) {
+		return nil, fmt.Errorf("Too many arguments. Usage: `%s`", cmd.Usage())
+	}
+
+	args := map[string]string{}
+	for i, arg := range cmd.Args {
+		if i >= len(fields) {
+			if !arg.Optional {
+				return nil, fmt.Errorf("Missing %s. Usage: `%s`", arg.Name, cmd.Usage())
+			}
+			continue
+		}
+
+		if arg.Pattern != nil && !arg.Pattern.MatchString(fields[i]) {
+			return nil, fmt.Errorf("Invalid %s: %s. Usage: `%s`", arg.Name, fields[i], cmd.Usage())
+		}
+		args[arg.Name] = fields[i]
+	}
+
+	return args, nil
+}
+
+// runCommand runs a slash command, either one of slackCommands or /submit
+// followed by one of their names. The text returned, if any, is shown to the
+// user right away; anything slow replies later through the response URL.
+func runCommand(e event) (string, error) {
+	name, text := e.Command.Cmd, e.Command.Text
+	if name == "submit" {
+		fields := strings.SplitN(strings.TrimSpace(text), " ", 2)
+		name, text = fields[0], ""
+		if len(fields) > 1 {
+			text = fields[1]
+		}
+		if name == "" {
+			name = "help"
+		}
+	}
+
+	cmd := commandFind(name)
+	if cmd == nil {
+		return "", fmt.Errorf("Unknown command `%s`, try `/submit help`", name)
+	}
+
+	args, err := cmd.parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	c := &commandContext{Event: e, Command: cmd, Args: args}
+	if cmd.Allow != nil {
+		if err := cmd.Allow(c); err != nil {
+			return "", err
+		}
+	}
+
+	return cmd.Run(c)
+}
+
+// commandAction runs the command a button or menu option carries as its value,
+// as if the user who clicked it had typed /submit followed by the value.
+func commandAction(e event, value string) error {
+	e.Type = "cmd"
+	e.Command.Cmd = "submit"
+	e.Command.Text = value
+
+	text, err := runCommand(e)
+	if err != nil {
+		text = ":warning: " + err.Error()
+	}
+	if text == "" {
+		return nil
+	}
+
+	return slackReply(e.Command.ResponseURL, text)
+}
+
+// slackReply shows a text only to the user behind the response URL.
+func slackReply(responseURL, text string) error {
+	return slack.WebhookResponse(responseURL, slack.NewMessage(text, slack.NewSection(text)).Ephemeral())
+}
+
+// Admin func
+func (c *commandContext) Admin() bool {
+	return slackAdmin(c.Event.Command.User.ID)
+}
+
+// Student returns the student who sent the command.
+func (c *commandContext) Student() (map[string]string, error) {
+	if c.student == nil {
+		student, err := studentForSlackUser(c.Event.Command.User.ID)
+		if err != nil {
+			return nil, err
+		}
+		c.student = student
+	}
+
+	return c.student, nil
+}
+
+func commandAdminOrSelf(c *commandContext) error {
+	if c.Admin() || slackIDRegexp.FindStringSubmatch(c.Args["@user"])[1] == c.Event.Command.User.ID {
+		return nil
+	}
+
+	return fmt.Errorf("Unauthorized")
+}
+
+func commandAdminOrOwnID(c *commandContext) error {
+	if c.Args["id"] == "" || c.Admin() {
+		return nil
+	}
+
+	student, err := c.Student()
+	if err != nil {
+		return err
+	}
+	if student["ID"] != c.Args["id"] {
+		return fmt.Errorf("Unauthorized")
+	}
+
+	return nil
+}
+
+func commandStudent(c *commandContext) error {
+	student, err := c.Student()
+	if err != nil {
+		return err
+	}
+	if student["Team"] == "" {
+		return fmt.Errorf("You're not on a team yet")
+	}
+
+	return nil
+}
+
+func commandAdminOrTeam(c *commandContext) error {
+	if c.Admin() {
+		return nil
+	}
+
+	student, err := c.Student()
+	if err != nil {
+		return err
+	}
+	if util.TrimTeamName(student["Team"]) != c.Args["team"] {
+		return fmt.Errorf("Unauthorized")
+	}
+
+	return nil
+}
+
+func commandHelp(c *commandContext) (string, error) {
+	if name := c.Args["command"]; name != "" {
+		cmd := commandFind(name)
+		if cmd == nil {
+			return "", fmt.Errorf("Unknown command `%s`, try `/submit help`", name)
+		}
+
+		return fmt.Sprintf("`%s`\n%s", cmd.Usage(), cmd.Description), nil
+	}
+
+	lines := []string{}
+	for _, cmd := range slackCommands() {
+		if cmd.Feature != "" && !featureEnabled(cmd.Feature) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("`%s` %s", cmd.Usage(), cmd.Description))
+	}
+	sort.Strings(lines)
+
+	return "*Commands:*\n" + strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,176 @@
+package submit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ramin0/submit/config"
+)
+
+func withFeatures(t *testing.T, features map[string]bool) {
+	old := config.FeaturesEnabled
+	config.FeaturesEnabled = features
+	t.Cleanup(func() { config.FeaturesEnabled = old })
+}
+
+func withSlackAdmins(t *testing.T, admins ...string) {
+	old := config.SlackAdmins
+	config.SlackAdmins = admins
+	t.Cleanup(func() { config.SlackAdmins = old })
+}
+
+func slashCommand(userID, cmd, text string) event {
+	e := event{Type: "cmd"}
+	e.Command.Cmd = cmd
+	e.Command.Text = text
+	e.Command.User.ID = userID
+	return e
+}
+
+func TestCommandUsage(t *testing.T) {
+	withFeatures(t, map[string]bool{"evaluations": true})
+
+	for name, want := range map[string]string{
+		"help":  "/submit help [command]",
+		"id":    "/submit id <@user>",
+		"team":  "/submit team <team>",
+		"slot":  "/submit slot [show|free|book|cancel] [slot]",
+		"grade": "",
+	} {
+		cmd := commandFind(name)
+		if cmd == nil {
+			if want != "" {
+				t.Errorf("commandFind(%q) = nil", name)
+			}
+			continue
+		}
+		if got := cmd.Usage(); got != want {
+			t.Errorf("Usage of %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	withFeatures(t, map[string]bool{"evaluations": true, "grades": true})
+
+	for _, tc := range []struct {
+		name, text string
+		want       map[string]string
+		err        string
+	}{
+		{"team", "12", map[string]string{"team": "12"}, ""},
+		{"team", "  12  ", map[string]string{"team": "12"}, ""},
+		{"team", "", nil, "Missing team"},
+		{"team", "twelve", nil, "Invalid team: twelve"},
+		{"team", "12 13", nil, "Too many arguments"},
+		{"id", "<@U123|student>", map[string]string{"@user": "<@U123|student>"}, ""},
+		{"id", "U123", nil, "Invalid @user"},
+		{"grades", "", map[string]string{}, ""},
+		{"grades", "37-1234", map[string]string{"id": "37-1234"}, ""},
+		{"slot", "book abc", map[string]string{"show|free|book|cancel": "book", "slot": "abc"}, ""},
+		{"slot", "take abc", nil, "Invalid show|free|book|cancel: take"},
+	} {
+		args, err := commandFind(tc.name).parse(tc.text)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) || !strings.Contains(err.Error(), "Usage: `/submit "+tc.name) {
+				t.Errorf("parse %s %q: got %v, want %q with the usage", tc.name, tc.text, err, tc.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parse %s %q: %v", tc.name, tc.text, err)
+			continue
+		}
+		if len(args) != len(tc.want) {
+			t.Errorf("parse %s %q = %v, want %v", tc.name, tc.text, args, tc.want)
+		}
+		for k, v := range tc.want {
+			if args[k] != v {
+				t.Errorf("parse %s %q = %v, want %v", tc.name, tc.text, args, tc.want)
+			}
+		}
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	withFeatures(t, map[string]bool{"grades": true})
+
+	text, err := runCommand(slashCommand("U1", "submit", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text, "*Commands:*\n") {
+		t.Errorf("help = %q", text)
+	}
+	for _, usage := range []string{"/submit help [command]", "/submit id <@user>", "/submit grades [id]"} {
+		if !strings.Contains(text, usage) {
+			t.Errorf("help is missing %q:\n%s", usage, text)
+		}
+	}
+	if strings.Contains(text, "/submit slot") {
+		t.Errorf("help lists slot with evaluations disabled:\n%s", text)
+	}
+
+	text, err = runCommand(slashCommand("U1", "help", "team"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "`/submit team <team>`\nList the members of a team" {
+		t.Errorf("help team = %q", text)
+	}
+
+	if _, err := runCommand(slashCommand("U1", "submit", "help slot")); err == nil || !strings.Contains(err.Error(), "Unknown command `slot`") {
+		t.Errorf("help for a disabled command = %v", err)
+	}
+}
+
+func TestCommandUnknown(t *testing.T) {
+	withFeatures(t, map[string]bool{})
+
+	for _, e := range []event{slashCommand("U1", "submit", "frobnicate"), slashCommand("U1", "grades", "")} {
+		if _, err := runCommand(e); err == nil || !strings.Contains(err.Error(), "Unknown command") {
+			t.Errorf("%s %q = %v, want an unknown command", e.Command.Cmd, e.Command.Text, err)
+		}
+	}
+}
+
+func TestCommandAllowDenials(t *testing.T) {
+	withSlackAdmins(t, "UADMIN")
+
+	// Someone else's info is only for admins.
+	if _, err := runCommand(slashCommand("U1", "submit", "id <@U2|other>")); err == nil || err.Error() != "Unauthorized" {
+		t.Errorf("id of another user = %v, want Unauthorized", err)
+	}
+
+	student := func(userID string, args map[string]string, info map[string]string) *commandContext {
+		return &commandContext{Event: slashCommand(userID, "submit", ""), Args: args, student: info}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		allow func(*commandContext) error
+		c     *commandContext
+		err   string
+	}{
+		{"own id", commandAdminOrSelf, student("U1", map[string]string{"@user": "<@U1|me>"}, nil), ""},
+		{"admin id", commandAdminOrSelf, student("UADMIN", map[string]string{"@user": "<@U2|other>"}, nil), ""},
+		{"admin id prefix", commandAdminOrSelf, student("UADMIN2", map[string]string{"@user": "<@U2|other>"}, nil), "Unauthorized"},
+		{"admin id inside", commandAdminOrSelf, student("XUADMINX", map[string]string{"@user": "<@U2|other>"}, nil), "Unauthorized"},
+		{"other team", commandAdminOrTeam, student("U1", map[string]string{"team": "13"}, map[string]string{"Team": "Team 12"}), "Unauthorized"},
+		{"own team", commandAdminOrTeam, student("U1", map[string]string{"team": "12"}, map[string]string{"Team": "Team 12"}), ""},
+		{"admin team", commandAdminOrTeam, student("UADMIN", map[string]string{"team": "13"}, nil), ""},
+		{"other grades", commandAdminOrOwnID, student("U1", map[string]string{"id": "37-1235"}, map[string]string{"ID": "37-1234"}), "Unauthorized"},
+		{"own grades", commandAdminOrOwnID, student("U1", map[string]string{"id": "37-1234"}, map[string]string{"ID": "37-1234"}), ""},
+		{"no id", commandAdminOrOwnID, student("U1", map[string]string{}, nil), ""},
+		{"no team", commandStudent, student("U1", map[string]string{}, map[string]string{"Team": ""}), "You're not on a team yet"},
+		{"on a team", commandStudent, student("U1", map[string]string{}, map[string]string{"Team": "Team 12"}), ""},
+	} {
+		err := tc.allow(tc.c)
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: got %v, want allowed", tc.name, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
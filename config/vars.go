@@ -9,6 +9,16 @@ var (
 	TeamNameFormat     = "Team %2v"
 	FeaturesEnabled    = map[string]bool{}
 
+	// Store
+	StorePath = "data"
+
+	// Jobs
+	JobsConcurrency = 4
+	JobsMaxAttempts = 8
+	JobsBackoff     = "5s"
+	JobsMaxBackoff  = "30m"
+	JobsRetention   = "24h"
+
 	// Google
 	GoogleAPIClientSecret      = ""
 	GoogleAPIClientToken       = ""
@@ -20,11 +30,78 @@ var (
 	EvaluationsCalendarID      = "primary"
 	EvaluationsWeekStart       = "1989-03-21T00:00:00+02:00"
 	EvaluationsWeekEnd         = "1989-03-21T00:00:00+02:00"
+	EvaluationsBackend         = "google"
+	EvaluationsTimeZone        = "Africa/Cairo"
+	EvaluationsGroupEvaluators = map[string][]string{}
+	EvaluationsOverflowAfter   = ""
+	EvaluationsBookingOpens    = ""
+	EvaluationsBookingCloses   = ""
+	EvaluationsMinNotice       = "24h"
+	EvaluationsOfferExpiry     = "12h"
+	EvaluationsFeedSecret      = ""
+	EvaluationsCheckInWindow   = "30m"
+	EvaluationsRubric          = []map[string]string{}
+	EvaluationsGradeMethod     = "Evaluation"
+
+	// Grades
+	GradesDefaultVisibility = "published"
+	GradesStatsMinCount     = 5
+	GradesStatsBuckets      = 10
+	GradesStatsCacheTTL     = "5m"
+	GradesComponents        = []map[string]string{}
+	GradesCategories        = []map[string]string{}
+	GradesLetterScale       = []map[string]string{}
+	GradesTotalCap          = 100.0
+
+	// Proposals
+	ProposalsDeadline        = "1989-03-21T00:00:00+02:00"
+	ProposalsQuestions       = []string{}
+	ProposalsTopicAllocation = "first-come"
+	ProposalsTopicsDeadline  = ""
+	ProposalsTopicChoices    = 3
+
+	// Reminders
+	RemindersInterval = "5m"
+	RemindersDeadline = []string{"48h", "2h"}
+	RemindersSlot     = []string{"1h"}
+
+	// CalDAV
+	CalDAVURL      = ""
+	CalDAVUsername = ""
+	CalDAVPassword = ""
+
+	// Grading
+	GradingCommand       = ""
+	GradingWorkDir       = ""
+	GradingWorkers       = 2
+	GradingTimeout       = "5m"
+	GradingCPULimit      = 120
+	GradingMemoryLimit   = 1024
+	GradingPassPattern   = "(?m)^\\s*--- PASS"
+	GradingFailPattern   = "(?m)^\\s*--- FAIL"
+	GradingSandbox       = "nsjail"
+	GradingSandboxPath   = "nsjail"
+	GradingSandboxMounts = []string{"/bin", "/lib", "/lib64", "/usr"}
+	GradingArchiveSize   = int64(256 * 1024 * 1024)
+	GradingArchiveFiles  = 10000
+
+	// Similarity
+	SimilarityExtensions  = []string{".c", ".cpp", ".h", ".java", ".go", ".py", ".js", ".ts", ".rb", ".hs", ".s", ".asm"}
+	SimilarityKGram       = 5
+	SimilarityWindow      = 4
+	SimilarityThreshold   = 0.25
+	SimilarityMaxFileSize = int64(256 * 1024)
 
 	// Slack
-	SlackTestToken    = ""
-	SlackUserToken    = ""
-	SlackBotToken     = ""
-	SlackWebhookToken = ""
-	SlackAdmins       = []string{}
+	SlackTestToken            = ""
+	SlackUserToken            = ""
+	SlackBotToken             = ""
+	SlackWebhookToken         = ""
+	SlackSigningSecret        = ""
+	SlackClientID             = ""
+	SlackClientSecret         = ""
+	SlackSyncInterval         = "24h"
+	SlackSignatureMaxAge      = "5m"
+	SlackAdmins               = []string{}
+	SlackAnnouncementsChannel = ""
 )
@@ -0,0 +1,51 @@
+package submit
+
+import (
+	"net/http"
+
+	"github.com/ramin0/submit/lib/grader"
+)
+
+func submitGrading() (string, http.HandlerFunc) {
+	return "/submit/grading", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("grading") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		user := CurrentUser(r)
+		submission := grader.Find(r.URL.Query().Get("id"))
+		if submission == nil || (!user.Admin() && submission.Team != user.TeamName()) {
+			http.NotFound(w, r)
+			return
+		}
+
+		Render(w, r, "grading", map[string]interface{}{
+			"Submission": submission,
+		})
+	}
+}
+
+func adminGrading() (string, http.HandlerFunc) {
+	return "/admin/grading", func(w http.ResponseWriter, r *http.Request) {
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		Render(w, r, "admin/grading", map[string]interface{}{
+			"Submissions": grader.All(),
+		})
+	}
+}
+
+func teamGradings(user *User) []*grader.Submission {
+	if !featureEnabled("grading") {
+		return nil
+	}
+
+	return grader.TeamSubmissions(user.TeamName())
+}
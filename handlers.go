@@ -3,14 +3,19 @@ package submit
 import (
 	"fmt"
 	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-errors/errors"
 	"github.com/ramin0/submit/config"
-	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/grader"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/scheduler"
 	"github.com/ramin0/submit/lib/slack"
 )
 
@@ -25,9 +30,16 @@ func Mux() http.Handler {
 	for _, f := range []func() (string, http.HandlerFunc){
 		root, webhook,
 		login, logout,
-		grades, proposal, submit, evaluation,
-		settings, settingsSlack,
-		adminSessions,
+		grades, gradesRegrade, proposal, submit, submitGrading, evaluation,
+		evaluationInvite, calendarFeed,
+		settings, settingsSlack, settingsSlackConnect, settingsSlackCallback,
+		settingsSlackUnlink, settingsReminders,
+		adminSessions, adminGrading, adminJobs, adminGrades, adminAnalytics,
+		adminTotals, adminRegrades,
+		adminProposals, adminProposalReview, adminTopics,
+		adminSimilarity, adminSimilarityReport,
+		adminSlots, adminAgenda,
+		adminEvaluations, adminEvaluationsEvents, adminEvaluate,
 	} {
 		pattern, fn := f()
 
@@ -72,10 +84,12 @@ func wrap(next http.HandlerFunc) http.HandlerFunc {
 func sessionLog(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if s := currentSession(r); s != nil {
+			sessionsLock.Lock()
 			if len(s.History) == 5 {
 				s.History = s.History[0:4]
 			}
 			s.History = append([]string{r.URL.Path}, s.History...)
+			sessionsLock.Unlock()
 		}
 
 		next(w, r)
@@ -159,6 +173,8 @@ func grades() (string, http.HandlerFunc) {
 		Render(w, r, "grades", map[string]interface{}{
 			"Methods": methods,
 			"Marks":   marks,
+			"Rows":    gradeRows(methods, marks),
+			"Total":   gradeTotal(methods, marks),
 		})
 	}
 }
@@ -174,7 +190,47 @@ func proposal() (string, http.HandlerFunc) {
 			return
 		}
 
-		Render(w, r, "proposal", nil)
+		user := CurrentUser(r)
+		data := map[string]interface{}{}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			switch action := r.FormValue("action"); action {
+			case "topics":
+				if err := topicChoose(r, user); err != nil {
+					data["Flash"] = err.Error()
+				} else {
+					data["Success"] = "Topic choices saved."
+				}
+			default:
+				if err := proposalSave(r, user); err != nil {
+					data["Flash"] = err.Error()
+				} else if action != "submit" {
+					data["Success"] = "Draft saved."
+				}
+			}
+		}
+
+		if topics, _ := topicsAll(); len(topics) > 0 {
+			ranks := []int{}
+			for i := 1; i <= len(topics) && i <= config.ProposalsTopicChoices; i++ {
+				ranks = append(ranks, i)
+			}
+
+			data["Topics"] = topics
+			data["TopicRanks"] = ranks
+			data["TopicChoice"] = topicChoiceFind(user.TeamName())
+			data["Topic"] = teamTopic(user.TeamName())
+			data["TopicsClosed"] = topicsDeadlinePassed()
+		}
+
+		draft := proposalFind(user.TeamName())
+		data["Draft"] = draft
+		data["Editable"] = draft.Editable() && len(draft.Questions) > 0 && (draft.Submitted() || user.Proposal() == nil)
+		data["DeadlinePassed"] = proposalDeadlinePassed()
+
+		Render(w, r, "proposal", data)
 	}
 }
 
@@ -196,7 +252,7 @@ func submit() (string, http.HandlerFunc) {
 		}
 
 		if featureEnabled("evaluations") {
-			if slot, _ := google.CalendarTeamSlot(CurrentUser(r).TeamName()); slot == nil {
+			if slot, _ := scheduler.Get().TeamSlot(CurrentUser(r).TeamName()); slot == nil {
 				Render(w, r, "submit", map[string]bool{"EvaluationMissing": true})
 				return
 			}
@@ -247,30 +303,61 @@ func submit() (string, http.HandlerFunc) {
 				"Success": true,
 			}
 
+			user := CurrentUser(r)
 			for t, d := range data {
 				switch t {
 				case "url":
 					url := d.(string)
-					err := google.SheetsSubmit(CurrentUser(r).TeamName(), url)
-					if err != nil {
+					if _, err := jobs.Enqueue(jobSubmissionSheet, map[string]string{
+						"Team": user.TeamName(),
+						"URL":  url,
+					}); err != nil {
 						panic(err)
 					}
 				case "file":
-					file := d.(map[string]interface{})["File"].(io.Reader)
+					file := d.(map[string]interface{})["File"].(multipart.File)
 					filename := d.(map[string]interface{})["Filename"].(string)
-					shareURL, err := google.DriveSubmit(CurrentUser(r).Info(), file, filename)
+					path, err := spoolUpload(file, filename)
 					if err != nil {
 						panic(err)
 					}
-					renderData["ShareURL"] = shareURL
+
+					args := user.Info()
+					args["Path"] = path
+					args["Filename"] = filename
+					if _, err := jobs.Enqueue(jobSubmissionDrive, args); err != nil {
+						panic(err)
+					}
+					renderData["ShareURL"] = teamFolderURL(user.TeamName())
+
+					// The upload is queued already, so a grading failure only
+					// skips grading rather than failing the submission.
+					if featureEnabled("grading") && config.GradingCommand != "" {
+						if _, err := file.Seek(0, io.SeekStart); err != nil {
+							log.Printf("Couldn't grade %s: %v", user.TeamName(), err)
+						} else if _, err := grader.Enqueue(user.TeamName(), file, filename); err != nil {
+							log.Printf("Couldn't grade %s: %v", user.TeamName(), err)
+						}
+					}
 				}
 			}
 
+			// Only once everything is queued does the team count as having
+			// submitted, which stops its deadline reminders.
+			if err := submissionRecord(user.TeamName()); err != nil {
+				panic(err)
+			}
+
+			renderData["Gradings"] = teamGradings(CurrentUser(r))
 			Render(w, r, "submit", renderData)
 			return
 		}
 
-		Render(w, r, "submit", map[string]interface{}{"Items": config.SubmissionsItems})
+		Render(w, r, "submit", map[string]interface{}{
+			"Items":    config.SubmissionsItems,
+			"ShareURL": teamFolderURL(CurrentUser(r).TeamName()),
+			"Gradings": teamGradings(CurrentUser(r)),
+		})
 	}
 }
 
@@ -288,9 +375,23 @@ func evaluation() (string, http.HandlerFunc) {
 		if r.Method == http.MethodPost {
 			r.ParseForm()
 
-			slotID := strings.TrimSpace(r.FormValue("slot[id]"))
+			var err error
+			switch r.FormValue("action") {
+			case "cancel":
+				err = cancelSlot(CurrentUser(r))
+			case "checkin":
+				err = checkInTeam(CurrentUser(r))
+			case "waitlist":
+				err = waitlistJoin(CurrentUser(r))
+			case "accept":
+				err = waitlistAccept(CurrentUser(r))
+			case "leave":
+				err = waitlistDecline(CurrentUser(r).TeamName())
+			default:
+				err = reserveSlot(CurrentUser(r), strings.TrimSpace(r.FormValue("slot[id]")))
+			}
 
-			if err := google.CalendarReserveTeamSlot(CurrentUser(r).TeamName(), slotID); err != nil {
+			if err != nil {
 				Render(w, r, "evaluation", map[string]string{
 					"Flash": err.Error(),
 				})
@@ -301,35 +402,62 @@ func evaluation() (string, http.HandlerFunc) {
 		}
 
 		var teamSlot *Slot
-		slot, err := google.CalendarTeamSlot(CurrentUser(r).TeamName())
+		slot, err := scheduler.Get().TeamSlot(CurrentUser(r).TeamName())
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		var checkIn *CheckIn
 		if slot != nil {
-			teamSlot = newSlotFromEvent(slot)
+			teamSlot = newSlot(slot)
+			checkIn = checkInFind(slot.ID, CurrentUser(r).TeamName())
 		}
 
-		schedule := [][]*Slot{}
+		evaluator := r.URL.Query().Get("evaluator")
+		evaluators := []string{}
+		seen := map[string]bool{}
 
-		currentDate := ""
-		currentDay := -1
-		slots, _ := google.CalendarFreeSlots()
+		slots, _, _ := bookableSlots(CurrentUser(r))
+		filtered := []*scheduler.Slot{}
 		for _, slot := range slots {
-			newSlot := newSlotFromEvent(slot)
-			if currentDate != newSlot.Date {
-				currentDate = newSlot.Date
-				schedule = append(schedule, []*Slot{})
-				currentDay++
+			for _, e := range slot.Evaluators {
+				if !seen[e] {
+					seen[e] = true
+					evaluators = append(evaluators, e)
+				}
 			}
 
-			schedule[currentDay] = append(schedule[currentDay], newSlot)
+			if evaluator == "" || slot.HasEvaluator(evaluator) {
+				filtered = append(filtered, slot)
+			}
+		}
+		sort.Strings(evaluators)
+		schedule := newSchedule(filtered)
+
+		offer, offerExpires := "", ""
+		if entry := waitlistOffer(CurrentUser(r).TeamName()); entry != nil {
+			offer, offerExpires = entry.OfferTime, newTime(entry.OfferExpires)
+		}
+
+		bookingError := ""
+		if err := bookingOpen(); err != nil {
+			bookingError = err.Error()
+		} else if err := bookingNotice(slot); err != nil {
+			bookingError = err.Error()
 		}
 
 		Render(w, r, "evaluation", map[string]interface{}{
-			"Schedule": schedule,
-			"Reserved": teamSlot != nil,
-			"Slot":     teamSlot,
+			"Schedule":     schedule,
+			"Reserved":     teamSlot != nil,
+			"Slot":         teamSlot,
+			"Evaluator":    evaluator,
+			"Evaluators":   evaluators,
+			"BookingError": bookingError,
+			"FeedURL":      calendarFeedURL(r, calendarFeedTeam, CurrentUser(r).TeamName()),
+			"Waitlisted":   waitlistPosition(CurrentUser(r).TeamName()),
+			"Offer":        offer,
+			"OfferExpires": offerExpires,
+			"CheckIn":      checkIn,
 		})
 	}
 }
@@ -345,9 +473,7 @@ func settings() (string, http.HandlerFunc) {
 			return
 		}
 
-		Render(w, r, "settings", map[string]interface{}{
-			"SlackID": "",
-		})
+		Render(w, r, "settings", settingsData(r))
 	}
 }
 
@@ -376,10 +502,11 @@ func settingsSlack() (string, http.HandlerFunc) {
 			success, flash = "", fmt.Sprintf("Could not send invitation: %v", err)
 		}
 
-		Render(w, r, "settings", map[string]string{
-			"Success": success,
-			"Flash":   flash,
-		})
+		data := settingsData(r)
+		data["Success"] = success
+		data["Flash"] = flash
+
+		Render(w, r, "settings", data)
 	}
 }
 
@@ -389,8 +516,20 @@ func adminSessions() (string, http.HandlerFunc) {
 			return
 		}
 
+		// Render copies, as the layout looks the current session up again.
+		sessionsLock.RLock()
+		all := make(map[string]*Session, len(sessions))
+		for sessionID, session := range sessions {
+			all[sessionID] = &Session{
+				Timestamp: session.Timestamp,
+				History:   append([]string{}, session.History...),
+				User:      session.User,
+			}
+		}
+		sessionsLock.RUnlock()
+
 		Render(w, r, "admin/sessions", map[string]interface{}{
-			"Sessions": sessions,
+			"Sessions": all,
 		})
 	}
 }
@@ -22,8 +22,8 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/ramin0/submit/config"
 	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/scheduler"
 	httpntlm "github.com/vadimi/go-http-ntlm"
-	calendar "google.golang.org/api/calendar/v3"
 )
 
 var (
@@ -40,6 +40,9 @@ func Render(w io.Writer, r *http.Request, t string, data interface{}) {
 		"activeNav": func(path string) bool {
 			return r.URL.Path == path
 		},
+		"activeNavPrefix": func(prefix string) bool {
+			return strings.HasPrefix(r.URL.Path, prefix)
+		},
 		"currentURL": func() *url.URL {
 			return r.URL
 		},
@@ -57,7 +60,7 @@ func Render(w io.Writer, r *http.Request, t string, data interface{}) {
 				return ""
 			}
 
-			html := strings.Replace(s.(string), "\n", "<br />", -1)
+			html := strings.Replace(template.HTMLEscapeString(s.(string)), "\n", "<br />", -1)
 			return template.HTML(html)
 		},
 		"raw": func(s interface{}) template.HTML {
@@ -73,6 +76,7 @@ func Render(w io.Writer, r *http.Request, t string, data interface{}) {
 		"string": func(s interface{}) string {
 			return fmt.Sprintf("%v", s)
 		},
+		"join": strings.Join,
 		"now": func() time.Time {
 			return time.Now()
 		},
@@ -127,6 +131,36 @@ func renderJSON(w http.ResponseWriter, data interface{}, status ...int) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// invalidateGrades drops the grades cached for the given users, so /grades
+// reads them again from the sheet.
+func invalidateGrades(userIDs ...string) {
+	for _, userID := range userIDs {
+		cacheInvalidate("grades:" + userID)
+	}
+
+	invalidateGradeBook()
+}
+
+// invalidateProposal drops the proposal cached for a team's members, so
+// /proposal reads it again.
+func invalidateProposal(teamName string) {
+	cacheInvalidate("proposal:" + teamName)
+}
+
+func cacheInvalidate(key string) {
+	cacheVersionsLock.Lock()
+	defer cacheVersionsLock.Unlock()
+
+	cacheVersions[key]++
+}
+
+func cacheVersion(key string) int {
+	cacheVersionsLock.Lock()
+	defer cacheVersionsLock.Unlock()
+
+	return cacheVersions[key]
+}
+
 func featureEnabled(name string) bool {
 	return config.FeaturesEnabled[name]
 }
@@ -137,6 +171,9 @@ func currentSession(r *http.Request) *Session {
 		return nil
 	}
 
+	sessionsLock.RLock()
+	defer sessionsLock.RUnlock()
+
 	sessionID := sessionCookie.Value
 	session, sessionOk := sessions[sessionID]
 	if !sessionOk {
@@ -238,6 +275,10 @@ func fetchUserFromSheet(username string) (*User, error) {
 		return nil, err
 	}
 
+	return userFromSheet(userData), nil
+}
+
+func userFromSheet(userData map[string]string) *User {
 	return &User{
 		ID:        userData["ID"],
 		UserName:  userData["UserName"],
@@ -245,7 +286,7 @@ func fetchUserFromSheet(username string) (*User, error) {
 		group:     userData["Group"],
 		teamName:  userData["Team"],
 		teamGroup: userData["TeamGroup"],
-	}, nil
+	}
 }
 
 func persistUser(w http.ResponseWriter, user *User) {
@@ -253,6 +294,9 @@ func persistUser(w http.ResponseWriter, user *User) {
 		return
 	}
 
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
 	var sessionID string
 	for {
 		hasher := md5.New()
@@ -285,8 +329,9 @@ func persistUser(w http.ResponseWriter, user *User) {
 func unpersistUser(w http.ResponseWriter, r *http.Request) {
 	sessionCookie, err := r.Cookie(cookieName())
 	if err == nil {
-		sessionID := sessionCookie.Value
-		delete(sessions, sessionID)
+		sessionsLock.Lock()
+		delete(sessions, sessionCookie.Value)
+		sessionsLock.Unlock()
 	}
 
 	http.SetCookie(w, &http.Cookie{
@@ -346,14 +391,183 @@ func rootPath(i ...int) string {
 	return ""
 }
 
-func newSlotFromEvent(event *calendar.Event) *Slot {
-	eventDateTime, _ := time.Parse(time.RFC3339, event.Start.DateTime)
-	eventDate := eventDateTime.Format("Monday, January 2")
-	eventTime := eventDateTime.Format("3:04 PM")
+func newSlot(slot *scheduler.Slot) *Slot {
+	start := slot.Start
+	if loc, err := time.LoadLocation(config.EvaluationsTimeZone); err == nil {
+		start = start.In(loc)
+	}
 
 	return &Slot{
-		ID:   event.Id,
-		Date: eventDate,
-		Time: eventTime,
+		ID:         slot.ID,
+		Date:       start.Format("Monday, January 2"),
+		Time:       start.Format("3:04 PM"),
+		Location:   slot.Location,
+		VideoURL:   slot.VideoURL,
+		Evaluators: slot.Evaluators,
+		Teams:      slot.Teams,
+		Capacity:   slot.Remaining() + len(slot.Teams),
+		Remaining:  slot.Remaining(),
+	}
+}
+
+func reserveSlot(user *User, slotID string) error {
+	if err := bookingOpen(); err != nil {
+		return err
+	}
+
+	teamSlot, err := scheduler.Get().TeamSlot(user.TeamName())
+	if err != nil {
+		return err
+	}
+	if teamSlot != nil && teamSlot.ID == slotID {
+		return nil
+	}
+	if err := bookingNotice(teamSlot); err != nil {
+		return err
+	}
+
+	slots, err := scheduler.Get().FreeSlots()
+	if err != nil {
+		return err
+	}
+
+	for _, slot := range slots {
+		if slot.ID != slotID {
+			continue
+		}
+
+		if !slotAllowed(user.TeamGroup(), slot) {
+			return fmt.Errorf("This slot is reserved for other tutorial groups")
+		}
+		if slot.Remaining() <= waitlistHeld(user.TeamName())[slot.ID] {
+			return scheduler.ErrSlotTaken
+		}
+
+		if err := scheduler.Get().Reserve(user.TeamName(), slotID); err != nil {
+			return err
+		}
+
+		offer := waitlistOffer(user.TeamName())
+		waitlistLeave(user.TeamName())
+		if teamSlot != nil || (offer != nil && offer.OfferSlot != slotID) {
+			promoteWaitlist()
+		}
+		return nil
+	}
+
+	return scheduler.ErrSlotTaken
+}
+
+func cancelSlot(user *User) error {
+	if err := bookingOpen(); err != nil {
+		return err
+	}
+
+	teamSlot, err := scheduler.Get().TeamSlot(user.TeamName())
+	if err != nil {
+		return err
+	}
+	if teamSlot == nil {
+		return fmt.Errorf("Your team has no slot to cancel")
+	}
+	if err := bookingNotice(teamSlot); err != nil {
+		return err
+	}
+
+	if err := scheduler.Get().Release(user.TeamName()); err != nil {
+		return err
+	}
+
+	promoteWaitlist()
+	return nil
+}
+
+func bookingOpen() error {
+	now := time.Now()
+	if opens, err := time.Parse(time.RFC3339, config.EvaluationsBookingOpens); err == nil && now.Before(opens) {
+		return fmt.Errorf("Booking opens on %s", newTime(opens))
+	}
+	if closes, err := time.Parse(time.RFC3339, config.EvaluationsBookingCloses); err == nil && now.After(closes) {
+		return fmt.Errorf("Booking closed on %s", newTime(closes))
+	}
+
+	return nil
+}
+
+func bookingNotice(teamSlot *scheduler.Slot) error {
+	if teamSlot == nil {
+		return nil
+	}
+
+	notice, _ := time.ParseDuration(config.EvaluationsMinNotice)
+	if time.Until(teamSlot.Start) < notice {
+		return fmt.Errorf("Your slot can't be changed less than %v before it starts", notice)
+	}
+
+	return nil
+}
+
+func newTime(t time.Time) string {
+	if loc, err := time.LoadLocation(config.EvaluationsTimeZone); err == nil {
+		t = t.In(loc)
+	}
+
+	return t.Format("Monday, January 2, 3:04 PM")
+}
+
+// slotAllowed reports whether a team of the tutorial group may book the slot:
+// groups listed in EvaluationsGroupEvaluators only see slots run by their own
+// evaluators (or by nobody in particular), until EvaluationsOverflowAfter
+// opens every slot to everyone.
+func slotAllowed(teamGroup string, slot *scheduler.Slot) bool {
+	if len(slot.Evaluators) == 0 {
+		return true
+	}
+
+	evaluators, ok := config.EvaluationsGroupEvaluators[teamGroup]
+	if !ok {
+		return true
+	}
+
+	if overflowAfter, err := time.Parse(time.RFC3339, config.EvaluationsOverflowAfter); err == nil && time.Now().After(overflowAfter) {
+		return true
+	}
+
+	for _, evaluator := range evaluators {
+		if slot.HasEvaluator(evaluator) {
+			return true
+		}
 	}
+
+	return false
+}
+
+func newSchedule(slots []*scheduler.Slot) [][]*Slot {
+	schedule := [][]*Slot{}
+
+	currentDate := ""
+	currentDay := -1
+	for _, slot := range slots {
+		newSlot := newSlot(slot)
+		if currentDate != newSlot.Date {
+			currentDate = newSlot.Date
+			schedule = append(schedule, []*Slot{})
+			currentDay++
+		}
+
+		schedule[currentDay] = append(schedule[currentDay], newSlot)
+	}
+
+	return schedule
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
 }
@@ -0,0 +1,160 @@
+package submit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/grader"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	jobSubmissionSheet = "submission.sheet"
+	jobSubmissionDrive = "submission.drive"
+)
+
+var (
+	jobsOnce sync.Once
+)
+
+func startJobs() error {
+	var err error
+	jobsOnce.Do(func() {
+		for kind, fn := range map[string]jobs.Handler{
+			jobSubmissionSheet: jobSheetsSubmit,
+			jobSubmissionDrive: jobDriveSubmit,
+			jobCommandID:       jobCommandIDHandler,
+			jobCommandTeam:     jobCommandTeamHandler,
+			jobCommandProposal: jobCommandProposalHandler,
+			jobCommandGrades:   jobCommandGradesHandler,
+			jobCommandSlot:     jobCommandSlotHandler,
+			jobSimilarity:      jobSimilarityHandler,
+			jobSlotCreate:      jobSlotCreateHandler,
+			jobSlotUpdate:      jobSlotUpdateHandler,
+			jobSlotDelete:      jobSlotDeleteHandler,
+			jobWaitlistPromote: jobWaitlistPromoteHandler,
+			jobGradesWrite:     jobGradesWriteHandler,
+			jobGradesAnnounce:  jobGradesAnnounceHandler,
+			jobRegradeWrite:    jobRegradeWriteHandler,
+			jobProposalSheet:   jobProposalSheetHandler,
+			jobTopicsAllocate:  jobTopicsAllocateHandler,
+			jobSlackSync:       jobSlackSyncHandler,
+			jobTeamNotify:      jobTeamNotifyHandler,
+			jobSlackDM:         jobSlackDMHandler,
+		} {
+			jobs.Register(kind, config.JobsConcurrency, fn)
+		}
+		jobs.Register(grader.JobKind, config.GradingWorkers, grader.Process)
+		jobs.Register(jobRemindersScan, 1, jobRemindersScanHandler)
+
+		jobs.OnFailure(func(job *jobs.Job, err error) {
+			panicHandler(nil, nil, errors.Wrap(fmt.Errorf("job %s (%s) failed: %v", job.ID, job.Kind, err), 0))
+		})
+
+		if err = jobs.Start(); err != nil {
+			return
+		}
+		startReminders()
+		startSlackSync()
+	})
+
+	return err
+}
+
+func jobSheetsSubmit(args map[string]string) error {
+	return google.SheetsSubmit(args["Team"], args["URL"])
+}
+
+func jobDriveSubmit(args map[string]string) error {
+	file, err := os.Open(args["Path"])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	shareURL, err := google.DriveSubmit(args, file, args["Filename"])
+	if err != nil {
+		return err
+	}
+
+	store.Put("team_folders", args["Team"], shareURL)
+	os.Remove(args["Path"])
+
+	return nil
+}
+
+func spoolUpload(file io.Reader, filename string) (string, error) {
+	dir := filepath.Join(config.StorePath, "uploads")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + filepath.Base(filename)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, file); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+func teamFolderURL(teamName string) string {
+	var shareURL string
+	store.Get("team_folders", teamName, &shareURL)
+	return shareURL
+}
+
+func adminJobs() (string, http.HandlerFunc) {
+	return "/admin/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		flash := ""
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			id := strings.TrimSpace(r.FormValue("job[id]"))
+
+			var err error
+			switch r.FormValue("job[action]") {
+			case "retry":
+				err = jobs.Retry(id)
+			case "delete":
+				err = jobs.Delete(id)
+			}
+			if err == nil {
+				http.Redirect(w, r, "/admin/jobs", http.StatusFound)
+				return
+			}
+			flash = err.Error()
+		}
+
+		all, err := jobs.All()
+		if err != nil {
+			panic(err)
+		}
+
+		Render(w, r, "admin/jobs", map[string]interface{}{
+			"Flash": flash,
+			"Jobs":  all,
+		})
+	}
+}
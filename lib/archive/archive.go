@@ -0,0 +1,199 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ramin0/submit/config"
+)
+
+// limits tracks what an extraction wrote so far, so archives that expand to
+// more than GradingArchiveSize bytes or GradingArchiveFiles entries are
+// rejected before they fill the disk.
+type limits struct {
+	size  int64
+	files int
+}
+
+func (l *limits) entry() error {
+	l.files++
+	if l.files > config.GradingArchiveFiles {
+		return fmt.Errorf("Too many files in archive, the limit is %d", config.GradingArchiveFiles)
+	}
+
+	return nil
+}
+
+// Supported reports whether Extract can unpack a file, going by its name.
+func Supported(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Extract func
+func Extract(src, dst string) error {
+	name := strings.ToLower(src)
+	l := &limits{}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(src, dst, l)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		return extractTar(gz, dst, l)
+	case strings.HasSuffix(name, ".tar"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return extractTar(f, dst, l)
+	}
+
+	return fmt.Errorf("Unsupported archive: %s", filepath.Base(src))
+}
+
+// Root func
+func Root(dir string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+
+	return filepath.Join(dir, entries[0].Name())
+}
+
+func extractZip(src, dst string, l *limits) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err := l.entry(); err != nil {
+			return err
+		}
+
+		target, err := targetPath(dst, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = l.writeFile(target, rc, f.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractTar(r io.Reader, dst string, l *limits) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := l.entry(); err != nil {
+			return err
+		}
+
+		target, err := targetPath(dst, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := l.writeFile(target, tr, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func targetPath(dst, name string) (string, error) {
+	target := filepath.Join(dst, name)
+	if target != filepath.Clean(dst) && !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("Illegal path in archive: %s", name)
+	}
+
+	return target, nil
+}
+
+// writeFile copies an entry out, reading at most one byte past what is left of
+// the size limit so going over it is caught without trusting the headers.
+func (l *limits) writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	remaining := config.GradingArchiveSize - l.size
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	l.size += n
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		return fmt.Errorf("Archive too large, the limit is %d bytes uncompressed", config.GradingArchiveSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ramin0/submit/config"
+)
+
+type entry struct {
+	name    string
+	content string
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		fw, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(e.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, path string, entries []entry) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := tar.NewWriter(f)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"project.zip", true},
+		{"Project.ZIP", true},
+		{"project.tar.gz", true},
+		{"project.tgz", true},
+		{"project.tar", true},
+		{"project.rar", false},
+		{"main.go", false},
+		{"zip", false},
+	}
+
+	for _, tt := range tests {
+		if got := Supported(tt.name); got != tt.want {
+			t.Errorf("Supported(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	oldSize, oldFiles := config.GradingArchiveSize, config.GradingArchiveFiles
+	defer func() {
+		config.GradingArchiveSize, config.GradingArchiveFiles = oldSize, oldFiles
+	}()
+	config.GradingArchiveSize = 10
+	config.GradingArchiveFiles = 3
+
+	tests := []struct {
+		name    string
+		entries []entry
+		err     string
+	}{
+		{
+			name:    "within limits",
+			entries: []entry{{"project/main.go", "12345"}, {"project/go.mod", "12345"}},
+		},
+		{
+			name:    "too large",
+			entries: []entry{{"main.go", "123456"}, {"go.mod", "123456"}},
+			err:     "Archive too large",
+		},
+		{
+			name:    "too many files",
+			entries: []entry{{"a", ""}, {"b", ""}, {"c", ""}, {"d", ""}},
+			err:     "Too many files",
+		},
+		{
+			name:    "parent path",
+			entries: []entry{{"../escape.go", "1"}},
+			err:     "Illegal path",
+		},
+		{
+			name:    "sibling path",
+			entries: []entry{{"../dst-x/escape.go", "1"}},
+			err:     "Illegal path",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, format := range []string{".zip", ".tar"} {
+			t.Run(tt.name+format, func(t *testing.T) {
+				dir := t.TempDir()
+				src := filepath.Join(dir, "upload"+format)
+				if format == ".zip" {
+					writeZip(t, src, tt.entries)
+				} else {
+					writeTar(t, src, tt.entries)
+				}
+
+				dst := filepath.Join(dir, "dst")
+				err := Extract(src, dst)
+				if tt.err != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.err) {
+						t.Fatalf("Extract() = %v, want %q", err, tt.err)
+					}
+					if _, err := os.Stat(filepath.Join(dir, "escape.go")); err == nil {
+						t.Error("Extract() wrote outside the destination")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, e := range tt.entries {
+					b, err := ioutil.ReadFile(filepath.Join(dst, e.name))
+					if err != nil || string(b) != e.content {
+						t.Errorf("%s = %q, %v, want %q", e.name, b, err, e.content)
+					}
+				}
+				if root := Root(dst); root != filepath.Join(dst, "project") {
+					t.Errorf("Root() = %s, want the single top-level directory", root)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractUnsupported(t *testing.T) {
+	if err := Extract("project.rar", t.TempDir()); err == nil {
+		t.Error("Extract() of a .rar succeeded, want an error")
+	}
+}
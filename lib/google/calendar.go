@@ -2,14 +2,21 @@ package google
 
 import (
 	"fmt"
-	"time"
+	"net/http"
 
 	"github.com/ramin0/submit/config"
 	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 )
 
 var (
 	_calendarService *calendar.Service
+
+	// ErrSlotTaken var
+	ErrSlotTaken = fmt.Errorf("slot already reserved")
+
+	// ErrSlotExists var
+	ErrSlotExists = fmt.Errorf("slot already exists")
 )
 
 func calendarService() (*calendar.Service, error) {
@@ -28,27 +35,30 @@ func calendarService() (*calendar.Service, error) {
 	return _calendarService, nil
 }
 
-// CalendarFreeSlots func
-func CalendarFreeSlots() ([]*calendar.Event, error) {
+// CalendarSlot func
+func CalendarSlot(slotID string) (*calendar.Event, error) {
 	service, err := calendarService()
 	if err != nil {
 		return nil, err
 	}
 
-	timeMin, _ := time.Parse(time.RFC3339, config.EvaluationsWeekStart)
-	timeMax, _ := time.Parse(time.RFC3339, config.EvaluationsWeekEnd)
-	timeNow := time.Now()
-	if timeNow.After(timeMin) {
-		timeMin = timeNow
+	return service.Events.Get(config.EvaluationsCalendarID, slotID).Do()
+}
+
+// CalendarSearchSlots func
+func CalendarSearchSlots(q string) ([]*calendar.Event, error) {
+	service, err := calendarService()
+	if err != nil {
+		return nil, err
 	}
 
 	slots, err := service.Events.
 		List(config.EvaluationsCalendarID).
 		SingleEvents(true).
 		OrderBy("startTime").
-		TimeMin(timeMin.Format(time.RFC3339)).
-		TimeMax(timeMax.Format(time.RFC3339)).
-		Q("FREE").
+		TimeMin(config.EvaluationsWeekStart).
+		TimeMax(config.EvaluationsWeekEnd).
+		Q(q).
 		Do()
 	if err != nil {
 		return nil, err
@@ -57,67 +67,89 @@ func CalendarFreeSlots() ([]*calendar.Event, error) {
 	return slots.Items, nil
 }
 
-// CalendarTeamSlot func
-func CalendarTeamSlot(teamName string) (*calendar.Event, error) {
+// CalendarPatchSlot func
+//
+// The patch is conditional on the ETag of the slot as it was read, so a slot
+// changed by someone else in the meantime fails with ErrSlotTaken instead of
+// being overwritten.
+func CalendarPatchSlot(slot *calendar.Event, patch *calendar.Event) (*calendar.Event, error) {
 	service, err := calendarService()
 	if err != nil {
 		return nil, err
 	}
 
-	slots, err := service.Events.
-		List(config.EvaluationsCalendarID).
-		SingleEvents(true).
-		MaxResults(1).
-		TimeMin(config.EvaluationsWeekStart).
-		TimeMax(config.EvaluationsWeekEnd).
-		Q(teamName).
-		Do()
+	call := service.Events.Patch(config.EvaluationsCalendarID, slot.Id, patch)
+	call.Header().Set("If-Match", slot.Etag)
+
+	patched, err := call.Do()
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusPreconditionFailed {
+		return nil, ErrSlotTaken
+	}
+
+	return patched, err
+}
+
+// CalendarSlots func
+func CalendarSlots() ([]*calendar.Event, error) {
+	service, err := calendarService()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(slots.Items) == 0 {
-		return nil, nil
+	slots := []*calendar.Event{}
+	pageToken := ""
+	for {
+		events, err := service.Events.
+			List(config.EvaluationsCalendarID).
+			SingleEvents(true).
+			OrderBy("startTime").
+			TimeMin(config.EvaluationsWeekStart).
+			TimeMax(config.EvaluationsWeekEnd).
+			PageToken(pageToken).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+
+		slots = append(slots, events.Items...)
+
+		if events.NextPageToken == "" {
+			break
+		}
+		pageToken = events.NextPageToken
 	}
 
-	return slots.Items[0], nil
+	return slots, nil
 }
 
-// CalendarReserveTeamSlot func
-func CalendarReserveTeamSlot(teamName, slotID string) error {
+// CalendarCreateSlot func
+//
+// A slot given an ID that is taken, even by a deleted event, fails with
+// ErrSlotExists.
+func CalendarCreateSlot(slot *calendar.Event) (*calendar.Event, error) {
 	service, err := calendarService()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	newSlot, err := service.Events.Get(config.EvaluationsCalendarID, slotID).Do()
-	if err != nil {
-		return err
+	if slot.Summary == "" {
+		slot.Summary = "FREE"
 	}
 
-	if newSlot.Summary != "FREE" {
-		return fmt.Errorf("slot already reserved")
+	created, err := service.Events.Insert(config.EvaluationsCalendarID, slot).Do()
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusConflict {
+		return nil, ErrSlotExists
 	}
 
-	oldSlot, _ := CalendarTeamSlot(teamName)
-
-	newSlot = &calendar.Event{
-		Summary: teamName,
-		ColorId: "5",
-	}
-	if _, err := service.Events.Patch(config.EvaluationsCalendarID, slotID, newSlot).Do(); err != nil {
-		return err
-	}
+	return created, err
+}
 
-	if oldSlot != nil {
-		oldSlotID := oldSlot.Id
-		oldSlot = &calendar.Event{
-			Summary: "FREE",
-			ColorId: "0",
-		}
-		_, err = service.Events.Patch(config.EvaluationsCalendarID, oldSlotID, oldSlot).Do()
+// CalendarDeleteSlot func
+func CalendarDeleteSlot(slotID string) error {
+	service, err := calendarService()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return service.Events.Delete(config.EvaluationsCalendarID, slotID).Do()
 }
@@ -35,6 +35,21 @@ func driveService() (*drive.Service, error) {
 	return _driveService, nil
 }
 
+// DriveTeamFolder func
+func DriveTeamFolder(userData map[string]string) (string, error) {
+	service, err := driveService()
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := driveTeamFolder(service, userData)
+	if err != nil {
+		return "", err
+	}
+
+	return shareURL(folder), nil
+}
+
 // DriveSubmit func
 func DriveSubmit(userData map[string]string, file io.Reader, fileName string) (string, error) {
 	service, err := driveService()
@@ -42,13 +57,103 @@ func DriveSubmit(userData map[string]string, file io.Reader, fileName string) (s
 		return "", err
 	}
 
-	var descriptionBuffer bytes.Buffer
-	template.Must(template.New("").Parse(config.SubmissionsMetaDescription)).Execute(&descriptionBuffer, userData)
-	description := descriptionBuffer.String()
+	folder, err := driveTeamFolder(service, userData)
+	if err != nil {
+		return "", err
+	}
+
+	uniqueFileName := time.Now().Format("20060102150405")
+	fileExt := filepath.Ext(fileName)
+	if fileExt != "" {
+		uniqueFileName += fileExt
+	}
+	fileMeta := &drive.File{
+		Name:        fmt.Sprintf("%s-%s", strings.Replace(userData["Team"], " ", "_", -1), uniqueFileName),
+		Description: fmt.Sprintf("Original Filename:\n- %s\n\n%s", filepath.Base(fileName), driveDescription(userData)),
+		Parents:     []string{folder.Id},
+	}
+
+	_, err = service.Files.Create(fileMeta).Media(file, googleapi.ChunkSize(googleapi.MinUploadChunkSize)).Do()
+	if err != nil {
+		return "", err
+	}
+
+	return shareURL(folder), nil
+}
+
+// DriveTeamSubmissions func
+func DriveTeamSubmissions(folderID string) ([]map[string]string, error) {
+	service, err := driveService()
+	if err != nil {
+		return nil, err
+	}
+
+	submissions := []map[string]string{}
+	pageToken := ""
+	for {
+		folders, err := service.Files.
+			List().
+			Fields("nextPageToken,files(id,name)").
+			PageToken(pageToken).
+			Q(fmt.Sprintf("mimeType = 'application/vnd.google-apps.folder' and '%s' in parents and trashed = false", folderID)).
+			Do()
+		if err != nil {
+			return nil, err
+		}
 
+		for _, folder := range folders.Files {
+			files, err := service.Files.
+				List().
+				Fields("files(id,name,createdTime)").
+				PageSize(1).
+				OrderBy("createdTime desc").
+				Q(fmt.Sprintf("mimeType != 'application/vnd.google-apps.folder' and '%s' in parents and trashed = false", folder.Id)).
+				Do()
+			if err != nil {
+				return nil, err
+			}
+			if len(files.Files) == 0 {
+				continue
+			}
+
+			submissions = append(submissions, map[string]string{
+				"Team":        folder.Name,
+				"ID":          files.Files[0].Id,
+				"Name":        files.Files[0].Name,
+				"CreatedTime": files.Files[0].CreatedTime,
+			})
+		}
+
+		if folders.NextPageToken == "" {
+			break
+		}
+		pageToken = folders.NextPageToken
+	}
+
+	return submissions, nil
+}
+
+// DriveDownload func
+func DriveDownload(fileID string, w io.Writer) error {
+	service, err := driveService()
+	if err != nil {
+		return err
+	}
+
+	response, err := service.Files.Get(fileID).Download()
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+func driveTeamFolder(service *drive.Service, userData map[string]string) (*drive.File, error) {
 	folderMeta := &drive.File{
 		Name:        userData["Team"],
-		Description: description,
+		Description: driveDescription(userData),
 		MimeType:    "application/vnd.google-apps.folder",
 		Parents:     []string{config.SubmissionsFolderID},
 	}
@@ -61,45 +166,36 @@ func DriveSubmit(userData map[string]string, file io.Reader, fileName string) (s
 			folderMeta.MimeType, folderMeta.Name, folderMeta.Parents[0])).
 		Do()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	folderFound := len(fileList.Files) == 1
 
-	if !folderFound {
-		folder, err := service.Files.Create(folderMeta).Fields("id,name,webViewLink").Do()
-		if err != nil {
-			return "", err
-		}
-
-		if _, err = service.Permissions.Create(folder.Id, &drive.Permission{Role: "reader", Type: "anyone"}).Do(); err != nil {
-			return "", err
-		}
-
-		fileList.Files = append(fileList.Files, folder)
+	if len(fileList.Files) == 1 {
+		return fileList.Files[0], nil
 	}
 
-	folder := fileList.Files[0]
-
-	uniqueFileName := time.Now().Format("20060102150405")
-	fileExt := filepath.Ext(fileName)
-	if fileExt != "" {
-		uniqueFileName += fileExt
-	}
-	fileMeta := &drive.File{
-		Name:        fmt.Sprintf("%s-%s", strings.Replace(userData["Team"], " ", "_", -1), uniqueFileName),
-		Description: fmt.Sprintf("Original Filename:\n- %s\n\n%s", filepath.Base(fileName), description),
-		Parents:     []string{folder.Id},
+	folder, err := service.Files.Create(folderMeta).Fields("id,name,webViewLink").Do()
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = service.Files.Create(fileMeta).Media(file, googleapi.ChunkSize(googleapi.MinUploadChunkSize)).Do()
-	if err != nil {
-		return "", err
+	if _, err = service.Permissions.Create(folder.Id, &drive.Permission{Role: "reader", Type: "anyone"}).Do(); err != nil {
+		return nil, err
 	}
 
+	return folder, nil
+}
+
+func driveDescription(userData map[string]string) string {
+	var descriptionBuffer bytes.Buffer
+	template.Must(template.New("").Parse(config.SubmissionsMetaDescription)).Execute(&descriptionBuffer, userData)
+	return descriptionBuffer.String()
+}
+
+func shareURL(folder *drive.File) string {
 	shareURL, _ := url.Parse(folder.WebViewLink)
 	shareURLQuery := shareURL.Query()
 	shareURLQuery.Add("hl", "en")
 	shareURLQuery.Del("usp")
 	shareURL.RawQuery = shareURLQuery.Encode()
-	return shareURL.String(), nil
+	return shareURL.String()
 }
@@ -11,7 +11,7 @@ import (
 
 const (
 	studentsCellRange = "'Students'!A:F"
-	proposalCellRange = "'Proposals'!A:H"
+	proposalCellRange = "'Proposals'!A:Z"
 	gradesCellRange   = "'Grades'!A:Z"
 )
 
@@ -56,6 +56,36 @@ func SheetsSubmit(teamName string, url string) error {
 	return nil
 }
 
+// SheetsSubmissions returns the URL submitted by every team, keyed by team
+// name, from the column SheetsSubmit writes to.
+func SheetsSubmissions() (map[string]string, error) {
+	service, err := SheetsService()
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.LastIndex(config.EvaluationsCellRange, "!")
+	column := strings.TrimSuffix(config.EvaluationsCellRange[i+1:], "%d")
+	cellRange := config.EvaluationsCellRange[:i+1] + column + "1:" + column
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, cellRange).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := map[string]string{}
+	for i, valueRow := range valueRange.Values {
+		if len(valueRow) == 0 {
+			continue
+		}
+		if url := strings.TrimSpace(fmt.Sprintf("%v", valueRow[0])); url != "" {
+			urls[util.FormatTeamName(i+1)] = url
+		}
+	}
+
+	return urls, nil
+}
+
 // SheetsUserInfoBy func
 func SheetsUserInfoBy(field, identifier string) (map[string]string, error) {
 	service, err := SheetsService()
@@ -86,6 +116,38 @@ func SheetsUserInfoBy(field, identifier string) (map[string]string, error) {
 	return nil, fmt.Errorf("Couldn't find %s: %s", field, identifier)
 }
 
+// SheetsStudents func
+func SheetsStudents() ([]map[string]string, error) {
+	service, err := SheetsService()
+	if err != nil {
+		return nil, err
+	}
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, studentsCellRange).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	students := []map[string]string{}
+	for i, valueRow := range valueRange.Values {
+		if i == 0 || len(valueRow) < 6 {
+			continue
+		}
+
+		students = append(students, map[string]string{
+			"ID":        valueRow[0].(string),
+			"UserName":  strings.SplitN(valueRow[5].(string), "@", 2)[0],
+			"FullName":  valueRow[1].(string),
+			"Email":     valueRow[5].(string),
+			"Group":     valueRow[2].(string),
+			"Team":      util.FormatTeamName(valueRow[3]),
+			"TeamGroup": valueRow[4].(string),
+		})
+	}
+
+	return students, nil
+}
+
 // SheetsTeamMembers func
 func SheetsTeamMembers(teamName string) ([]map[string]string, error) {
 	service, err := SheetsService()
@@ -155,6 +217,104 @@ func SheetsGrades(userID string) ([]string, []string, error) {
 	return methods, nil, fmt.Errorf("Couldn't find %s", userID)
 }
 
+// SheetsAllGrades func
+func SheetsAllGrades() ([]string, map[string][]string, error) {
+	service, err := SheetsService()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, gradesCellRange).Do()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var methods []string
+	marks := map[string][]string{}
+	for i, valueRow := range valueRange.Values {
+		if len(valueRow) < 4 {
+			continue
+		}
+
+		var values []string
+		for _, valueCol := range valueRow[4:] {
+			values = append(values, fmt.Sprintf("%v", valueCol))
+		}
+
+		if i == 0 {
+			methods = values
+		} else {
+			marks[fmt.Sprintf("%v", valueRow[0])] = values
+		}
+	}
+
+	return methods, marks, nil
+}
+
+// SheetsGradeMethods func
+func SheetsGradeMethods() ([]string, error) {
+	service, err := SheetsService()
+	if err != nil {
+		return nil, err
+	}
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, "'Grades'!1:1").Do()
+	if err != nil {
+		return nil, err
+	}
+	if len(valueRange.Values) == 0 || len(valueRange.Values[0]) < 4 {
+		return nil, nil
+	}
+
+	var methods []string
+	for _, valueCol := range valueRange.Values[0][4:] {
+		methods = append(methods, valueCol.(string))
+	}
+
+	return methods, nil
+}
+
+// SheetsSetGrade func
+func SheetsSetGrade(userID, method, mark string) error {
+	service, err := SheetsService()
+	if err != nil {
+		return err
+	}
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, gradesCellRange).Do()
+	if err != nil {
+		return err
+	}
+	if len(valueRange.Values) == 0 {
+		return fmt.Errorf("Couldn't find %s", method)
+	}
+
+	col := -1
+	for i, valueCol := range valueRange.Values[0] {
+		if i >= 4 && valueCol == method {
+			col = i
+		}
+	}
+	if col == -1 {
+		return fmt.Errorf("Couldn't find %s", method)
+	}
+
+	for i, valueRow := range valueRange.Values {
+		if i == 0 || len(valueRow) == 0 || valueRow[0] != userID {
+			continue
+		}
+
+		cellRange := fmt.Sprintf("'Grades'!%s%d", sheetsColumn(col), i+1)
+		valueRange := &sheets.ValueRange{
+			Values: [][]interface{}{[]interface{}{mark}},
+		}
+		_, err = service.Spreadsheets.Values.Update(config.StudentsSheetID, cellRange, valueRange).ValueInputOption("USER_ENTERED").Do()
+		return err
+	}
+
+	return fmt.Errorf("Couldn't find %s", userID)
+}
+
 // SheetsTeamProposal func
 func SheetsTeamProposal(teamName string) (map[string]interface{}, error) {
 	service, err := SheetsService()
@@ -202,3 +362,77 @@ func SheetsTeamProposal(teamName string) (map[string]interface{}, error) {
 
 	return nil, fmt.Errorf("Couldn't find %s", teamName)
 }
+
+// SheetsProposalQuestions func
+func SheetsProposalQuestions() ([]string, error) {
+	service, err := SheetsService()
+	if err != nil {
+		return nil, err
+	}
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, "'Proposals'!1:1").Do()
+	if err != nil {
+		return nil, err
+	}
+	if len(valueRange.Values) == 0 || len(valueRange.Values[0]) < 4 {
+		return nil, nil
+	}
+
+	header := valueRange.Values[0]
+	var questions []string
+	for _, valueCol := range header[1 : len(header)-3] {
+		questions = append(questions, valueCol.(string))
+	}
+
+	return questions, nil
+}
+
+// SheetsSetProposal writes the answers of a team's proposal to its row in the
+// proposals sheet, keeping the notes already there.
+func SheetsSetProposal(teamName string, answers []string, late, approved string) error {
+	service, err := SheetsService()
+	if err != nil {
+		return err
+	}
+
+	valueRange, err := service.Spreadsheets.Values.Get(config.StudentsSheetID, proposalCellRange).Do()
+	if err != nil {
+		return err
+	}
+
+	teamID := util.TrimTeamName(teamName)
+	rowIndex := len(valueRange.Values)
+	var notes interface{} = ""
+	for i, valueRow := range valueRange.Values {
+		if i == 0 || len(valueRow) == 0 || util.TrimTeamName(valueRow[0]) != teamID {
+			continue
+		}
+
+		rowIndex = i
+		if n := len(valueRow); n >= len(answers)+4 {
+			notes = valueRow[n-3]
+		}
+		break
+	}
+
+	row := []interface{}{teamName}
+	for _, answer := range answers {
+		row = append(row, answer)
+	}
+	row = append(row, notes, late, approved)
+
+	cellRange := fmt.Sprintf("'Proposals'!A%d:%s%d", rowIndex+1, sheetsColumn(len(row)-1), rowIndex+1)
+	_, err = service.Spreadsheets.Values.Update(config.StudentsSheetID, cellRange, &sheets.ValueRange{
+		Values: [][]interface{}{row},
+	}).ValueInputOption("RAW").Do()
+	return err
+}
+
+func sheetsColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+
+	return name
+}
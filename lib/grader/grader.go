@@ -0,0 +1,201 @@
+package grader
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/store"
+)
+
+// JobKind const
+const JobKind = "grading.run"
+
+// Statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusErrored = "errored"
+)
+
+const (
+	collection = "gradings"
+)
+
+// Submission struct
+type Submission struct {
+	ID         string
+	Team       string
+	Filename   string
+	Status     string
+	Passed     int
+	Failed     int
+	Log        string
+	QueuedAt   time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Archive    string
+}
+
+// Done func
+func (s *Submission) Done() bool {
+	return s.Status != StatusQueued && s.Status != StatusRunning
+}
+
+// Duration func
+func (s *Submission) Duration() time.Duration {
+	if s.StartedAt.IsZero() || s.FinishedAt.IsZero() {
+		return 0
+	}
+
+	return s.FinishedAt.Sub(s.StartedAt).Round(time.Second)
+}
+
+// Enqueue func
+func Enqueue(team string, file io.Reader, filename string) (*Submission, error) {
+	if config.GradingCommand == "" {
+		return nil, fmt.Errorf("Grading command not configured")
+	}
+
+	hasher := md5.New()
+	hasher.Write([]byte(team + filename + strconv.FormatInt(time.Now().UnixNano(), 10)))
+	id := hex.EncodeToString(hasher.Sum(nil))
+
+	archivePath := filepath.Join(workDir(), fmt.Sprintf("%s-%s", id, filepath.Base(filename)))
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, file)
+	f.Close()
+	if err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+
+	s := &Submission{
+		ID:       id,
+		Team:     team,
+		Filename: filepath.Base(filename),
+		Status:   StatusQueued,
+		QueuedAt: time.Now(),
+		Archive:  archivePath,
+	}
+
+	if err := store.Put(collection, id, s); err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+
+	if _, err := jobs.Enqueue(JobKind, map[string]string{"ID": id}); err != nil {
+		store.Delete(collection, id)
+		os.Remove(archivePath)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Find func
+func Find(id string) *Submission {
+	s := &Submission{}
+	if found, err := store.Get(collection, id, s); err != nil || !found {
+		return nil
+	}
+
+	return s
+}
+
+// All func
+func All() []*Submission {
+	return filter(func(*Submission) bool { return true })
+}
+
+// TeamSubmissions func
+func TeamSubmissions(team string) []*Submission {
+	return filter(func(s *Submission) bool { return s.Team == team })
+}
+
+// Process func
+func Process(args map[string]string) error {
+	s := Find(args["ID"])
+	if s == nil {
+		return fmt.Errorf("Couldn't find submission %s", args["ID"])
+	}
+	if s.Done() {
+		return nil
+	}
+
+	err := update(s.ID, func(s *Submission) {
+		s.Status = StatusRunning
+		s.StartedAt = time.Now()
+	})
+	if err != nil {
+		return err
+	}
+
+	result := Run(s.Archive)
+
+	err = update(s.ID, func(s *Submission) {
+		s.Status = result.Status
+		s.Passed = result.Passed
+		s.Failed = result.Failed
+		s.Log = result.Log
+		s.FinishedAt = time.Now()
+	})
+	if err != nil {
+		return err
+	}
+
+	os.Remove(s.Archive)
+	return nil
+}
+
+func filter(fn func(*Submission) bool) []*Submission {
+	all := map[string]*Submission{}
+	store.All(collection, &all)
+
+	result := []*Submission{}
+	for _, s := range all {
+		if fn(s) {
+			result = append(result, s)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].QueuedAt.After(result[j].QueuedAt)
+	})
+
+	return result
+}
+
+func update(id string, fn func(*Submission)) error {
+	s := &Submission{}
+	return store.Update(collection, id, s, func(found bool) error {
+		if !found {
+			return fmt.Errorf("Couldn't find submission %s", id)
+		}
+
+		fn(s)
+		return nil
+	})
+}
+
+func workDir() string {
+	if config.GradingWorkDir != "" {
+		os.MkdirAll(config.GradingWorkDir, 0700)
+		return config.GradingWorkDir
+	}
+
+	return os.TempDir()
+}
@@ -0,0 +1,111 @@
+package grader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/store"
+)
+
+func setup(t *testing.T) string {
+	root := t.TempDir()
+	if err := store.Open(filepath.Join(root, "store")); err != nil {
+		t.Fatal(err)
+	}
+
+	oldCommand, oldWorkDir := config.GradingCommand, config.GradingWorkDir
+	t.Cleanup(func() {
+		config.GradingCommand, config.GradingWorkDir = oldCommand, oldWorkDir
+	})
+
+	config.GradingCommand = "go test ./..."
+	config.GradingWorkDir = filepath.Join(root, "work")
+
+	return config.GradingWorkDir
+}
+
+func workFiles(t *testing.T, dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestEnqueue(t *testing.T) {
+	dir := setup(t)
+
+	s, err := Enqueue("Team 01", strings.NewReader("archive"), "uploads/project.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Status != StatusQueued || s.Team != "Team 01" || s.Filename != "project.zip" {
+		t.Errorf("Enqueue() = %+v", s)
+	}
+	if got := Find(s.ID); got == nil || got.Archive != s.Archive {
+		t.Errorf("Find(%q) = %+v, want the queued submission", s.ID, got)
+	}
+
+	b, err := ioutil.ReadFile(s.Archive)
+	if err != nil || string(b) != "archive" {
+		t.Errorf("archive = %q, %v, want the uploaded content", b, err)
+	}
+	if filepath.Dir(s.Archive) != dir {
+		t.Errorf("archive spooled to %s, want %s", filepath.Dir(s.Archive), dir)
+	}
+}
+
+func TestEnqueueFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+	}{
+		{
+			name:  "no command",
+			setup: func(t *testing.T) { config.GradingCommand = "" },
+		},
+		{
+			name: "job not queued",
+			setup: func(t *testing.T) {
+				// A directory where the jobs log should be makes every write
+				// to the jobs collection fail.
+				jobsDir := t.TempDir()
+				if err := os.Mkdir(filepath.Join(jobsDir, "jobs.log"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Open(jobsDir); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setup(t)
+			tt.setup(t)
+
+			if _, err := Enqueue("Team 01", strings.NewReader("archive"), "project.zip"); err == nil {
+				t.Fatal("Enqueue() succeeded, want an error")
+			}
+
+			if files := workFiles(t, dir); len(files) != 0 {
+				t.Errorf("work dir has %v left, want it empty", files)
+			}
+			if all := All(); len(all) != 0 {
+				t.Errorf("All() = %d submissions, want none left", len(all))
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package grader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/archive"
+)
+
+const (
+	maxLogSize = 64 * 1024
+)
+
+// Result struct
+type Result struct {
+	Status string
+	Passed int
+	Failed int
+	Log    string
+}
+
+// Run func
+func Run(archivePath string) *Result {
+	dir, err := ioutil.TempDir(workDir(), "grading-")
+	if err != nil {
+		return errored(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := archive.Extract(archivePath, dir); err != nil {
+		return errored(err)
+	}
+
+	timeout, err := time.ParseDuration(config.GradingTimeout)
+	if err != nil {
+		timeout = 5 * time.Minute
+	}
+
+	cmd, err := sandboxed(dir, timeout)
+	if err != nil {
+		return errored(err)
+	}
+
+	output := &limitedBuffer{limit: maxLogSize}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return errored(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var timedOut bool
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		timedOut = true
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		err = <-done
+	}
+
+	log := output.String()
+	result := &Result{
+		Passed: countMatches(config.GradingPassPattern, log),
+		Failed: countMatches(config.GradingFailPattern, log),
+		Log:    log,
+	}
+
+	switch {
+	case timedOut:
+		result.Status = StatusErrored
+		result.Log += fmt.Sprintf("\n\nTimed out after %v", timeout)
+	case err != nil:
+		result.Status = StatusFailed
+		result.Log += fmt.Sprintf("\n\n%v", err)
+	case result.Failed > 0:
+		result.Status = StatusFailed
+	default:
+		result.Status = StatusPassed
+	}
+
+	return result
+}
+
+// sandboxed returns the command that grades the submission extracted in dir.
+// Under nsjail it runs with no network, in its own user, PID and mount
+// namespaces, seeing only GradingSandboxMounts read-only and the submission.
+// "unsafe" runs it as the server user with only ulimits, and is meant for
+// trusted submissions.
+func sandboxed(dir string, timeout time.Duration) (*exec.Cmd, error) {
+	root := archive.Root(dir)
+
+	switch config.GradingSandbox {
+	case "nsjail":
+		work, err := filepath.Rel(dir, root)
+		if err != nil {
+			return nil, err
+		}
+
+		args := []string{
+			"--mode", "o",
+			"--quiet",
+			"--user", "65534",
+			"--group", "65534",
+			"--hostname", "grading",
+			"--time_limit", fmt.Sprintf("%d", int(timeout.Seconds())+1),
+			"--rlimit_cpu", fmt.Sprintf("%d", config.GradingCPULimit),
+			"--rlimit_as", fmt.Sprintf("%d", config.GradingMemoryLimit),
+			"--bindmount", dir + ":/work",
+			"--tmpfsmount", "/tmp",
+			"--cwd", filepath.Join("/work", work),
+			"--env", "PATH=/usr/local/bin:/usr/bin:/bin",
+			"--env", "HOME=/tmp",
+			"--env", "TMPDIR=/tmp",
+		}
+		for _, mount := range config.GradingSandboxMounts {
+			args = append(args, "--bindmount_ro", mount)
+		}
+		args = append(args, "--", "/bin/sh", "-c", config.GradingCommand)
+
+		return exec.Command(config.GradingSandboxPath, args...), nil
+	case "unsafe":
+		script := fmt.Sprintf("ulimit -t %d; ulimit -v %d; %s",
+			config.GradingCPULimit, config.GradingMemoryLimit*1024, config.GradingCommand)
+
+		cmd := exec.Command("/bin/sh", "-c", script)
+		cmd.Dir = root
+		cmd.Env = []string{
+			"PATH=" + os.Getenv("PATH"),
+			"HOME=" + dir,
+			"TMPDIR=" + dir,
+		}
+
+		return cmd, nil
+	}
+
+	return nil, fmt.Errorf("Unknown grading sandbox: %q", config.GradingSandbox)
+}
+
+func errored(err error) *Result {
+	return &Result{
+		Status: StatusErrored,
+		Log:    err.Error(),
+	}
+}
+
+func countMatches(pattern, s string) int {
+	if pattern == "" {
+		return 0
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0
+	}
+
+	return len(re.FindAllStringIndex(s, -1))
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.limit - b.Len(); remaining < len(p) {
+		if remaining > 0 {
+			b.Buffer.Write(p[:remaining])
+		}
+		b.truncated = true
+		return n, nil
+	}
+
+	return b.Buffer.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.Buffer.String() + "\n\n[output truncated]"
+	}
+
+	return b.Buffer.String()
+}
@@ -0,0 +1,230 @@
+package grades
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TypeNumeric const
+	TypeNumeric = "numeric"
+	// TypeLetter const
+	TypeLetter = "letter"
+	// TypePassFail const
+	TypePassFail = "passfail"
+)
+
+// Component struct
+type Component struct {
+	Method   string
+	Type     string
+	Category string
+	Max      float64
+	Weight   float64
+}
+
+// Category struct
+type Category struct {
+	Name       string
+	Weight     float64
+	DropLowest int
+	Cap        float64
+}
+
+// Letter struct
+type Letter struct {
+	Letter string
+	Min    float64
+}
+
+// Formula struct
+type Formula struct {
+	Components []*Component
+	Categories []*Category
+	Scale      []*Letter
+	Cap        float64
+}
+
+// Result struct
+type Result struct {
+	Total      float64
+	Graded     float64
+	Letter     string
+	Categories []*CategoryResult
+}
+
+// CategoryResult struct
+type CategoryResult struct {
+	Name    string
+	Weight  float64
+	Score   float64
+	Graded  bool
+	Dropped []string
+}
+
+// Apply computes the weighted total, as a percentage, of the given marks
+// keyed by method. Marks that are missing or can't be read count as not
+// graded yet and are left out rather than counted as zero: the total and the
+// letter are over the graded part of the course, and Graded says how much of
+// the course that is.
+func (f *Formula) Apply(marks map[string]string) *Result {
+	result := &Result{}
+
+	for _, category := range f.categories() {
+		type score struct {
+			method string
+			value  float64
+			weight float64
+		}
+
+		scores := []*score{}
+		for _, component := range f.Components {
+			if f.categoryOf(component) != category.Name {
+				continue
+			}
+
+			if value, ok := f.fraction(component, marks[component.Method]); ok {
+				scores = append(scores, &score{component.Method, value, weightOr1(component.Weight)})
+			}
+		}
+
+		categoryResult := &CategoryResult{Name: category.Name, Weight: category.Weight}
+		result.Categories = append(result.Categories, categoryResult)
+
+		if category.DropLowest > 0 && len(scores) > category.DropLowest {
+			sort.SliceStable(scores, func(i, j int) bool {
+				return scores[i].value < scores[j].value
+			})
+			for _, s := range scores[:category.DropLowest] {
+				categoryResult.Dropped = append(categoryResult.Dropped, s.method)
+			}
+			scores = scores[category.DropLowest:]
+		}
+
+		if len(scores) == 0 {
+			continue
+		}
+
+		sum, weights := 0.0, 0.0
+		for _, s := range scores {
+			sum += s.value * s.weight
+			weights += s.weight
+		}
+
+		categoryResult.Graded = true
+		categoryResult.Score = sum / weights
+		if category.Cap > 0 && categoryResult.Score > category.Cap/100 {
+			categoryResult.Score = category.Cap / 100
+		}
+
+		result.Total += categoryResult.Score * category.Weight
+		result.Graded += category.Weight
+	}
+
+	if result.Graded > 0 {
+		result.Total = 100 * result.Total / result.Graded
+	}
+	if weights := f.totalWeight(); weights > 0 {
+		result.Graded = 100 * result.Graded / weights
+	}
+	if f.Cap > 0 && result.Total > f.Cap {
+		result.Total = f.Cap
+	}
+	result.Letter = f.Letter(result.Total)
+
+	return result
+}
+
+// Letter func
+func (f *Formula) Letter(percent float64) string {
+	best := ""
+	bestMin := -1.0
+	for _, letter := range f.Scale {
+		if percent >= letter.Min && letter.Min > bestMin {
+			best = letter.Letter
+			bestMin = letter.Min
+		}
+	}
+
+	return best
+}
+
+func (f *Formula) fraction(component *Component, mark string) (float64, bool) {
+	mark = strings.TrimSpace(mark)
+	if mark == "" {
+		return 0, false
+	}
+
+	switch component.Type {
+	case TypeLetter:
+		for _, letter := range f.Scale {
+			if strings.EqualFold(letter.Letter, mark) {
+				return letter.Min / 100, true
+			}
+		}
+		return 0, false
+	case TypePassFail:
+		switch strings.ToLower(mark) {
+		case "pass", "p", "yes", "y", "1", "true":
+			return 1, true
+		case "fail", "f", "no", "n", "0", "false":
+			return 0, true
+		}
+		return 0, false
+	default:
+		value, err := strconv.ParseFloat(mark, 64)
+		if err != nil || component.Max <= 0 {
+			return 0, false
+		}
+		return value / component.Max, true
+	}
+}
+
+// categories returns the configured categories, plus one for every component
+// that isn't part of any, weighted by the component itself.
+func (f *Formula) categories() []*Category {
+	categories := append([]*Category{}, f.Categories...)
+	for _, component := range f.Components {
+		if component.Category == "" || f.category(component.Category) == nil {
+			categories = append(categories, &Category{Name: component.Method, Weight: component.Weight})
+		}
+	}
+
+	return categories
+}
+
+func (f *Formula) category(name string) *Category {
+	for _, category := range f.Categories {
+		if category.Name == name {
+			return category
+		}
+	}
+
+	return nil
+}
+
+func (f *Formula) categoryOf(component *Component) string {
+	if component.Category != "" && f.category(component.Category) != nil {
+		return component.Category
+	}
+
+	return component.Method
+}
+
+func (f *Formula) totalWeight() float64 {
+	total := 0.0
+	for _, category := range f.categories() {
+		total += category.Weight
+	}
+
+	return total
+}
+
+func weightOr1(weight float64) float64 {
+	if weight <= 0 {
+		return 1
+	}
+
+	return weight
+}
@@ -0,0 +1,149 @@
+package grades
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func testFormula() *Formula {
+	return &Formula{
+		Components: []*Component{
+			{Method: "Quiz 1", Category: "Quizzes", Max: 10},
+			{Method: "Quiz 2", Category: "Quizzes", Max: 10},
+			{Method: "Quiz 3", Category: "Quizzes", Max: 10},
+			{Method: "Project", Max: 100, Weight: 40},
+			{Method: "Final", Type: TypeLetter, Weight: 30},
+			{Method: "Attendance", Type: TypePassFail},
+		},
+		Categories: []*Category{
+			{Name: "Quizzes", Weight: 30, DropLowest: 1},
+		},
+		Scale: []*Letter{
+			{Letter: "A", Min: 90},
+			{Letter: "B", Min: 80},
+			{Letter: "C", Min: 70},
+			{Letter: "F", Min: 0},
+		},
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestApplyOverGradedPart(t *testing.T) {
+	f := &Formula{
+		Components: []*Component{
+			{Method: "Midterm", Max: 10, Weight: 50},
+			{Method: "Final", Max: 10, Weight: 50},
+		},
+		Scale: []*Letter{{Letter: "A", Min: 90}, {Letter: "F", Min: 0}},
+	}
+
+	result := f.Apply(map[string]string{"Midterm": "10"})
+	if !near(result.Total, 100) || !near(result.Graded, 50) || result.Letter != "A" {
+		t.Errorf("got total %v, graded %v, letter %q; want 100, 50, A", result.Total, result.Graded, result.Letter)
+	}
+}
+
+func TestApplyNothingGraded(t *testing.T) {
+	result := testFormula().Apply(map[string]string{"Quiz 1": "", "Project": "n/a"})
+	if result.Total != 0 || result.Graded != 0 {
+		t.Errorf("got total %v, graded %v; want 0, 0", result.Total, result.Graded)
+	}
+}
+
+func TestApplyFullCourse(t *testing.T) {
+	result := testFormula().Apply(map[string]string{
+		"Quiz 1":     "4",
+		"Quiz 2":     "8",
+		"Quiz 3":     "10",
+		"Project":    "75",
+		"Final":      "B",
+		"Attendance": "pass",
+	})
+
+	// Quizzes drop the 4 and average 90%, weighing 30; the project is 75%
+	// of 40, the final 80% of 30 and attendance 100% of the default 0.
+	want := 100 * (0.9*30 + 0.75*40 + 0.8*30) / 100
+	if !near(result.Total, want) || !near(result.Graded, 100) {
+		t.Errorf("got total %v, graded %v; want %v, 100", result.Total, result.Graded, want)
+	}
+	if result.Letter != "B" {
+		t.Errorf("got letter %q, want B", result.Letter)
+	}
+
+	quizzes := result.Categories[0]
+	if quizzes.Name != "Quizzes" || !near(quizzes.Score, 0.9) || strings.Join(quizzes.Dropped, ",") != "Quiz 1" {
+		t.Errorf("got quizzes %+v", quizzes)
+	}
+}
+
+func TestApplyDropLowestNeedsMoreMarks(t *testing.T) {
+	result := testFormula().Apply(map[string]string{"Quiz 2": "5"})
+
+	quizzes := result.Categories[0]
+	if len(quizzes.Dropped) != 0 || !near(quizzes.Score, 0.5) {
+		t.Errorf("a single quiz mark was dropped: %+v", quizzes)
+	}
+	if !near(result.Total, 50) || !near(result.Graded, 30) {
+		t.Errorf("got total %v, graded %v; want 50, 30", result.Total, result.Graded)
+	}
+}
+
+func TestApplyCaps(t *testing.T) {
+	f := &Formula{
+		Components: []*Component{
+			{Method: "Lab", Category: "Labs", Max: 10},
+			{Method: "Bonus", Max: 10, Weight: 50},
+		},
+		Categories: []*Category{{Name: "Labs", Weight: 50, Cap: 80}},
+		Cap:        85,
+	}
+
+	result := f.Apply(map[string]string{"Lab": "10", "Bonus": "10"})
+	if !near(result.Categories[0].Score, 0.8) {
+		t.Errorf("category cap: got %v, want 0.8", result.Categories[0].Score)
+	}
+	if !near(result.Total, 85) {
+		t.Errorf("total cap: got %v, want 85", result.Total)
+	}
+}
+
+func TestFractionTypes(t *testing.T) {
+	f := testFormula()
+	for _, tc := range []struct {
+		component *Component
+		mark      string
+		want      float64
+		ok        bool
+	}{
+		{&Component{Max: 20}, " 15 ", 0.75, true},
+		{&Component{Max: 0}, "15", 0, false},
+		{&Component{Max: 20}, "absent", 0, false},
+		{&Component{Type: TypeLetter}, "a", 0.9, true},
+		{&Component{Type: TypeLetter}, "Z", 0, false},
+		{&Component{Type: TypePassFail}, "Yes", 1, true},
+		{&Component{Type: TypePassFail}, "F", 0, true},
+		{&Component{Type: TypePassFail}, "maybe", 0, false},
+	} {
+		got, ok := f.fraction(tc.component, tc.mark)
+		if ok != tc.ok || !near(got, tc.want) {
+			t.Errorf("fraction(%s, %q) = %v, %v; want %v, %v", tc.component.Type, tc.mark, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestLetter(t *testing.T) {
+	f := testFormula()
+	for percent, want := range map[float64]string{100: "A", 90: "A", 89.99: "B", 70: "C", 12: "F"} {
+		if got := f.Letter(percent); got != want {
+			t.Errorf("Letter(%v) = %q, want %q", percent, got, want)
+		}
+	}
+
+	if got := (&Formula{}).Letter(50); got != "" {
+		t.Errorf("Letter without a scale = %q, want none", got)
+	}
+}
@@ -0,0 +1,128 @@
+package grades
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stats struct
+type Stats struct {
+	Count     int
+	Mean      float64
+	Median    float64
+	StdDev    float64
+	Min       float64
+	Max       float64
+	Histogram []*Bucket
+	values    []float64
+}
+
+// Bucket struct
+type Bucket struct {
+	From    float64
+	To      float64
+	Count   int
+	Percent float64
+}
+
+// Parse func
+func Parse(marks []string) []float64 {
+	values := []float64{}
+	for _, mark := range marks {
+		if value, err := strconv.ParseFloat(strings.TrimSpace(mark), 64); err == nil {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Compute func
+func Compute(values []float64, buckets int) *Stats {
+	stats := &Stats{Count: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+
+	stats.values = append([]float64{}, values...)
+	sort.Float64s(stats.values)
+
+	sum := 0.0
+	for _, value := range stats.values {
+		sum += value
+	}
+	stats.Mean = sum / float64(stats.Count)
+	stats.Min = stats.values[0]
+	stats.Max = stats.values[stats.Count-1]
+
+	if stats.Count%2 == 1 {
+		stats.Median = stats.values[stats.Count/2]
+	} else {
+		stats.Median = (stats.values[stats.Count/2-1] + stats.values[stats.Count/2]) / 2
+	}
+
+	variance := 0.0
+	for _, value := range stats.values {
+		variance += (value - stats.Mean) * (value - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(stats.Count))
+
+	stats.Histogram = histogram(stats.values, buckets)
+
+	return stats
+}
+
+// Percentile returns the percentage of values that are at or below value.
+func (s *Stats) Percentile(value float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+
+	below := sort.Search(len(s.values), func(i int) bool {
+		return s.values[i] > value
+	})
+
+	return 100 * float64(below) / float64(s.Count)
+}
+
+func histogram(sorted []float64, buckets int) []*Bucket {
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	min, max := sorted[0], sorted[len(sorted)-1]
+	if min == max {
+		return []*Bucket{{From: min, To: max, Count: len(sorted), Percent: 100}}
+	}
+
+	width := (max - min) / float64(buckets)
+	histogram := make([]*Bucket, buckets)
+	for i := range histogram {
+		histogram[i] = &Bucket{
+			From: min + float64(i)*width,
+			To:   min + float64(i+1)*width,
+		}
+	}
+
+	for _, value := range sorted {
+		i := int((value - min) / width)
+		if i >= buckets {
+			i = buckets - 1
+		}
+		histogram[i].Count++
+	}
+
+	highest := 0
+	for _, bucket := range histogram {
+		if bucket.Count > highest {
+			highest = bucket.Count
+		}
+	}
+	for _, bucket := range histogram {
+		bucket.Percent = 100 * float64(bucket.Count) / float64(highest)
+	}
+
+	return histogram
+}
@@ -0,0 +1,71 @@
+package ical
+
+import (
+	"bytes"
+	"time"
+)
+
+// Calendar struct
+type Calendar struct {
+	Name   string
+	Method string
+	Events []*Event
+}
+
+// String func
+func (c *Calendar) String() string {
+	var b bytes.Buffer
+
+	write(&b, "BEGIN:VCALENDAR")
+	write(&b, "VERSION:2.0")
+	write(&b, "PRODID:-//submit//EN")
+	write(&b, "CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		write(&b, "METHOD:"+c.Method)
+	}
+	if c.Name != "" {
+		write(&b, "X-WR-CALNAME:"+escape(c.Name))
+	}
+
+	stamp := time.Now().UTC().Format(dateTimeUTCFormat)
+	for _, e := range c.Events {
+		write(&b, "BEGIN:VEVENT")
+		write(&b, "UID:"+e.UID)
+		write(&b, "DTSTAMP:"+stamp)
+		write(&b, "DTSTART:"+e.Start.UTC().Format(dateTimeUTCFormat))
+		write(&b, "DTEND:"+e.End.UTC().Format(dateTimeUTCFormat))
+		write(&b, "SUMMARY:"+escape(e.Summary))
+		if e.Location != "" {
+			write(&b, "LOCATION:"+escape(e.Location))
+		}
+		if e.Description != "" {
+			write(&b, "DESCRIPTION:"+escape(e.Description))
+		}
+
+		for _, line := range e.Raw {
+			write(&b, line)
+		}
+
+		write(&b, "END:VEVENT")
+	}
+
+	write(&b, "END:VCALENDAR")
+
+	return b.String()
+}
+
+func write(b *bytes.Buffer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && (line[cut]&0xC0) == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
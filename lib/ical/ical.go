@@ -0,0 +1,213 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	dateTimeFormat    = "20060102T150405"
+	dateTimeUTCFormat = "20060102T150405Z"
+	dateFormat        = "20060102"
+)
+
+// Event struct
+//
+// Raw holds the lines of the event that aren't one of the fields, verbatim
+// and unfolded: other properties with their parameters, repeated ones like
+// ATTENDEE, and nested components like VALARM. String writes them back as is,
+// so events edited in other clients survive a round trip.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	Raw         []string
+}
+
+// Parse func
+func Parse(data string) ([]*Event, error) {
+	events := []*Event{}
+
+	var event *Event
+	depth := 0
+	for _, line := range unfold(data) {
+		name, params, value := split(line)
+
+		switch {
+		case event == nil && name == "BEGIN" && value == "VEVENT":
+			event = &Event{}
+		case event == nil:
+		case depth == 0 && name == "END" && value == "VEVENT":
+			events = append(events, event)
+			event = nil
+		case name == "BEGIN":
+			depth++
+			event.Raw = append(event.Raw, line)
+		case name == "END":
+			depth--
+			event.Raw = append(event.Raw, line)
+		case depth > 0:
+			event.Raw = append(event.Raw, line)
+		case name == "DTSTAMP":
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescape(value)
+		case name == "LOCATION":
+			event.Location = unescape(value)
+		case name == "DESCRIPTION":
+			event.Description = unescape(value)
+		case name == "DTSTART", name == "DTEND":
+			t, err := parseTime(params, value)
+			if err != nil {
+				return nil, err
+			}
+			if name == "DTSTART" {
+				event.Start = t
+			} else {
+				event.End = t
+			}
+		default:
+			event.Raw = append(event.Raw, line)
+		}
+	}
+
+	return events, nil
+}
+
+// Property returns the unescaped value of the first top-level property of the
+// event with the given name.
+func (e *Event) Property(name string) (string, bool) {
+	depth := 0
+	for _, line := range e.Raw {
+		n, _, value := split(line)
+		switch {
+		case n == "BEGIN":
+			depth++
+		case n == "END":
+			depth--
+		case depth == 0 && n == name:
+			return unescape(value), true
+		}
+	}
+
+	return "", false
+}
+
+// SetProperty replaces the top-level property of the event with the given
+// name, or adds it, leaving every other line alone.
+func (e *Event) SetProperty(name, value string) {
+	line := name + ":" + escape(value)
+
+	raw := make([]string, 0, len(e.Raw)+1)
+	depth, set := 0, false
+	for _, l := range e.Raw {
+		n, _, _ := split(l)
+		switch {
+		case n == "BEGIN":
+			depth++
+		case n == "END":
+			depth--
+		case depth == 0 && n == name:
+			if !set {
+				raw = append(raw, line)
+				set = true
+			}
+			continue
+		}
+		raw = append(raw, l)
+	}
+	if !set {
+		raw = append(raw, line)
+	}
+
+	e.Raw = raw
+}
+
+// String func
+func (e *Event) String() string {
+	return (&Calendar{Events: []*Event{e}}).String()
+}
+
+func unfold(data string) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func split(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], "\"")
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+func parseTime(params map[string]string, value string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeUTCFormat, value)
+	}
+
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == len(dateFormat) {
+		return time.ParseInLocation(dateFormat, value, loc)
+	}
+
+	t, err := time.ParseInLocation(dateTimeFormat, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date-time: %s", value)
+	}
+	return t, nil
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+	).Replace(s)
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(
+		"\\\\", "\\",
+		"\\;", ";",
+		"\\,", ",",
+		"\\n", "\n",
+		"\\N", "\n",
+	).Replace(s)
+}
@@ -0,0 +1,106 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+)
+
+const edited = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:abc\r\n" +
+	"DTSTAMP:20260101T000000Z\r\n" +
+	"DTSTART:20260301T090000Z\r\n" +
+	"DTEND:20260301T100000Z\r\n" +
+	"SUMMARY:Team 1\\, Team 2\r\n" +
+	"DESCRIPTION:Bring laptops\r\n" +
+	"ATTENDEE;CN=\"Evaluator, One\";ROLE=REQ-PARTICIPANT:mailto:one@example.com\r\n" +
+	"ATTENDEE;CN=Evaluator Two:mailto:two@example.com\r\n" +
+	"EXDATE:20260308T090000Z\r\n" +
+	"EXDATE:20260315T090000Z\r\n" +
+	"X-SUBMIT-TEAMS:Team 1\\,Team 2\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"DESCRIPTION:Evaluation in 15 minutes\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseKeepsUnknownLinesVerbatim(t *testing.T) {
+	events, err := Parse(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+
+	e := events[0]
+	if e.Summary != "Team 1, Team 2" {
+		t.Errorf("Summary = %q", e.Summary)
+	}
+	if e.Description != "Bring laptops" {
+		t.Errorf("Description = %q, the VALARM's must not override it", e.Description)
+	}
+
+	out := e.String()
+	for _, line := range []string{
+		"ATTENDEE;CN=\"Evaluator, One\";ROLE=REQ-PARTICIPANT:mailto:one@example.com",
+		"ATTENDEE;CN=Evaluator Two:mailto:two@example.com",
+		"EXDATE:20260308T090000Z",
+		"EXDATE:20260315T090000Z",
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Evaluation in 15 minutes\r\nTRIGGER:-PT15M\r\nEND:VALARM",
+	} {
+		if !strings.Contains(unfoldString(out), line) {
+			t.Errorf("round trip lost %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	events, _ := Parse(edited)
+	e := events[0]
+
+	if teams, ok := e.Property("X-SUBMIT-TEAMS"); !ok || teams != "Team 1,Team 2" {
+		t.Errorf("Property = %q, %v", teams, ok)
+	}
+	if _, ok := e.Property("TRIGGER"); ok {
+		t.Error("Property found a line nested in VALARM")
+	}
+
+	e.SetProperty("X-SUBMIT-TEAMS", "Team 3")
+	e.SetProperty("X-SUBMIT-CAPACITY", "2")
+
+	again, err := Parse(e.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if teams, _ := again[0].Property("X-SUBMIT-TEAMS"); teams != "Team 3" {
+		t.Errorf("X-SUBMIT-TEAMS = %q after SetProperty", teams)
+	}
+	if capacity, _ := again[0].Property("X-SUBMIT-CAPACITY"); capacity != "2" {
+		t.Errorf("X-SUBMIT-CAPACITY = %q after SetProperty", capacity)
+	}
+	if n := strings.Count(e.String(), "X-SUBMIT-TEAMS"); n != 1 {
+		t.Errorf("X-SUBMIT-TEAMS written %d times", n)
+	}
+}
+
+func TestStringFoldsLongLines(t *testing.T) {
+	e := &Event{UID: "x", Raw: []string{"X-LONG:" + strings.Repeat("a", 200)}}
+	for _, line := range strings.Split(e.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+
+	events, _ := Parse(e.String())
+	if v, _ := events[0].Property("X-LONG"); v != strings.Repeat("a", 200) {
+		t.Errorf("folded property read back as %q", v)
+	}
+}
+
+func unfoldString(s string) string {
+	return strings.Join(unfold(s), "\r\n")
+}
@@ -0,0 +1,425 @@
+package jobs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	collection = "jobs"
+)
+
+// Statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+// Handler func
+type Handler func(args map[string]string) error
+
+type worker struct {
+	handler     Handler
+	concurrency int
+	running     int
+}
+
+var (
+	workers     = map[string]*worker{}
+	workersLock sync.Mutex
+
+	// pending holds the run time of every queued job, so the dispatcher
+	// doesn't have to read the whole collection to find the due ones.
+	pending     = map[string]time.Time{}
+	pendingLock sync.Mutex
+
+	wake      = make(chan struct{}, 1)
+	startOnce sync.Once
+
+	failureHandler = func(*Job, error) {}
+)
+
+// Job struct
+type Job struct {
+	ID          string
+	Kind        string
+	Args        map[string]string
+	Status      string
+	Attempts    int
+	MaxAttempts int
+	LastError   string
+	RunAt       time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Register func
+func Register(kind string, concurrency int, fn Handler) {
+	workersLock.Lock()
+	defer workersLock.Unlock()
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	workers[kind] = &worker{
+		handler:     fn,
+		concurrency: concurrency,
+	}
+}
+
+// OnFailure func
+func OnFailure(fn func(*Job, error)) {
+	failureHandler = fn
+}
+
+// Enqueue func
+func Enqueue(kind string, args map[string]string) (*Job, error) {
+	return EnqueueAt(kind, args, time.Now())
+}
+
+// EnqueueAt func
+func EnqueueAt(kind string, args map[string]string, runAt time.Time) (*Job, error) {
+	now := time.Now()
+
+	hasher := md5.New()
+	hasher.Write([]byte(kind + strconv.FormatInt(now.UnixNano(), 10) + strconv.FormatInt(rand.Int63(), 10)))
+
+	job := &Job{
+		ID:          hex.EncodeToString(hasher.Sum(nil)),
+		Kind:        kind,
+		Args:        args,
+		Status:      StatusQueued,
+		MaxAttempts: config.JobsMaxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := store.Put(collection, job.ID, job); err != nil {
+		return nil, err
+	}
+
+	schedule(job.ID, job.RunAt)
+	return job, nil
+}
+
+// Find func
+func Find(id string) (*Job, error) {
+	job := &Job{}
+	found, err := store.Get(collection, id, job)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("Couldn't find job %s", id)
+	}
+
+	return job, nil
+}
+
+// All func
+func All() ([]*Job, error) {
+	all := map[string]*Job{}
+	if err := store.All(collection, &all); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(all))
+	for _, job := range all {
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs, nil
+}
+
+// Retry func
+func Retry(id string) error {
+	job := &Job{}
+	err := store.Update(collection, id, job, func(found bool) error {
+		if !found {
+			return fmt.Errorf("Couldn't find job %s", id)
+		}
+		if job.Status != StatusDead {
+			return fmt.Errorf("Job %s is %s", id, job.Status)
+		}
+
+		job.Status = StatusQueued
+		job.Attempts = 0
+		job.RunAt = time.Now()
+		job.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	schedule(id, job.RunAt)
+	return nil
+}
+
+// Delete func
+func Delete(id string) error {
+	pendingLock.Lock()
+	delete(pending, id)
+	pendingLock.Unlock()
+
+	return store.Delete(collection, id)
+}
+
+// Start func
+//
+// Start requeues the jobs that were running when the process stopped, and
+// starts dispatching queued jobs to their registered handlers.
+func Start() error {
+	var err error
+	startOnce.Do(func() {
+		if err = requeue(); err != nil {
+			return
+		}
+
+		go loop()
+	})
+
+	return err
+}
+
+// requeue fills pending from the store, putting interrupted jobs back in
+// the queue.
+func requeue() error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range all {
+		switch job.Status {
+		case StatusRunning:
+			if job = update(job.ID, func(job *Job) { job.Status = StatusQueued }); job != nil {
+				schedule(job.ID, job.RunAt)
+			}
+		case StatusQueued:
+			schedule(job.ID, job.RunAt)
+		}
+	}
+
+	return nil
+}
+
+func loop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	sweep()
+	swept := time.Now()
+
+	for {
+		dispatch(time.Now())
+
+		if time.Since(swept) > time.Hour {
+			sweep()
+			swept = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func schedule(id string, runAt time.Time) {
+	pendingLock.Lock()
+	pending[id] = runAt
+	pendingLock.Unlock()
+
+	notify()
+}
+
+// due returns the IDs of the queued jobs whose time has come, oldest first.
+func due(now time.Time) []string {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+
+	ids := []string{}
+	for id, runAt := range pending {
+		if !runAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if a, b := pending[ids[i]], pending[ids[j]]; !a.Equal(b) {
+			return a.Before(b)
+		}
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+func dispatch(now time.Time) {
+	for _, id := range due(now) {
+		job, err := Find(id)
+		if err != nil || job.Status != StatusQueued {
+			pendingLock.Lock()
+			delete(pending, id)
+			pendingLock.Unlock()
+			continue
+		}
+
+		workersLock.Lock()
+		w, ok := workers[job.Kind]
+		if !ok || w.running >= w.concurrency {
+			workersLock.Unlock()
+			continue
+		}
+		w.running++
+		workersLock.Unlock()
+
+		pendingLock.Lock()
+		delete(pending, id)
+		pendingLock.Unlock()
+
+		update(job.ID, func(job *Job) {
+			job.Status = StatusRunning
+			job.Attempts++
+		})
+
+		go run(w, job.ID)
+	}
+}
+
+// sweep deletes the finished jobs older than config.JobsRetention.
+func sweep() {
+	retention, err := time.ParseDuration(config.JobsRetention)
+	if err != nil {
+		retention = 24 * time.Hour
+	}
+
+	all, err := All()
+	if err != nil {
+		return
+	}
+
+	for _, job := range all {
+		if job.Status == StatusDone && time.Since(job.UpdatedAt) > retention {
+			Delete(job.ID)
+		}
+	}
+}
+
+func run(w *worker, id string) {
+	defer func() {
+		workersLock.Lock()
+		w.running--
+		workersLock.Unlock()
+
+		notify()
+	}()
+
+	job, err := Find(id)
+	if err != nil {
+		return
+	}
+
+	if err = call(w.handler, job.Args); err == nil {
+		update(id, func(job *Job) {
+			job.Status = StatusDone
+			job.LastError = ""
+		})
+		return
+	}
+
+	job = update(id, func(job *Job) {
+		job.LastError = err.Error()
+		if job.MaxAttempts > 0 && job.Attempts >= job.MaxAttempts {
+			job.Status = StatusDead
+			return
+		}
+
+		job.Status = StatusQueued
+		job.RunAt = time.Now().Add(backoff(job.Attempts))
+	})
+
+	if job == nil {
+		return
+	}
+	if job.Status == StatusDead {
+		failureHandler(job, err)
+		return
+	}
+
+	schedule(job.ID, job.RunAt)
+}
+
+func call(fn Handler, args map[string]string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return fn(args)
+}
+
+func update(id string, fn func(*Job)) *Job {
+	job := &Job{}
+	err := store.Update(collection, id, job, func(found bool) error {
+		if !found {
+			return fmt.Errorf("Couldn't find job %s", id)
+		}
+
+		fn(job)
+		job.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+
+	return job
+}
+
+func backoff(attempts int) time.Duration {
+	base, err := time.ParseDuration(config.JobsBackoff)
+	if err != nil {
+		base = 5 * time.Second
+	}
+	max, err := time.ParseDuration(config.JobsMaxBackoff)
+	if err != nil {
+		max = 30 * time.Minute
+	}
+
+	d := base
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
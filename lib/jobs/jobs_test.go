@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/store"
+)
+
+func setup(t *testing.T) {
+	if err := store.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	pendingLock.Lock()
+	pending = map[string]time.Time{}
+	pendingLock.Unlock()
+
+	oldAttempts, oldBackoff, oldMax := config.JobsMaxAttempts, config.JobsBackoff, config.JobsMaxBackoff
+	t.Cleanup(func() {
+		config.JobsMaxAttempts, config.JobsBackoff, config.JobsMaxBackoff = oldAttempts, oldBackoff, oldMax
+	})
+}
+
+// drain dispatches due jobs until every job of the given IDs has settled in
+// one of the wanted statuses.
+func drain(t *testing.T, ids []string, statuses ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		dispatch(time.Now())
+
+		settled := 0
+		for _, id := range ids {
+			job, _ := Find(id)
+			for _, status := range statuses {
+				if job != nil && job.Status == status {
+					settled++
+				}
+			}
+		}
+		if settled == len(ids) {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("jobs didn't settle in %v", statuses)
+}
+
+func TestBackoff(t *testing.T) {
+	setup(t)
+	config.JobsBackoff, config.JobsMaxBackoff = "10s", "1m"
+
+	for _, tc := range []struct {
+		attempts int
+		min, max time.Duration
+	}{
+		{1, 5 * time.Second, 10 * time.Second},
+		{2, 10 * time.Second, 20 * time.Second},
+		{3, 20 * time.Second, 40 * time.Second},
+		{4, 30 * time.Second, time.Minute},
+		{10, 30 * time.Second, time.Minute},
+	} {
+		for i := 0; i < 20; i++ {
+			if d := backoff(tc.attempts); d < tc.min || d > tc.max {
+				t.Errorf("backoff(%d) = %v, want between %v and %v", tc.attempts, d, tc.min, tc.max)
+			}
+		}
+	}
+}
+
+func TestRetriesThenDeadLetters(t *testing.T) {
+	setup(t)
+	config.JobsMaxAttempts, config.JobsBackoff, config.JobsMaxBackoff = 3, "1ms", "1ms"
+
+	calls := 0
+	Register("test.fail", 1, func(args map[string]string) error {
+		calls++
+		return fmt.Errorf("attempt %d failed", calls)
+	})
+
+	failed := make(chan *Job, 1)
+	OnFailure(func(job *Job, err error) { failed <- job })
+	t.Cleanup(func() { OnFailure(func(*Job, error) {}) })
+
+	job, err := Enqueue("test.fail", map[string]string{"a": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drain(t, []string{job.ID}, StatusDead)
+
+	job, _ = Find(job.ID)
+	if calls != 3 || job.Attempts != 3 || job.LastError != "attempt 3 failed" {
+		t.Errorf("got %d calls, job %+v", calls, job)
+	}
+	select {
+	case f := <-failed:
+		if f.ID != job.ID {
+			t.Errorf("failure handler got %+v", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("failure handler wasn't called")
+	}
+
+	// A dead job runs again once retried.
+	Register("test.fail", 1, func(args map[string]string) error { return nil })
+	if err := Retry(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, []string{job.ID}, StatusDone)
+}
+
+func TestPanicsFailTheJob(t *testing.T) {
+	setup(t)
+	config.JobsMaxAttempts = 1
+
+	Register("test.panic", 1, func(args map[string]string) error { panic("boom") })
+
+	job, _ := Enqueue("test.panic", nil)
+	drain(t, []string{job.ID}, StatusDead)
+
+	if job, _ = Find(job.ID); job.LastError != "boom" {
+		t.Errorf("LastError = %q", job.LastError)
+	}
+}
+
+func TestPerKindConcurrency(t *testing.T) {
+	setup(t)
+
+	var lock sync.Mutex
+	running, most := 0, 0
+	release := make(chan struct{})
+	Register("test.slow", 2, func(args map[string]string) error {
+		lock.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		lock.Unlock()
+
+		<-release
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return nil
+	})
+
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		job, _ := Enqueue("test.slow", nil)
+		ids = append(ids, job.ID)
+	}
+
+	dispatch(time.Now())
+	dispatch(time.Now())
+
+	queued := 0
+	for _, id := range ids {
+		if job, _ := Find(id); job.Status == StatusQueued {
+			queued++
+		}
+	}
+	if queued != 3 {
+		t.Errorf("%d jobs still queued, want 3", queued)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		lock.Lock()
+		started := running
+		lock.Unlock()
+		if started == 2 {
+			break
+		}
+	}
+
+	close(release)
+	drain(t, ids, StatusDone)
+
+	if most != 2 {
+		t.Errorf("%d jobs ran at once, want 2", most)
+	}
+}
+
+func TestDispatchSkipsFutureJobs(t *testing.T) {
+	setup(t)
+
+	ran := make(chan string, 1)
+	Register("test.later", 1, func(args map[string]string) error {
+		ran <- args["n"]
+		return nil
+	})
+
+	later, _ := EnqueueAt("test.later", map[string]string{"n": "later"}, time.Now().Add(time.Hour))
+	dispatch(time.Now())
+	if job, _ := Find(later.ID); job.Status != StatusQueued {
+		t.Errorf("future job is %s", job.Status)
+	}
+
+	dispatch(time.Now().Add(2 * time.Hour))
+	if n := <-ran; n != "later" {
+		t.Errorf("ran %q", n)
+	}
+}
+
+func TestRequeueAfterRestart(t *testing.T) {
+	setup(t)
+
+	queued, _ := Enqueue("test.interrupted", nil)
+	running, _ := Enqueue("test.interrupted", nil)
+	done, _ := Enqueue("test.interrupted", nil)
+	update(running.ID, func(job *Job) { job.Status = StatusRunning })
+	update(done.ID, func(job *Job) { job.Status = StatusDone })
+
+	// A new process starts with nothing pending.
+	pendingLock.Lock()
+	pending = map[string]time.Time{}
+	pendingLock.Unlock()
+
+	if err := requeue(); err != nil {
+		t.Fatal(err)
+	}
+
+	if job, _ := Find(running.ID); job.Status != StatusQueued {
+		t.Errorf("interrupted job is %s", job.Status)
+	}
+	ids := due(time.Now())
+	if len(ids) != 2 || (ids[0] != queued.ID && ids[1] != queued.ID) || (ids[0] != running.ID && ids[1] != running.ID) {
+		t.Errorf("due = %v, want %s and %s", ids, queued.ID, running.ID)
+	}
+}
@@ -0,0 +1,400 @@
+package scheduler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/ical"
+)
+
+const (
+	caldavBlockProperty      = "X-SUBMIT-BLOCK"
+	caldavEvaluatorsProperty = "X-SUBMIT-EVALUATORS"
+	caldavTeamsProperty      = "X-SUBMIT-TEAMS"
+	caldavCapacityProperty   = "X-SUBMIT-CAPACITY"
+	caldavVideoProperty      = "X-SUBMIT-VIDEO"
+
+	caldavQuery = `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%s" end="%s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+)
+
+var (
+	caldavLock sync.Mutex
+)
+
+type caldavScheduler struct{}
+
+type caldavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ETag         string `xml:"getetag"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+type caldavResource struct {
+	href  string
+	etag  string
+	event *ical.Event
+}
+
+func (c *caldavScheduler) Slots() ([]*Slot, error) {
+	resources, err := c.query(window())
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*Slot{}
+	for _, r := range resources {
+		slots = append(slots, r.slot())
+	}
+	sortSlots(slots)
+
+	return slots, nil
+}
+
+func (c *caldavScheduler) FreeSlots() ([]*Slot, error) {
+	timeMin, timeMax := window()
+	if now := time.Now(); now.After(timeMin) {
+		timeMin = now
+	}
+
+	resources, err := c.query(timeMin, timeMax)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*Slot{}
+	for _, r := range resources {
+		if slot := r.slot(); slot.Free() {
+			slots = append(slots, slot)
+		}
+	}
+	sortSlots(slots)
+
+	return slots, nil
+}
+
+func (c *caldavScheduler) TeamSlot(teamName string) (*Slot, error) {
+	r, err := c.teamResource(teamName)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	return r.slot(), nil
+}
+
+func (c *caldavScheduler) Reserve(teamName, slotID string) error {
+	caldavLock.Lock()
+	defer caldavLock.Unlock()
+
+	oldSlot, err := c.teamResource(teamName)
+	if err != nil {
+		return err
+	}
+	if oldSlot != nil && oldSlot.href == slotID {
+		return nil
+	}
+
+	newSlot, err := c.find(slotID)
+	if err != nil {
+		return err
+	}
+	if !newSlot.slot().Free() {
+		return ErrSlotTaken
+	}
+
+	newSlot.setTeams(append(newSlot.slot().Teams, teamName))
+	if err := c.put(newSlot, "If-Match", newSlot.etag); err != nil {
+		return err
+	}
+
+	if oldSlot != nil {
+		oldSlot.setTeams(oldSlot.slot().without(teamName))
+		if err := c.put(oldSlot, "If-Match", oldSlot.etag); err != nil {
+			if reserved, findErr := c.find(slotID); findErr == nil {
+				reserved.setTeams(reserved.slot().without(teamName))
+				c.put(reserved, "If-Match", reserved.etag)
+			}
+			return fmt.Errorf("could not release old slot: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *caldavScheduler) Release(teamName string) error {
+	caldavLock.Lock()
+	defer caldavLock.Unlock()
+
+	r, err := c.teamResource(teamName)
+	if err != nil || r == nil {
+		return err
+	}
+
+	r.setTeams(r.slot().without(teamName))
+	return c.put(r, "If-Match", r.etag)
+}
+
+func (c *caldavScheduler) Create(slot *Slot) error {
+	uid := slot.keyID()
+	if slot.Block == "" {
+		hasher := md5.New()
+		hasher.Write([]byte(slot.Start.String() + strconv.FormatInt(time.Now().UnixNano(), 10)))
+		uid = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	base, err := url.Parse(config.CalDAVURL)
+	if err != nil {
+		return err
+	}
+	href, err := base.Parse(uid + ".ics")
+	if err != nil {
+		return err
+	}
+
+	r := &caldavResource{
+		href: href.Path,
+		event: &ical.Event{
+			UID:     uid,
+			Summary: "FREE",
+		},
+	}
+	r.apply(slot)
+	// The precondition only fails when a slot of the same block and key was
+	// created before.
+	if err := c.put(r, "If-None-Match", "*"); err != nil && err != ErrSlotTaken {
+		return err
+	}
+
+	slot.ID = r.href
+	return nil
+}
+
+func (c *caldavScheduler) Update(slot *Slot) error {
+	r, err := c.find(slot.ID)
+	if err != nil {
+		return err
+	}
+
+	r.apply(slot)
+	return c.put(r, "If-Match", r.etag)
+}
+
+func (c *caldavScheduler) Delete(slotID string) error {
+	r, err := c.find(slotID)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(http.MethodDelete, r.href, nil, map[string]string{"If-Match": r.etag})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (c *caldavScheduler) teamResource(teamName string) (*caldavResource, error) {
+	timeMin, timeMax := window()
+	resources, err := c.query(timeMin, timeMax)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range resources {
+		if r.slot().Has(teamName) {
+			return r, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *caldavScheduler) query(timeMin, timeMax time.Time) ([]*caldavResource, error) {
+	body := fmt.Sprintf(caldavQuery,
+		timeMin.UTC().Format("20060102T150405Z"), timeMax.UTC().Format("20060102T150405Z"))
+
+	response, err := c.do("REPORT", config.CalDAVURL, strings.NewReader(body), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	multistatus := caldavMultistatus{}
+	if err := xml.NewDecoder(response.Body).Decode(&multistatus); err != nil {
+		return nil, err
+	}
+
+	resources := []*caldavResource{}
+	for _, r := range multistatus.Responses {
+		for _, propstat := range r.Propstat {
+			if propstat.Prop.CalendarData == "" {
+				continue
+			}
+
+			events, err := ical.Parse(propstat.Prop.CalendarData)
+			if err != nil || len(events) == 0 {
+				continue
+			}
+
+			resources = append(resources, &caldavResource{
+				href:  r.Href,
+				etag:  propstat.Prop.ETag,
+				event: events[0],
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+// find returns the slot with the given ID. IDs are hrefs, and only the ones
+// the server listed are accepted, so IDs coming from a form can't point the
+// scheduler at other resources.
+func (c *caldavScheduler) find(slotID string) (*caldavResource, error) {
+	resources, err := c.query(window())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range resources {
+		if r.href == slotID {
+			return r, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Couldn't find slot %s", slotID)
+}
+
+func (c *caldavScheduler) put(r *caldavResource, condition, value string) error {
+	response, err := c.do(http.MethodPut, r.href, strings.NewReader(r.event.String()), map[string]string{
+		"Content-Type": "text/calendar; charset=utf-8",
+		condition:      value,
+	})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (c *caldavScheduler) do(method, href string, body *strings.Reader, headers map[string]string) (*http.Response, error) {
+	base, err := url.Parse(config.CalDAVURL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := base.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	// The credentials below must only ever reach the configured server.
+	inside := target.Path == base.Path || strings.HasPrefix(target.Path, strings.TrimSuffix(base.Path, "/")+"/")
+	if target.Scheme != base.Scheme || target.Host != base.Host || !inside {
+		return nil, fmt.Errorf("Refusing to send a CalDAV request outside %s: %s", config.CalDAVURL, href)
+	}
+
+	var request *http.Request
+	if body != nil {
+		request, err = http.NewRequest(method, target.String(), body)
+	} else {
+		request, err = http.NewRequest(method, target.String(), bytes.NewReader(nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+	if config.CalDAVUsername != "" {
+		request.SetBasicAuth(config.CalDAVUsername, config.CalDAVPassword)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusPreconditionFailed:
+		response.Body.Close()
+		return nil, ErrSlotTaken
+	case response.StatusCode >= 300:
+		response.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, target.Path, response.Status)
+	}
+
+	return response, nil
+}
+
+func (r *caldavResource) slot() *Slot {
+	slot := &Slot{
+		ID:    r.href,
+		Start: r.event.Start,
+		End:   r.event.End,
+	}
+	if teams, ok := r.event.Property(caldavTeamsProperty); ok {
+		slot.Teams = splitProperty(teams)
+	} else if r.event.Summary != "FREE" {
+		slot.Teams = []string{r.event.Summary}
+	}
+	capacity, _ := r.event.Property(caldavCapacityProperty)
+	slot.Capacity, _ = strconv.Atoi(capacity)
+	slot.Location = r.event.Location
+	slot.VideoURL, _ = r.event.Property(caldavVideoProperty)
+	slot.Block, _ = r.event.Property(caldavBlockProperty)
+	evaluators, _ := r.event.Property(caldavEvaluatorsProperty)
+	slot.Evaluators = splitProperty(evaluators)
+
+	return slot
+}
+
+func (r *caldavResource) setTeams(teams []string) {
+	r.event.Summary = "FREE"
+	if len(teams) > 0 {
+		r.event.Summary = strings.Join(teams, ", ")
+	}
+	r.event.SetProperty(caldavTeamsProperty, strings.Join(teams, ","))
+}
+
+func (r *caldavResource) apply(slot *Slot) {
+	r.event.Start = slot.Start
+	r.event.End = slot.End
+	r.event.Location = slot.Location
+	r.event.SetProperty(caldavCapacityProperty, strconv.Itoa(slot.Capacity))
+	r.event.SetProperty(caldavVideoProperty, slot.VideoURL)
+	r.event.SetProperty(caldavBlockProperty, slot.Block)
+	r.event.SetProperty(caldavEvaluatorsProperty, strings.Join(slot.Evaluators, ","))
+}
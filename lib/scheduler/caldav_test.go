@@ -0,0 +1,334 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+)
+
+// fakeCalDAV is a CalDAV server stand-in holding one calendar at /cal/. It
+// answers REPORT with every resource, and honours If-Match and If-None-Match
+// on PUT and DELETE.
+type fakeCalDAV struct {
+	sync.Mutex
+	resources map[string]*fakeResource
+	etag      int
+
+	// beforePut runs before each PUT is applied, with the lock held.
+	beforePut func(href string)
+}
+
+type fakeResource struct {
+	etag string
+	data string
+}
+
+func newFakeCalDAV(t *testing.T) (*fakeCalDAV, *httptest.Server) {
+	f := &fakeCalDAV{resources: map[string]*fakeResource{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	oldURL, oldUser, oldPassword := config.CalDAVURL, config.CalDAVUsername, config.CalDAVPassword
+	oldStart, oldEnd := config.EvaluationsWeekStart, config.EvaluationsWeekEnd
+	t.Cleanup(func() {
+		config.CalDAVURL, config.CalDAVUsername, config.CalDAVPassword = oldURL, oldUser, oldPassword
+		config.EvaluationsWeekStart, config.EvaluationsWeekEnd = oldStart, oldEnd
+	})
+
+	config.CalDAVURL = server.URL + "/cal/"
+	config.CalDAVUsername, config.CalDAVPassword = "caldav", "secret"
+	config.EvaluationsWeekStart = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	config.EvaluationsWeekEnd = time.Now().Add(7 * 24 * time.Hour).Format(time.RFC3339)
+
+	return f, server
+}
+
+func (f *fakeCalDAV) nextEtag() string {
+	f.etag++
+	return strconv.Quote(strconv.Itoa(f.etag))
+}
+
+func (f *fakeCalDAV) add(name string, start time.Time, lines ...string) string {
+	f.Lock()
+	defer f.Unlock()
+
+	href := "/cal/" + name + ".ics"
+	f.resources[href] = &fakeResource{
+		etag: f.nextEtag(),
+		data: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\n" +
+			"UID:" + name + "\r\n" +
+			"DTSTART:" + start.UTC().Format("20060102T150405Z") + "\r\n" +
+			"DTEND:" + start.Add(time.Hour).UTC().Format("20060102T150405Z") + "\r\n" +
+			strings.Join(lines, "\r\n") + "\r\n" +
+			"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	}
+
+	return href
+}
+
+func (f *fakeCalDAV) data(href string) string {
+	f.Lock()
+	defer f.Unlock()
+
+	if r, ok := f.resources[href]; ok {
+		return r.data
+	}
+
+	return ""
+}
+
+func (f *fakeCalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != "caldav" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	resource := f.resources[r.URL.Path]
+	switch r.Method {
+	case "REPORT":
+		hrefs := []string{}
+		for href := range f.resources {
+			hrefs = append(hrefs, href)
+		}
+		sort.Strings(hrefs)
+
+		var b bytes.Buffer
+		b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` +
+			`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+		for _, href := range hrefs {
+			fmt.Fprintf(&b, "<D:response><D:href>%s</D:href><D:propstat><D:prop><D:getetag>", href)
+			xml.EscapeText(&b, []byte(f.resources[href].etag))
+			b.WriteString("</D:getetag><C:calendar-data>")
+			xml.EscapeText(&b, []byte(f.resources[href].data))
+			b.WriteString("</C:calendar-data></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>")
+		}
+		b.WriteString("</D:multistatus>")
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(207)
+		w.Write(b.Bytes())
+	case http.MethodPut:
+		if f.beforePut != nil {
+			f.beforePut(r.URL.Path)
+			resource = f.resources[r.URL.Path]
+		}
+		if match := r.Header.Get("If-Match"); match != "" && (resource == nil || resource.etag != match) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && resource != nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		f.resources[r.URL.Path] = &fakeResource{etag: f.nextEtag(), data: string(body)}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if resource == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && resource.etag != match {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		delete(f.resources, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestCalDAVReportParsing(t *testing.T) {
+	f, _ := newFakeCalDAV(t)
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	free := f.add("free", start,
+		"SUMMARY:FREE",
+		"LOCATION:Room 1\\, C7",
+		"X-SUBMIT-CAPACITY:2",
+		"X-SUBMIT-EVALUATORS:alice\\,bob",
+		"X-SUBMIT-VIDEO:https://meet.example.com/x")
+	taken := f.add("taken", start.Add(time.Hour),
+		"SUMMARY:Team 1",
+		"X-SUBMIT-TEAMS:Team 1")
+
+	slots, err := (&caldavScheduler{}).Slots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 2 {
+		t.Fatalf("got %d slots, want 2", len(slots))
+	}
+
+	s := slots[0]
+	if s.ID != free || !s.Start.Equal(start) || s.Location != "Room 1, C7" || s.Capacity != 2 ||
+		s.VideoURL != "https://meet.example.com/x" || strings.Join(s.Evaluators, "|") != "alice|bob" || len(s.Teams) != 0 {
+		t.Errorf("free slot parsed as %+v", s)
+	}
+	if s := slots[1]; s.ID != taken || len(s.Teams) != 1 || s.Teams[0] != "Team 1" || s.Free() {
+		t.Errorf("taken slot parsed as %+v", s)
+	}
+
+	freeSlots, err := (&caldavScheduler{}).FreeSlots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(freeSlots) != 1 || freeSlots[0].ID != free {
+		t.Errorf("FreeSlots = %v, want only %s", freeSlots, free)
+	}
+}
+
+func TestCalDAVReserveConflict(t *testing.T) {
+	f, _ := newFakeCalDAV(t)
+	href := f.add("slot", time.Now().Add(24*time.Hour), "SUMMARY:FREE")
+
+	// Another client books the slot between our REPORT and our PUT.
+	f.beforePut = func(path string) {
+		f.beforePut = nil
+		f.resources[path].data = strings.Replace(f.resources[path].data, "SUMMARY:FREE", "SUMMARY:Team 2", 1)
+		f.resources[path].etag = f.nextEtag()
+	}
+
+	if err := (&caldavScheduler{}).Reserve("Team 1", href); err != ErrSlotTaken {
+		t.Fatalf("Reserve = %v, want ErrSlotTaken", err)
+	}
+	if data := f.data(href); !strings.Contains(data, "SUMMARY:Team 2") || strings.Contains(data, "Team 1") {
+		t.Errorf("slot was overwritten:\n%s", data)
+	}
+}
+
+func TestCalDAVReserveAndRelease(t *testing.T) {
+	f, _ := newFakeCalDAV(t)
+	a := f.add("a", time.Now().Add(24*time.Hour), "SUMMARY:FREE",
+		"ATTENDEE;CN=\"Evaluator, One\":mailto:one@example.com",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "TRIGGER:-PT15M", "END:VALARM")
+	b := f.add("b", time.Now().Add(25*time.Hour), "SUMMARY:FREE")
+
+	c := &caldavScheduler{}
+	if err := c.Reserve("Team 1", a); err != nil {
+		t.Fatal(err)
+	}
+	if slot, _ := c.TeamSlot("Team 1"); slot == nil || slot.ID != a {
+		t.Fatalf("TeamSlot = %+v, want %s", slot, a)
+	}
+	for _, line := range []string{"ATTENDEE;CN=\"Evaluator, One\":mailto:one@example.com", "BEGIN:VALARM", "TRIGGER:-PT15M"} {
+		if !strings.Contains(f.data(a), line) {
+			t.Errorf("reserving lost %q:\n%s", line, f.data(a))
+		}
+	}
+
+	if err := c.Reserve("Team 1", b); err != nil {
+		t.Fatal(err)
+	}
+	if slot, _ := c.TeamSlot("Team 1"); slot == nil || slot.ID != b {
+		t.Fatalf("TeamSlot = %+v after moving, want %s", slot, b)
+	}
+	if strings.Contains(f.data(a), "Team 1") {
+		t.Errorf("old slot still holds the team:\n%s", f.data(a))
+	}
+
+	if err := c.Release("Team 1"); err != nil {
+		t.Fatal(err)
+	}
+	if slot, _ := c.TeamSlot("Team 1"); slot != nil {
+		t.Errorf("TeamSlot = %+v after Release, want none", slot)
+	}
+	if !strings.Contains(f.data(b), "SUMMARY:FREE") {
+		t.Errorf("released slot isn't free:\n%s", f.data(b))
+	}
+}
+
+func TestCalDAVRejectsForeignHrefs(t *testing.T) {
+	f, _ := newFakeCalDAV(t)
+	f.add("slot", time.Now().Add(24*time.Hour), "SUMMARY:FREE")
+
+	hits := 0
+	evil := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer evil.Close()
+
+	c := &caldavScheduler{}
+	for _, href := range []string{evil.URL + "/x.ics", "//" + strings.TrimPrefix(evil.URL, "http://") + "/x.ics", "/other/x.ics", "/cal-x/x.ics", "/cal/../other/x.ics"} {
+		if err := c.Reserve("Team 1", href); err == nil {
+			t.Errorf("Reserve(%q) succeeded", href)
+		}
+		if err := c.Update(&Slot{ID: href}); err == nil {
+			t.Errorf("Update(%q) succeeded", href)
+		}
+		if err := c.Delete(href); err == nil {
+			t.Errorf("Delete(%q) succeeded", href)
+		}
+		if _, err := c.do(http.MethodGet, href, nil, nil); err == nil {
+			t.Errorf("do(%q) succeeded", href)
+		}
+	}
+
+	if hits > 0 {
+		t.Errorf("the foreign host got %d requests", hits)
+	}
+
+	// Without a trailing slash on the calendar URL, siblings sharing its
+	// prefix are still outside it.
+	config.CalDAVURL = strings.TrimSuffix(config.CalDAVURL, "/")
+	tests := []struct {
+		href string
+		ok   bool
+	}{
+		{"/cal", true},
+		{"/cal/slot.ics", true},
+		{"/cal-x/slot.ics", false},
+		{"/calendar/slot.ics", false},
+	}
+	for _, tt := range tests {
+		_, err := c.do(http.MethodDelete, tt.href, nil, nil)
+		if refused := err != nil && strings.Contains(err.Error(), "Refusing"); refused == tt.ok {
+			t.Errorf("do(%q) = %v, want allowed %v", tt.href, err, tt.ok)
+		}
+	}
+}
+
+func TestCalDAVCreateSameSlotTwice(t *testing.T) {
+	f, _ := newFakeCalDAV(t)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+	planned := func() *Slot {
+		return &Slot{Start: start, End: start.Add(time.Hour), Capacity: 1, Location: "C7", Block: "b"}
+	}
+
+	c := &caldavScheduler{}
+	first := planned()
+	if err := c.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reserve("Team 1", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	again := planned()
+	if err := c.Create(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("created again as %s, want %s", again.ID, first.ID)
+	}
+	if len(f.resources) != 1 || !strings.Contains(f.data(first.ID), "Team 1") {
+		t.Errorf("resources = %d, want the one booked slot:\n%s", len(f.resources), f.data(first.ID))
+	}
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Plan struct
+type Plan struct {
+	From       time.Time
+	To         time.Time
+	Windows    []string
+	SkipDays   []string
+	Length     time.Duration
+	Break      time.Duration
+	Rooms      []string
+	VideoURL   string
+	Capacity   int
+	Evaluators []string
+}
+
+// Generate func
+func (p *Plan) Generate(block string) ([]*Slot, error) {
+	if p.Length <= 0 {
+		return nil, fmt.Errorf("Slot length must be positive")
+	}
+	if p.Break < 0 {
+		return nil, fmt.Errorf("Break can't be negative")
+	}
+	if p.To.Before(p.From) {
+		return nil, fmt.Errorf("End date is before start date")
+	}
+
+	type window struct{ from, to time.Duration }
+	windows := []window{}
+	for _, w := range p.Windows {
+		bounds := strings.Split(w, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("Invalid window: %s", w)
+		}
+
+		from, err := clock(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := clock(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		if to <= from {
+			return nil, fmt.Errorf("Invalid window: %s", w)
+		}
+
+		windows = append(windows, window{from, to})
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("At least one daily window is required")
+	}
+
+	skip := map[string]bool{}
+	for _, day := range p.SkipDays {
+		skip[strings.ToLower(strings.TrimSpace(day))] = true
+	}
+
+	tracks := len(p.Rooms)
+	if tracks == 0 {
+		tracks = len(p.Evaluators)
+	}
+	if tracks == 0 {
+		tracks = 1
+	}
+
+	slots := []*Slot{}
+	for day := p.From; !day.After(p.To); day = day.AddDate(0, 0, 1) {
+		weekday := strings.ToLower(day.Weekday().String())
+		if skip[weekday] || skip[weekday[:3]] {
+			continue
+		}
+
+		// Window bounds are wall-clock times, which aren't a fixed offset from
+		// midnight on days the clocks change.
+		at := func(d time.Duration) time.Time {
+			return time.Date(day.Year(), day.Month(), day.Day(), int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, day.Location())
+		}
+
+		for _, w := range windows {
+			end := at(w.to)
+			for start := at(w.from); !start.Add(p.Length).After(end); start = start.Add(p.Length + p.Break) {
+				for t := 0; t < tracks; t++ {
+					slot := &Slot{
+						Start:    start,
+						End:      start.Add(p.Length),
+						Capacity: p.Capacity,
+						VideoURL: p.VideoURL,
+						Block:    block,
+					}
+					if t < len(p.Rooms) {
+						slot.Location = p.Rooms[t]
+					}
+					if len(p.Evaluators) > 0 {
+						slot.Evaluators = []string{p.Evaluators[t%len(p.Evaluators)]}
+					}
+
+					slots = append(slots, slot)
+				}
+			}
+		}
+	}
+
+	return slots, nil
+}
+
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time: %s", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
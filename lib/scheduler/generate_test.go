@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateRejectsInvalidPlans(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name string
+		plan Plan
+		err  string
+	}{
+		{"no length", Plan{From: day, To: day, Windows: []string{"09:00-12:00"}}, "Slot length must be positive"},
+		{"negative break", Plan{From: day, To: day, Windows: []string{"09:00-12:00"}, Length: 30 * time.Minute, Break: -30 * time.Minute}, "Break can't be negative"},
+		{"backwards dates", Plan{From: day, To: day.AddDate(0, 0, -1), Windows: []string{"09:00-12:00"}, Length: time.Hour}, "End date is before start date"},
+		{"backwards window", Plan{From: day, To: day, Windows: []string{"12:00-09:00"}, Length: time.Hour}, "Invalid window"},
+		{"no windows", Plan{From: day, To: day, Length: time.Hour}, "At least one daily window is required"},
+	} {
+		if _, err := tc.plan.Generate("b"); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestGenerateSlots(t *testing.T) {
+	// Monday to Wednesday, skipping Tuesday.
+	from := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	plan := &Plan{
+		From:       from,
+		To:         from.AddDate(0, 0, 2),
+		Windows:    []string{"09:00-10:30"},
+		SkipDays:   []string{"Tue"},
+		Length:     30 * time.Minute,
+		Break:      15 * time.Minute,
+		Rooms:      []string{"C7", "C8"},
+		Evaluators: []string{"alice"},
+		Capacity:   2,
+	}
+
+	slots, err := plan.Generate("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	starts := []string{}
+	for _, s := range slots {
+		if s.Block != "b" || s.Capacity != 2 || s.End.Sub(s.Start) != 30*time.Minute || s.Evaluators[0] != "alice" {
+			t.Errorf("slot %+v", s)
+		}
+		starts = append(starts, s.Start.Format("Mon 15:04 ")+s.Location)
+	}
+
+	want := "Mon 09:00 C7|Mon 09:00 C8|Mon 09:45 C7|Mon 09:45 C8|Wed 09:00 C7|Wed 09:00 C8|Wed 09:45 C7|Wed 09:45 C8"
+	if strings.Join(starts, "|") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(starts, "|"), want)
+	}
+}
+
+func TestGenerateKeepsWallClockOnDSTDays(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// The clocks go forward at 02:00 on March 31, 2024 in Berlin.
+	day := time.Date(2024, 3, 31, 0, 0, 0, 0, loc)
+	slots, err := (&Plan{From: day, To: day, Windows: []string{"09:00-10:00"}, Length: time.Hour}).Generate("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(slots) != 1 || slots[0].Start.Format("15:04") != "09:00" || slots[0].End.Format("15:04") != "10:00" {
+		t.Errorf("got %v, want one slot from 09:00 to 10:00", slots)
+	}
+}
@@ -0,0 +1,352 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/lib/google"
+	calendar "google.golang.org/api/calendar/v3"
+)
+
+const (
+	googlePatchAttempts = 5
+)
+
+var (
+	// googleLock serializes reservations within this process; the ETags sent
+	// with every patch catch bookings made by other instances, and the patch
+	// is retried on a fresh read.
+	googleLock sync.Mutex
+
+	errSlotChanged = fmt.Errorf("slot changed since it was read")
+	errSlotExists  = fmt.Errorf("slot already exists")
+
+	googleCalendar calendarAPI = googleCalendarAPI{}
+)
+
+// calendarAPI is the part of Google Calendar the scheduler uses.
+type calendarAPI interface {
+	Slot(slotID string) (*calendar.Event, error)
+	Slots() ([]*calendar.Event, error)
+	Search(q string) ([]*calendar.Event, error)
+	// Patch fails with errSlotChanged if the event changed since it was read.
+	Patch(event, patch *calendar.Event) (*calendar.Event, error)
+	// Create fails with errSlotExists if the event ID is taken.
+	Create(event *calendar.Event) (*calendar.Event, error)
+	Delete(slotID string) error
+}
+
+type googleCalendarAPI struct{}
+
+func (googleCalendarAPI) Slot(slotID string) (*calendar.Event, error) {
+	return google.CalendarSlot(slotID)
+}
+
+func (googleCalendarAPI) Slots() ([]*calendar.Event, error) {
+	return google.CalendarSlots()
+}
+
+func (googleCalendarAPI) Search(q string) ([]*calendar.Event, error) {
+	return google.CalendarSearchSlots(q)
+}
+
+func (googleCalendarAPI) Patch(event, patch *calendar.Event) (*calendar.Event, error) {
+	patched, err := google.CalendarPatchSlot(event, patch)
+	if err == google.ErrSlotTaken {
+		return nil, errSlotChanged
+	}
+
+	return patched, err
+}
+
+func (googleCalendarAPI) Create(event *calendar.Event) (*calendar.Event, error) {
+	created, err := google.CalendarCreateSlot(event)
+	if err == google.ErrSlotExists {
+		return nil, errSlotExists
+	}
+
+	return created, err
+}
+
+func (googleCalendarAPI) Delete(slotID string) error {
+	return google.CalendarDeleteSlot(slotID)
+}
+
+type googleScheduler struct{}
+
+func (*googleScheduler) Slots() ([]*Slot, error) {
+	events, err := googleCalendar.Slots()
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*Slot{}
+	for _, event := range events {
+		slots = append(slots, slotFromEvent(event))
+	}
+
+	return slots, nil
+}
+
+func (g *googleScheduler) FreeSlots() ([]*Slot, error) {
+	slots, err := g.Slots()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	free := []*Slot{}
+	for _, slot := range slots {
+		if slot.Free() && slot.Start.After(now) {
+			free = append(free, slot)
+		}
+	}
+
+	return free, nil
+}
+
+func (g *googleScheduler) TeamSlot(teamName string) (*Slot, error) {
+	event, err := g.teamEvent(teamName)
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	return slotFromEvent(event), nil
+}
+
+func (g *googleScheduler) Reserve(teamName, slotID string) error {
+	googleLock.Lock()
+	defer googleLock.Unlock()
+
+	oldEvent, err := g.teamEvent(teamName)
+	if err != nil {
+		return err
+	}
+	if oldEvent != nil && oldEvent.Id == slotID {
+		return nil
+	}
+
+	_, err = g.patchTeams(slotID, func(slot *Slot) ([]string, error) {
+		if !slot.Free() {
+			return nil, ErrSlotTaken
+		}
+		return append(slot.Teams, teamName), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if oldEvent != nil {
+		without := func(slot *Slot) ([]string, error) {
+			return slot.without(teamName), nil
+		}
+		if _, err := g.patchTeams(oldEvent.Id, without); err != nil {
+			if _, rollbackErr := g.patchTeams(slotID, without); rollbackErr != nil {
+				return fmt.Errorf("could not release old slot (%v) nor roll back new slot (%v)", err, rollbackErr)
+			}
+			return fmt.Errorf("could not release old slot: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (g *googleScheduler) Release(teamName string) error {
+	googleLock.Lock()
+	defer googleLock.Unlock()
+
+	event, err := g.teamEvent(teamName)
+	if err != nil || event == nil {
+		return err
+	}
+
+	_, err = g.patchTeams(event.Id, func(slot *Slot) ([]string, error) {
+		return slot.without(teamName), nil
+	})
+	return err
+}
+
+func (*googleScheduler) Create(slot *Slot) error {
+	event := eventFromSlot(slot, &calendar.Event{})
+	if slot.Block != "" {
+		event.Id = slot.keyID()
+	}
+
+	created, err := googleCalendar.Create(event)
+	if err == errSlotExists {
+		slot.ID = event.Id
+		return restoreSlot(slot)
+	}
+	if err != nil {
+		return err
+	}
+
+	slot.ID = created.Id
+	return nil
+}
+
+func (*googleScheduler) Update(slot *Slot) error {
+	_, err := patchSlot(slot.ID, func(event *calendar.Event) (*calendar.Event, error) {
+		return eventFromSlot(slot, event), nil
+	})
+	return err
+}
+
+func (*googleScheduler) Delete(slotID string) error {
+	return googleCalendar.Delete(slotID)
+}
+
+func (*googleScheduler) teamEvent(teamName string) (*calendar.Event, error) {
+	events, err := googleCalendar.Search(teamName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		if slotFromEvent(event).Has(teamName) {
+			return event, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// patchTeams sets the teams of a slot to those fn picks from its current
+// state.
+func (*googleScheduler) patchTeams(slotID string, fn func(slot *Slot) ([]string, error)) (*calendar.Event, error) {
+	return patchSlot(slotID, func(event *calendar.Event) (*calendar.Event, error) {
+		teams, err := fn(slotFromEvent(event))
+		if err != nil {
+			return nil, err
+		}
+
+		patch := &calendar.Event{
+			Summary: "FREE",
+			ColorId: "0",
+			ExtendedProperties: &calendar.EventExtendedProperties{
+				Private: privateProperties(event),
+			},
+		}
+		if len(teams) > 0 {
+			patch.Summary = strings.Join(teams, ", ")
+			patch.ColorId = "5"
+		}
+		patch.ExtendedProperties.Private["teams"] = strings.Join(teams, ",")
+
+		return patch, nil
+	})
+}
+
+// patchSlot reads a slot and applies the patch fn builds from it. When
+// another instance changes the slot in between, the patch is built again
+// from a fresh read, so it never overwrites that change.
+func patchSlot(slotID string, fn func(event *calendar.Event) (*calendar.Event, error)) (*calendar.Event, error) {
+	for attempt := 0; attempt < googlePatchAttempts; attempt++ {
+		event, err := googleCalendar.Slot(slotID)
+		if err != nil {
+			return nil, err
+		}
+
+		patch, err := fn(event)
+		if err != nil {
+			return nil, err
+		}
+
+		patched, err := googleCalendar.Patch(event, patch)
+		if err != errSlotChanged {
+			return patched, err
+		}
+	}
+
+	return nil, ErrSlotTaken
+}
+
+// restoreSlot brings back a slot that was deleted since it was first
+// created, as Google keeps the IDs of deleted events. A slot that is still
+// there is left alone.
+func restoreSlot(slot *Slot) error {
+	_, err := patchSlot(slot.ID, func(event *calendar.Event) (*calendar.Event, error) {
+		if event.Status != "cancelled" {
+			return nil, errSlotExists
+		}
+
+		patch := eventFromSlot(slot, event)
+		patch.Status = "confirmed"
+		patch.Summary = "FREE"
+		patch.ColorId = "0"
+		patch.ExtendedProperties.Private["teams"] = ""
+
+		return patch, nil
+	})
+	if err == errSlotExists {
+		return nil
+	}
+
+	return err
+}
+
+func slotFromEvent(event *calendar.Event) *Slot {
+	slot := &Slot{ID: event.Id}
+
+	if event.Start != nil {
+		slot.Start, _ = time.Parse(time.RFC3339, event.Start.DateTime)
+	}
+	if event.End != nil {
+		slot.End, _ = time.Parse(time.RFC3339, event.End.DateTime)
+	}
+	slot.Location = event.Location
+
+	properties := privateProperties(event)
+	if teams, ok := properties["teams"]; ok {
+		slot.Teams = splitProperty(teams)
+	} else if event.Summary != "FREE" {
+		slot.Teams = []string{event.Summary}
+	}
+	slot.Capacity, _ = strconv.Atoi(properties["capacity"])
+	slot.VideoURL = properties["video"]
+	slot.Block = properties["block"]
+	slot.Evaluators = splitProperty(properties["evaluators"])
+
+	return slot
+}
+
+// eventFromSlot builds a patch carrying the slot's details, keeping the other
+// private properties of event, bookings included.
+func eventFromSlot(slot *Slot, event *calendar.Event) *calendar.Event {
+	properties := privateProperties(event)
+	properties["block"] = slot.Block
+	properties["evaluators"] = strings.Join(slot.Evaluators, ",")
+	properties["capacity"] = strconv.Itoa(slot.Capacity)
+	properties["video"] = slot.VideoURL
+
+	return &calendar.Event{
+		Start:    &calendar.EventDateTime{DateTime: slot.Start.Format(time.RFC3339)},
+		End:      &calendar.EventDateTime{DateTime: slot.End.Format(time.RFC3339)},
+		Location: slot.Location,
+		ExtendedProperties: &calendar.EventExtendedProperties{
+			Private: properties,
+		},
+	}
+}
+
+func privateProperties(event *calendar.Event) map[string]string {
+	properties := map[string]string{}
+	if event.ExtendedProperties != nil {
+		for k, v := range event.ExtendedProperties.Private {
+			properties[k] = v
+		}
+	}
+
+	return properties
+}
+
+func splitProperty(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, ",")
+}
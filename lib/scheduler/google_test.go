@@ -0,0 +1,394 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	calendar "google.golang.org/api/calendar/v3"
+)
+
+// fakeCalendar is an in-memory calendar that checks ETags the way Google
+// Calendar checks If-Match.
+type fakeCalendar struct {
+	sync.Mutex
+	events map[string]*calendar.Event
+	etag   int
+
+	// beforePatch runs before each patch is applied, with the lock held.
+	beforePatch func(event *calendar.Event) error
+}
+
+func newFakeCalendar(ids ...string) *fakeCalendar {
+	f := &fakeCalendar{events: map[string]*calendar.Event{}}
+	start := time.Now().Add(48 * time.Hour)
+	for i, id := range ids {
+		at := start.Add(time.Duration(i) * time.Hour)
+		f.events[id] = &calendar.Event{
+			Id:      id,
+			Etag:    f.nextEtag(),
+			Summary: "FREE",
+			Start:   &calendar.EventDateTime{DateTime: at.Format(time.RFC3339)},
+			End:     &calendar.EventDateTime{DateTime: at.Add(time.Hour).Format(time.RFC3339)},
+			ExtendedProperties: &calendar.EventExtendedProperties{
+				Private: map[string]string{"capacity": "1"},
+			},
+		}
+	}
+
+	return f
+}
+
+func (f *fakeCalendar) nextEtag() string {
+	f.etag++
+	return strconv.Itoa(f.etag)
+}
+
+func (f *fakeCalendar) copy(event *calendar.Event) *calendar.Event {
+	c := *event
+	c.ExtendedProperties = &calendar.EventExtendedProperties{Private: privateProperties(event)}
+	return &c
+}
+
+func (f *fakeCalendar) Slot(slotID string) (*calendar.Event, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	event, ok := f.events[slotID]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", slotID)
+	}
+
+	return f.copy(event), nil
+}
+
+func (f *fakeCalendar) Slots() ([]*calendar.Event, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	events := []*calendar.Event{}
+	for _, event := range f.events {
+		if event.Status != "cancelled" {
+			events = append(events, f.copy(event))
+		}
+	}
+
+	return events, nil
+}
+
+func (f *fakeCalendar) Search(q string) ([]*calendar.Event, error) {
+	events, _ := f.Slots()
+
+	found := []*calendar.Event{}
+	for _, event := range events {
+		if strings.Contains(event.Summary, q) {
+			found = append(found, event)
+		}
+	}
+
+	return found, nil
+}
+
+func (f *fakeCalendar) Patch(event, patch *calendar.Event) (*calendar.Event, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.beforePatch != nil {
+		if err := f.beforePatch(f.events[event.Id]); err != nil {
+			return nil, err
+		}
+	}
+
+	current, ok := f.events[event.Id]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", event.Id)
+	}
+	if current.Etag != event.Etag {
+		return nil, errSlotChanged
+	}
+
+	if patch.Summary != "" {
+		current.Summary = patch.Summary
+	}
+	if patch.Location != "" {
+		current.Location = patch.Location
+	}
+	if patch.Status != "" {
+		current.Status = patch.Status
+	}
+	if patch.ExtendedProperties != nil {
+		current.ExtendedProperties = &calendar.EventExtendedProperties{Private: privateProperties(patch)}
+	}
+	current.Etag = f.nextEtag()
+
+	return f.copy(current), nil
+}
+
+func (f *fakeCalendar) Create(event *calendar.Event) (*calendar.Event, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	created := f.copy(event)
+	if created.Id == "" {
+		created.Id = fmt.Sprintf("event%d", len(f.events))
+	}
+	if _, ok := f.events[created.Id]; ok {
+		return nil, errSlotExists
+	}
+	if created.Summary == "" {
+		created.Summary = "FREE"
+	}
+	created.Etag = f.nextEtag()
+	f.events[created.Id] = created
+
+	return f.copy(created), nil
+}
+
+// Delete cancels the event, keeping its ID taken like Google Calendar does.
+func (f *fakeCalendar) Delete(slotID string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	event, ok := f.events[slotID]
+	if !ok {
+		return fmt.Errorf("not found: %s", slotID)
+	}
+	event.Status = "cancelled"
+	event.Etag = f.nextEtag()
+
+	return nil
+}
+
+func (f *fakeCalendar) teams(slotID string) []string {
+	event, _ := f.Slot(slotID)
+	return slotFromEvent(event).Teams
+}
+
+func withFakeCalendar(t *testing.T, f *fakeCalendar) {
+	old := googleCalendar
+	googleCalendar = f
+	t.Cleanup(func() { googleCalendar = old })
+}
+
+// book adds a team to an event the way another instance would, changing its
+// ETag.
+func (f *fakeCalendar) book(event *calendar.Event, teamName string) {
+	teams := slotFromEvent(event).Teams
+	event.Summary = strings.Join(append(teams, teamName), ", ")
+	event.ExtendedProperties.Private["teams"] = strings.Join(append(teams, teamName), ",")
+	event.Etag = f.nextEtag()
+}
+
+// Another instance books the slot between our read and our patch. The patch
+// must be rebuilt from a fresh read, keeping that booking and the capacity.
+func TestGoogleReserveRetriesAfterOtherInstance(t *testing.T) {
+	f := newFakeCalendar("slot")
+	f.events["slot"].ExtendedProperties.Private["capacity"] = "3"
+	withFakeCalendar(t, f)
+
+	patches := 0
+	f.beforePatch = func(event *calendar.Event) error {
+		patches++
+		if patches == 1 {
+			f.book(event, "Other 1")
+		}
+		return nil
+	}
+
+	g := &googleScheduler{}
+	if err := g.Reserve("Team 1", "slot"); err != nil {
+		t.Fatal(err)
+	}
+	if patches != 2 {
+		t.Errorf("got %d patches, want a retry after the conflict", patches)
+	}
+	if teams := f.teams("slot"); strings.Join(teams, "|") != "Other 1|Team 1" {
+		t.Errorf("slot holds %v, want [Other 1 Team 1]", teams)
+	}
+
+	// The other instance takes the last place while we try for it.
+	patches = 0
+	f.beforePatch = func(event *calendar.Event) error {
+		patches++
+		if patches == 1 {
+			f.book(event, "Other 2")
+		}
+		return nil
+	}
+
+	if err := g.Reserve("Team 2", "slot"); err != ErrSlotTaken {
+		t.Fatalf("Reserve of a full slot = %v, want ErrSlotTaken", err)
+	}
+	if teams := f.teams("slot"); strings.Join(teams, "|") != "Other 1|Team 1|Other 2" {
+		t.Errorf("slot holds %v, want [Other 1 Team 1 Other 2]", teams)
+	}
+}
+
+func TestGoogleReserveGivesUpOnConstantChanges(t *testing.T) {
+	f := newFakeCalendar("slot")
+	withFakeCalendar(t, f)
+
+	patches := 0
+	f.beforePatch = func(event *calendar.Event) error {
+		patches++
+		event.Etag = f.nextEtag()
+		return nil
+	}
+
+	if err := (&googleScheduler{}).Reserve("Team 1", "slot"); err != ErrSlotTaken {
+		t.Fatalf("Reserve = %v, want ErrSlotTaken", err)
+	}
+	if patches != googlePatchAttempts {
+		t.Errorf("got %d patches, want %d", patches, googlePatchAttempts)
+	}
+	if teams := f.teams("slot"); len(teams) != 0 {
+		t.Errorf("slot holds %v, want none", teams)
+	}
+}
+
+func TestGoogleUpdateKeepsOtherInstanceBookings(t *testing.T) {
+	f := newFakeCalendar("slot")
+	f.events["slot"].ExtendedProperties.Private["capacity"] = "2"
+	withFakeCalendar(t, f)
+
+	f.beforePatch = func(event *calendar.Event) error {
+		f.beforePatch = nil
+		f.book(event, "Team 1")
+		return nil
+	}
+
+	if err := (&googleScheduler{}).Update(&Slot{ID: "slot", Capacity: 2, Location: "C7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event, _ := f.Slot("slot")
+	if slot := slotFromEvent(event); slot.Location != "C7" || strings.Join(slot.Teams, "|") != "Team 1" {
+		t.Errorf("updated slot = %+v", slot)
+	}
+}
+
+// A booking made by another instance between the read and the patch changes
+// the ETag, so the patch must fail rather than overwrite it.
+func TestGoogleReserveLosesRaceToOtherInstance(t *testing.T) {
+	f := newFakeCalendar("slot")
+	withFakeCalendar(t, f)
+
+	f.beforePatch = func(event *calendar.Event) error {
+		f.beforePatch = nil
+		event.Summary = "Team 2"
+		event.ExtendedProperties.Private["teams"] = "Team 2"
+		event.Etag = f.nextEtag()
+		return nil
+	}
+
+	if err := (&googleScheduler{}).Reserve("Team 1", "slot"); err != ErrSlotTaken {
+		t.Fatalf("Reserve = %v, want ErrSlotTaken", err)
+	}
+	if teams := f.teams("slot"); len(teams) != 1 || teams[0] != "Team 2" {
+		t.Errorf("slot holds %v, want [Team 2]", teams)
+	}
+}
+
+func TestGoogleReserveSwapsSlots(t *testing.T) {
+	f := newFakeCalendar("a", "b")
+	withFakeCalendar(t, f)
+
+	g := &googleScheduler{}
+	if err := g.Reserve("Team 1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reserve("Team 1", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if teams := f.teams("a"); len(teams) != 0 {
+		t.Errorf("old slot holds %v, want none", teams)
+	}
+	if teams := f.teams("b"); len(teams) != 1 || teams[0] != "Team 1" {
+		t.Errorf("new slot holds %v, want [Team 1]", teams)
+	}
+}
+
+func TestGoogleReserveRollsBackWhenReleaseFails(t *testing.T) {
+	f := newFakeCalendar("a", "b")
+	withFakeCalendar(t, f)
+
+	g := &googleScheduler{}
+	if err := g.Reserve("Team 1", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.beforePatch = func(event *calendar.Event) error {
+		if event.Id == "a" {
+			return fmt.Errorf("backend down")
+		}
+		return nil
+	}
+
+	if err := g.Reserve("Team 1", "b"); err == nil {
+		t.Fatal("Reserve succeeded, want an error")
+	}
+	if teams := f.teams("a"); len(teams) != 1 || teams[0] != "Team 1" {
+		t.Errorf("old slot holds %v, want [Team 1]", teams)
+	}
+	if teams := f.teams("b"); len(teams) != 0 {
+		t.Errorf("new slot holds %v, want none after rollback", teams)
+	}
+}
+
+func TestGoogleReserveOwnSlot(t *testing.T) {
+	f := newFakeCalendar("slot")
+	withFakeCalendar(t, f)
+
+	g := &googleScheduler{}
+	if err := g.Reserve("Team 1", "slot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reserve("Team 1", "slot"); err != nil {
+		t.Errorf("reserving the team's own slot again = %v, want nil", err)
+	}
+}
+
+func TestGoogleCreateSameSlotTwice(t *testing.T) {
+	f := newFakeCalendar()
+	withFakeCalendar(t, f)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+	planned := func() *Slot {
+		return &Slot{Start: start, End: start.Add(time.Hour), Capacity: 1, Location: "C7", Block: "b"}
+	}
+
+	g := &googleScheduler{}
+	first := planned()
+	if err := g.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reserve("Team 1", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	again := planned()
+	if err := g.Create(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("created again as %s, want %s", again.ID, first.ID)
+	}
+	if slots, _ := g.Slots(); len(slots) != 1 || !slots[0].Has("Team 1") {
+		t.Errorf("slots = %+v, want the one booked slot", slots)
+	}
+
+	// The deleted event keeps its ID, so creating the slot again restores it.
+	if err := g.Delete(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Create(planned()); err != nil {
+		t.Fatal(err)
+	}
+	if slots, _ := g.Slots(); len(slots) != 1 || len(slots[0].Teams) != 0 || slots[0].Location != "C7" {
+		t.Errorf("slots = %+v, want the deleted slot back and free", slots)
+	}
+}
@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	localCollection = "slots"
+)
+
+var (
+	// localLock is all that keeps two reservations of the same slot apart, so
+	// the local backend must only be used by a single instance of the server.
+	localLock sync.Mutex
+)
+
+type localScheduler struct{}
+
+func (l *localScheduler) Slots() ([]*Slot, error) {
+	slots, err := l.all()
+	if err != nil {
+		return nil, err
+	}
+
+	timeMin, timeMax := window()
+	inWindow := []*Slot{}
+	for _, slot := range slots {
+		if !slot.Start.Before(timeMin) && slot.Start.Before(timeMax) {
+			inWindow = append(inWindow, slot)
+		}
+	}
+
+	return inWindow, nil
+}
+
+func (l *localScheduler) FreeSlots() ([]*Slot, error) {
+	slots, err := l.all()
+	if err != nil {
+		return nil, err
+	}
+
+	timeMin, timeMax := window()
+	if now := time.Now(); now.After(timeMin) {
+		timeMin = now
+	}
+
+	free := []*Slot{}
+	for _, slot := range slots {
+		if slot.Free() && !slot.Start.Before(timeMin) && slot.Start.Before(timeMax) {
+			free = append(free, slot)
+		}
+	}
+
+	return free, nil
+}
+
+func (l *localScheduler) TeamSlot(teamName string) (*Slot, error) {
+	slots, err := l.all()
+	if err != nil {
+		return nil, err
+	}
+
+	timeMin, timeMax := window()
+	for _, slot := range slots {
+		if slot.Has(teamName) && !slot.Start.Before(timeMin) && slot.Start.Before(timeMax) {
+			return slot, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (l *localScheduler) Reserve(teamName, slotID string) error {
+	localLock.Lock()
+	defer localLock.Unlock()
+
+	oldSlot, err := l.TeamSlot(teamName)
+	if err != nil {
+		return err
+	}
+	if oldSlot != nil && oldSlot.ID == slotID {
+		return nil
+	}
+
+	slot := &Slot{}
+	err = store.Update(localCollection, slotID, slot, func(found bool) error {
+		if !found {
+			return fmt.Errorf("Couldn't find slot %s", slotID)
+		}
+		if !slot.Free() {
+			return ErrSlotTaken
+		}
+
+		slot.Teams = append(slot.Teams, teamName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if oldSlot != nil {
+		oldSlot.Teams = oldSlot.without(teamName)
+		if err := store.Put(localCollection, oldSlot.ID, oldSlot); err != nil {
+			slot.Teams = slot.without(teamName)
+			store.Put(localCollection, slot.ID, slot)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *localScheduler) Release(teamName string) error {
+	localLock.Lock()
+	defer localLock.Unlock()
+
+	slot, err := l.TeamSlot(teamName)
+	if err != nil || slot == nil {
+		return err
+	}
+
+	return store.Update(localCollection, slot.ID, slot, func(found bool) error {
+		slot.Teams = slot.without(teamName)
+		return nil
+	})
+}
+
+func (l *localScheduler) Create(slot *Slot) error {
+	if slot.Block != "" {
+		slot.ID = slot.keyID()
+
+		existing := &Slot{}
+		return store.Update(localCollection, slot.ID, existing, func(found bool) error {
+			if !found {
+				*existing = *slot
+			}
+			return nil
+		})
+	}
+
+	if slot.ID == "" {
+		hasher := md5.New()
+		hasher.Write([]byte(slot.Start.String() + strconv.FormatInt(time.Now().UnixNano(), 10)))
+		slot.ID = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	return store.Put(localCollection, slot.ID, slot)
+}
+
+func (l *localScheduler) Update(slot *Slot) error {
+	existing := &Slot{}
+	return store.Update(localCollection, slot.ID, existing, func(found bool) error {
+		if !found {
+			return fmt.Errorf("Couldn't find slot %s", slot.ID)
+		}
+
+		existing.Start = slot.Start
+		existing.End = slot.End
+		existing.Capacity = slot.Capacity
+		existing.Location = slot.Location
+		existing.VideoURL = slot.VideoURL
+		existing.Evaluators = slot.Evaluators
+		return nil
+	})
+}
+
+func (l *localScheduler) Delete(slotID string) error {
+	return store.Delete(localCollection, slotID)
+}
+
+func (l *localScheduler) all() ([]*Slot, error) {
+	all := map[string]*Slot{}
+	if err := store.All(localCollection, &all); err != nil {
+		return nil, err
+	}
+
+	slots := make([]*Slot, 0, len(all))
+	for _, slot := range all {
+		slots = append(slots, slot)
+	}
+	sortSlots(slots)
+
+	return slots, nil
+}
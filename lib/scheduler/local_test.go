@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/store"
+)
+
+func newLocal(t *testing.T) *localScheduler {
+	if err := store.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	oldStart, oldEnd := config.EvaluationsWeekStart, config.EvaluationsWeekEnd
+	t.Cleanup(func() { config.EvaluationsWeekStart, config.EvaluationsWeekEnd = oldStart, oldEnd })
+	config.EvaluationsWeekStart = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	config.EvaluationsWeekEnd = time.Now().Add(7 * 24 * time.Hour).Format(time.RFC3339)
+
+	return &localScheduler{}
+}
+
+func TestLocalUpdateRoundTrip(t *testing.T) {
+	l := newLocal(t)
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+
+	slot := &Slot{Start: start, End: start.Add(time.Hour), Capacity: 1, Location: "C7", Block: "b"}
+	if err := l.Create(slot); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reserve("Team 1", slot.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Update(&Slot{
+		ID:         slot.ID,
+		Start:      start.Add(time.Hour),
+		End:        start.Add(2 * time.Hour),
+		Capacity:   3,
+		Location:   "C8",
+		VideoURL:   "https://meet.example.com/x",
+		Evaluators: []string{"alice"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := l.Slots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 1 {
+		t.Fatalf("got %d slots", len(slots))
+	}
+
+	got := slots[0]
+	if !got.Start.Equal(start.Add(time.Hour)) || !got.End.Equal(start.Add(2*time.Hour)) || got.Capacity != 3 ||
+		got.Location != "C8" || got.VideoURL != "https://meet.example.com/x" || strings.Join(got.Evaluators, ",") != "alice" {
+		t.Errorf("updated slot = %+v", got)
+	}
+	if strings.Join(got.Teams, ",") != "Team 1" || got.Block != "b" {
+		t.Errorf("update touched the bookings or block: %+v", got)
+	}
+
+	if err := l.Update(&Slot{ID: "missing"}); err == nil {
+		t.Error("updated a missing slot")
+	}
+}
+
+func TestLocalCreateSameSlotTwice(t *testing.T) {
+	l := newLocal(t)
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+	planned := func() *Slot {
+		return &Slot{Start: start, End: start.Add(time.Hour), Capacity: 1, Location: "C7", Block: "b"}
+	}
+
+	first := planned()
+	if err := l.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reserve("Team 1", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	again := planned()
+	if err := l.Create(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("created again as %s, want %s", again.ID, first.ID)
+	}
+	if slots, _ := l.Slots(); len(slots) != 1 || !slots[0].Has("Team 1") {
+		t.Errorf("slots = %+v, want the one booked slot", slots)
+	}
+
+	if err := l.Delete(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Create(planned()); err != nil {
+		t.Fatal(err)
+	}
+	if slots, _ := l.Slots(); len(slots) != 1 || len(slots[0].Teams) != 0 {
+		t.Errorf("slots = %+v, want the deleted slot back and free", slots)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := l.Create(&Slot{Start: start, End: start.Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if slots, _ := l.Slots(); len(slots) != 3 {
+		t.Errorf("got %d slots, want slots without a block created every time", len(slots))
+	}
+}
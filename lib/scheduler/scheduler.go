@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ramin0/submit/config"
+)
+
+var (
+	// ErrSlotTaken var
+	ErrSlotTaken = fmt.Errorf("slot already reserved")
+)
+
+// Slot struct
+type Slot struct {
+	ID         string
+	Start      time.Time
+	End        time.Time
+	Teams      []string
+	Capacity   int
+	Location   string
+	VideoURL   string
+	Evaluators []string
+	Block      string
+}
+
+// Free func
+func (s *Slot) Free() bool {
+	return s.Remaining() > 0
+}
+
+// Remaining func
+func (s *Slot) Remaining() int {
+	capacity := s.Capacity
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return capacity - len(s.Teams)
+}
+
+// Has func
+func (s *Slot) Has(teamName string) bool {
+	for _, team := range s.Teams {
+		if team == teamName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasEvaluator func
+func (s *Slot) HasEvaluator(evaluator string) bool {
+	for _, e := range s.Evaluators {
+		if strings.EqualFold(e, evaluator) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Key identifies a generated slot by its block, start and track, so creating
+// the same slot twice can be detected.
+func (s *Slot) Key() string {
+	return fmt.Sprintf("%s/%d/%s/%s", s.Block, s.Start.Unix(), s.Location, strings.Join(s.Evaluators, ","))
+}
+
+// keyID is the ID a slot with a block is created under, so the backends can
+// tell the same slot is being created again with a direct lookup.
+func (s *Slot) keyID() string {
+	sum := sha1.Sum([]byte(s.Key()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Slot) without(teamName string) []string {
+	teams := []string{}
+	for _, team := range s.Teams {
+		if team != teamName {
+			teams = append(teams, team)
+		}
+	}
+
+	return teams
+}
+
+// EvaluationScheduler interface
+type EvaluationScheduler interface {
+	// Slots lists every slot of the evaluation window, reserved or not,
+	// ordered by start time.
+	Slots() ([]*Slot, error)
+
+	// FreeSlots lists the slots of the evaluation window that still have room
+	// and have not started yet, ordered by start time.
+	FreeSlots() ([]*Slot, error)
+
+	// TeamSlot returns the slot the team is booked into, or nil.
+	TeamSlot(teamName string) (*Slot, error)
+
+	// Reserve moves the team into the slot, releasing whichever slot it held
+	// before. It fails with ErrSlotTaken if the slot is full already.
+	//
+	// Reservations are serialized within the process. The Google and CalDAV
+	// backends also send the ETag they read with every write, so they stay
+	// safe with several instances; the local backend assumes a single one.
+	Reserve(teamName, slotID string) error
+
+	// Release removes the team from whichever slot it is booked into.
+	Release(teamName string) error
+
+	// Create adds a new free slot. A slot with a Block gets an ID derived
+	// from its Key; if that slot exists already, Create leaves it alone and
+	// just sets slot.ID, so retried jobs and resubmitted plans don't
+	// duplicate slots.
+	Create(slot *Slot) error
+
+	// Update changes the time, capacity, location, video link and evaluators
+	// of a slot, leaving its bookings alone.
+	Update(slot *Slot) error
+
+	// Delete removes a slot.
+	Delete(slotID string) error
+}
+
+// Get func
+func Get() EvaluationScheduler {
+	switch config.EvaluationsBackend {
+	case "local":
+		return &localScheduler{}
+	case "caldav":
+		return &caldavScheduler{}
+	default:
+		return &googleScheduler{}
+	}
+}
+
+func window() (time.Time, time.Time) {
+	timeMin, _ := time.Parse(time.RFC3339, config.EvaluationsWeekStart)
+	timeMax, _ := time.Parse(time.RFC3339, config.EvaluationsWeekEnd)
+
+	return timeMin, timeMax
+}
+
+func sortSlots(slots []*Slot) {
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+}
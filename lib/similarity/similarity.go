@@ -0,0 +1,231 @@
+package similarity
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// File struct
+type File struct {
+	Name    string
+	Content string
+
+	fingerprints []fingerprint
+}
+
+// Document struct
+type Document struct {
+	Team  string
+	Files []*File
+
+	hashes map[uint64]bool
+}
+
+// Match struct
+type Match struct {
+	FileA  string
+	FileB  string
+	LinesA []int
+	LinesB []int
+}
+
+// Pair struct
+type Pair struct {
+	TeamA        string
+	TeamB        string
+	Score        float64
+	Shared       int
+	Fingerprints []uint64
+	Matches      []*Match
+}
+
+// Percent func
+func (p *Pair) Percent() int {
+	return int(p.Score*100 + 0.5)
+}
+
+type fingerprint struct {
+	hash  uint64
+	start int
+	end   int
+}
+
+// Fingerprint func
+func (d *Document) Fingerprint(k, w int) {
+	d.hashes = map[uint64]bool{}
+
+	for _, f := range d.Files {
+		f.fingerprints = winnow(tokenize(f.Content), k, w)
+		for _, fp := range f.fingerprints {
+			d.hashes[fp.hash] = true
+		}
+	}
+}
+
+// Compare func
+func Compare(a, b *Document) *Pair {
+	shared := map[uint64]bool{}
+	for h := range a.hashes {
+		if b.hashes[h] {
+			shared[h] = true
+		}
+	}
+
+	pair := &Pair{
+		TeamA:  a.Team,
+		TeamB:  b.Team,
+		Shared: len(shared),
+	}
+
+	smaller := len(a.hashes)
+	if len(b.hashes) < smaller {
+		smaller = len(b.hashes)
+	}
+	if smaller == 0 || len(shared) == 0 {
+		return pair
+	}
+	pair.Score = float64(len(shared)) / float64(smaller)
+
+	for h := range shared {
+		pair.Fingerprints = append(pair.Fingerprints, h)
+	}
+	sort.Slice(pair.Fingerprints, func(i, j int) bool {
+		return pair.Fingerprints[i] < pair.Fingerprints[j]
+	})
+
+	for _, fa := range a.Files {
+		for _, fb := range b.Files {
+			linesA, linesB := matchedLines(fa, fb, shared)
+			if len(linesA) == 0 {
+				continue
+			}
+
+			pair.Matches = append(pair.Matches, &Match{
+				FileA:  fa.Name,
+				FileB:  fb.Name,
+				LinesA: linesA,
+				LinesB: linesB,
+			})
+		}
+	}
+
+	sort.Slice(pair.Matches, func(i, j int) bool {
+		return len(pair.Matches[i].LinesA) > len(pair.Matches[j].LinesA)
+	})
+
+	return pair
+}
+
+// CompareAll func
+func CompareAll(docs []*Document, threshold float64) []*Pair {
+	pairs := []*Pair{}
+	for i := 0; i < len(docs); i++ {
+		for j := i + 1; j < len(docs); j++ {
+			if pair := Compare(docs[i], docs[j]); pair.Score >= threshold && pair.Shared > 0 {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+
+	return pairs
+}
+
+func winnow(tokens []token, k, w int) []fingerprint {
+	if k < 1 {
+		k = 1
+	}
+	if w < 1 {
+		w = 1
+	}
+	if len(tokens) < k {
+		return nil
+	}
+
+	grams := make([]fingerprint, 0, len(tokens)-k+1)
+	for i := 0; i+k <= len(tokens); i++ {
+		hasher := fnv.New64a()
+		for _, t := range tokens[i : i+k] {
+			hasher.Write([]byte(t.text))
+			hasher.Write([]byte{0})
+		}
+		grams = append(grams, fingerprint{hasher.Sum64(), tokens[i].line, tokens[i+k-1].line})
+	}
+
+	if len(grams) <= w {
+		return []fingerprint{minimum(grams)}
+	}
+
+	result := []fingerprint{}
+	last := -1
+	for i := 0; i+w <= len(grams); i++ {
+		m := i
+		for j := i; j < i+w; j++ {
+			if grams[j].hash <= grams[m].hash {
+				m = j
+			}
+		}
+		if m != last {
+			result = append(result, grams[m])
+			last = m
+		}
+	}
+
+	return result
+}
+
+func minimum(grams []fingerprint) fingerprint {
+	m := grams[0]
+	for _, g := range grams[1:] {
+		if g.hash <= m.hash {
+			m = g
+		}
+	}
+	return m
+}
+
+func matchedLines(a, b *File, shared map[uint64]bool) ([]int, []int) {
+	inA, inB := map[uint64]bool{}, map[uint64]bool{}
+	for _, fp := range a.fingerprints {
+		inA[fp.hash] = shared[fp.hash]
+	}
+	for _, fp := range b.fingerprints {
+		inB[fp.hash] = shared[fp.hash]
+	}
+
+	linesA, linesB := map[int]bool{}, map[int]bool{}
+	for _, fp := range a.fingerprints {
+		if inA[fp.hash] && inB[fp.hash] {
+			for line := fp.start; line <= fp.end; line++ {
+				linesA[line] = true
+			}
+		}
+	}
+	for _, fp := range b.fingerprints {
+		if inA[fp.hash] && inB[fp.hash] {
+			for line := fp.start; line <= fp.end; line++ {
+				linesB[line] = true
+			}
+		}
+	}
+
+	return sortedLines(linesA), sortedLines(linesB)
+}
+
+func sortedLines(lines map[int]bool) []int {
+	result := make([]int, 0, len(lines))
+	for line := range lines {
+		result = append(result, line)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// Lines func
+func Lines(content string) []string {
+	return strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n")
+}
@@ -0,0 +1,114 @@
+package similarity
+
+import (
+	"strings"
+	"testing"
+)
+
+const original = `func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+`
+
+func document(team string, files map[string]string) *Document {
+	d := &Document{Team: team}
+	for name, content := range files {
+		d.Files = append(d.Files, &File{Name: name, Content: content})
+	}
+	d.Fingerprint(5, 4)
+
+	return d
+}
+
+func TestWinnow(t *testing.T) {
+	tokens := tokenize(original)
+
+	for _, tc := range []struct {
+		name string
+		k, w int
+		min  int
+		max  int
+	}{
+		{"every gram", 5, 1, len(tokens) - 4, len(tokens) - 4},
+		{"windows", 5, 4, (len(tokens) - 4) / 4, len(tokens) - 4},
+		{"one window", 5, 1000, 1, 1},
+		{"too short", len(tokens) + 1, 4, 0, 0},
+	} {
+		fps := winnow(tokens, tc.k, tc.w)
+		if len(fps) < tc.min || len(fps) > tc.max {
+			t.Errorf("%s: got %d fingerprints, want %d to %d", tc.name, len(fps), tc.min, tc.max)
+		}
+		for _, fp := range fps {
+			if fp.start < 1 || fp.end < fp.start || fp.end > 7 {
+				t.Errorf("%s: fingerprint spans lines %d-%d", tc.name, fp.start, fp.end)
+			}
+		}
+	}
+
+	// Every window of w grams contributes a fingerprint, so a shared run of
+	// w+k-1 tokens is always caught.
+	fps := winnow(tokens, 5, 4)
+	for i := 0; i+4 <= len(tokens)-4; i++ {
+		found := false
+		for _, fp := range fps {
+			if fp.start >= tokens[i].line && fp.end <= tokens[i+4+3].line {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("window at token %d has no fingerprint", i)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	renamed := strings.NewReplacer("sum", "add", "values", "xs", "total", "acc", "v", "x").Replace(original)
+	other := `class Stack:
+    def push(self, item):
+        self.items.append(item)
+`
+
+	a := document("Team 1", map[string]string{"sum.go": original})
+	b := document("Team 2", map[string]string{"add.go": "// Adds things up.\n\n" + renamed})
+	c := document("Team 3", map[string]string{"stack.py": other})
+
+	pair := Compare(a, b)
+	if pair.Percent() != 100 || len(pair.Matches) != 1 {
+		t.Fatalf("renamed copy: got %d%% and %d matches", pair.Percent(), len(pair.Matches))
+	}
+
+	m := pair.Matches[0]
+	if m.FileA != "sum.go" || m.FileB != "add.go" {
+		t.Errorf("match between %s and %s", m.FileA, m.FileB)
+	}
+	if m.LinesA[0] != 1 || m.LinesB[0] != 3 {
+		t.Errorf("matched lines start at %d and %d, want 1 and 3", m.LinesA[0], m.LinesB[0])
+	}
+
+	if pair := Compare(a, c); pair.Score > 0.2 {
+		t.Errorf("unrelated files scored %d%%", pair.Percent())
+	}
+
+	pairs := CompareAll([]*Document{a, b, c}, 0.5)
+	if len(pairs) != 1 || pairs[0].TeamA != "Team 1" || pairs[0].TeamB != "Team 2" {
+		t.Errorf("CompareAll flagged %v", pairs)
+	}
+}
+
+func TestMatchedLinesAfterEscapedNewline(t *testing.T) {
+	prefix := "msg := \"one \\\ntwo\"\n"
+	a := document("Team 1", map[string]string{"a.go": prefix + original})
+	b := document("Team 2", map[string]string{"b.go": original})
+
+	pair := Compare(a, b)
+	if len(pair.Matches) != 1 {
+		t.Fatalf("got %d matches", len(pair.Matches))
+	}
+	if got := pair.Matches[0].LinesA; got[0] != 3 || got[len(got)-1] > 9 {
+		t.Errorf("matched lines %v, want them within 3-9", got)
+	}
+}
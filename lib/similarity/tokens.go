@@ -0,0 +1,96 @@
+package similarity
+
+import (
+	"strings"
+	"unicode"
+)
+
+var (
+	keywords = map[string]bool{}
+)
+
+func init() {
+	for _, k := range strings.Fields(`
+		abstract and as assert async await bool boolean break byte case catch char
+		class const continue def default defer del delete do double elif else enum
+		except export extends extern false final finally float for foreach from func
+		function go goto if implements import in instanceof int interface is lambda
+		let long map namespace new nil none not null or package pass private
+		protected public raise range return select self short signed sizeof static
+		string struct super switch synchronized template this throw throws true try
+		type typedef typeof union unsigned using var void volatile while with yield
+	`) {
+		keywords[k] = true
+	}
+}
+
+type token struct {
+	text string
+	line int
+}
+
+func tokenize(src string) []token {
+	tokens := []token{}
+	runes := []rune(src)
+	line := 1
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/', r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i += 2
+		case r == '"' || r == '\'' || r == '`':
+			start := line
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, token{"S", start})
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || unicode.IsLetter(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{"N", line})
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			word := strings.ToLower(string(runes[i:j]))
+			if !keywords[word] {
+				word = "V"
+			}
+			tokens = append(tokens, token{word, line})
+			i = j
+		default:
+			tokens = append(tokens, token{string(r), line})
+			i++
+		}
+	}
+
+	return tokens
+}
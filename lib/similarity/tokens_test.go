@@ -0,0 +1,32 @@
+package similarity
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, tc := range []struct {
+		name, src, want string
+	}{
+		{"identifiers and keywords", "int total = count + 1;", "int@1 V@1 =@1 V@1 +@1 N@1 ;@1"},
+		{"renaming doesn't matter", "int sum = n + 2;", "int@1 V@1 =@1 V@1 +@1 N@1 ;@1"},
+		{"line comments", "x = 1 // note\n# more\ny", "V@1 =@1 N@1 V@3"},
+		{"block comments", "a /* one\ntwo */ b", "V@1 V@2"},
+		{"strings", `s = "a \" b"; t`, "V@1 =@1 S@1 ;@1 V@1"},
+		{"multiline strings", "s = `a\nb`\nt", "V@1 =@1 S@1 V@3"},
+		{"escaped newline in a string", "s = \"a\\\nb\"\nt", "V@1 =@1 S@1 V@3"},
+		{"backslash at the end", `s = "a\`, "V@1 =@1 S@1"},
+		{"numbers", "3.14 0x1F", "N@1 N@1"},
+	} {
+		got := []string{}
+		for _, tok := range tokenize(tc.src) {
+			got = append(got, fmt.Sprintf("%s@%d", tok.text, tok.line))
+		}
+
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("%s: got  %s\nwant %s", tc.name, strings.Join(got, " "), tc.want)
+		}
+	}
+}
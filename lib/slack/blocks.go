@@ -0,0 +1,294 @@
+package slack
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxSectionText is the most characters Slack accepts in the text of a
+	// section or context element.
+	MaxSectionText = 3000
+	// MaxFieldText is the most characters Slack accepts in a section field.
+	MaxFieldText = 2000
+
+	// ResponseEphemeral const
+	ResponseEphemeral = "ephemeral"
+	// ResponseInChannel const
+	ResponseInChannel = "in_channel"
+
+	// StylePrimary const
+	StylePrimary = "primary"
+	// StyleDanger const
+	StyleDanger = "danger"
+)
+
+// Message struct
+type Message struct {
+	ResponseType    string  `json:"response_type,omitempty"`
+	ReplaceOriginal bool    `json:"replace_original,omitempty"`
+	Text            string  `json:"text,omitempty"`
+	Blocks          []Block `json:"blocks,omitempty"`
+}
+
+// Block is one of Section, Context, Actions or Divider.
+type Block interface {
+	block()
+}
+
+// Element is one of Button or Overflow.
+type Element interface {
+	element()
+}
+
+// Text struct
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Section struct
+type Section struct {
+	BlockID   string  `json:"block_id,omitempty"`
+	Text      *Text   `json:"text,omitempty"`
+	Fields    []*Text `json:"fields,omitempty"`
+	Accessory Element `json:"accessory,omitempty"`
+}
+
+// Context struct
+type Context struct {
+	BlockID  string  `json:"block_id,omitempty"`
+	Elements []*Text `json:"elements"`
+}
+
+// Actions struct
+type Actions struct {
+	BlockID  string    `json:"block_id,omitempty"`
+	Elements []Element `json:"elements"`
+}
+
+// Divider struct
+type Divider struct{}
+
+// Button struct
+type Button struct {
+	ActionID string `json:"action_id"`
+	Text     *Text  `json:"text"`
+	Value    string `json:"value,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Style    string `json:"style,omitempty"`
+}
+
+// Overflow struct
+type Overflow struct {
+	ActionID string    `json:"action_id"`
+	Options  []*Option `json:"options"`
+}
+
+// Option struct
+type Option struct {
+	Text  *Text  `json:"text"`
+	Value string `json:"value"`
+}
+
+// NewMessage returns a message with the given fallback text, shown in
+// notifications, and blocks.
+func NewMessage(text string, blocks ...Block) *Message {
+	return &Message{Text: text, Blocks: blocks}
+}
+
+// Ephemeral func
+func (m *Message) Ephemeral() *Message {
+	m.ResponseType = ResponseEphemeral
+	return m
+}
+
+// Add func
+func (m *Message) Add(blocks ...Block) *Message {
+	m.Blocks = append(m.Blocks, blocks...)
+	return m
+}
+
+// Markdown func
+func Markdown(text string) *Text {
+	return &Text{Type: "mrkdwn", Text: text}
+}
+
+// Plain func
+func Plain(text string) *Text {
+	return &Text{Type: "plain_text", Text: text}
+}
+
+// NewSection returns a section with the given text, or with no text when it is
+// empty, as Slack rejects empty text objects. Text over MaxSectionText is
+// truncated; use NewSections to keep all of it.
+func NewSection(text string) *Section {
+	if text == "" {
+		return &Section{}
+	}
+
+	return &Section{Text: Markdown(truncate(text, MaxSectionText))}
+}
+
+// NewSections returns as many sections as it takes to show the text, split at
+// line breaks or spaces where possible.
+func NewSections(text string) []Block {
+	sections := []Block{}
+	for _, chunk := range split(text, MaxSectionText) {
+		sections = append(sections, NewSection(chunk))
+	}
+
+	return sections
+}
+
+// Field adds a field with a bold title to the section.
+func (s *Section) Field(title, value string) *Section {
+	s.Fields = append(s.Fields, Markdown(truncate("*"+title+"*\n"+value, MaxFieldText)))
+	return s
+}
+
+// With sets the element shown next to the section's text.
+func (s *Section) With(accessory Element) *Section {
+	s.Accessory = accessory
+	return s
+}
+
+// NewContext func
+func NewContext(texts ...string) *Context {
+	context := &Context{}
+	for _, text := range texts {
+		context.Elements = append(context.Elements, Markdown(truncate(text, MaxSectionText)))
+	}
+
+	return context
+}
+
+// NewActions func
+func NewActions(elements ...Element) *Actions {
+	return &Actions{Elements: elements}
+}
+
+// NewButton func
+func NewButton(actionID, text, value string) *Button {
+	return &Button{ActionID: actionID, Text: Plain(text), Value: value}
+}
+
+// Primary func
+func (b *Button) Primary() *Button {
+	b.Style = StylePrimary
+	return b
+}
+
+// Danger func
+func (b *Button) Danger() *Button {
+	b.Style = StyleDanger
+	return b
+}
+
+// NewOverflow func
+func NewOverflow(actionID string) *Overflow {
+	return &Overflow{ActionID: actionID}
+}
+
+// Option adds an option to the overflow menu.
+func (o *Overflow) Option(text, value string) *Overflow {
+	o.Options = append(o.Options, &Option{Text: Plain(text), Value: value})
+	return o
+}
+
+// truncate cuts text to at most max characters, ending it with an ellipsis.
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	return string([]rune(text)[:max-1]) + "…"
+}
+
+// split cuts text into chunks of at most max characters, breaking after the
+// last line break in a chunk, or else the last space, or else anywhere.
+func split(text string, max int) []string {
+	chunks := []string{}
+	for runes := []rune(text); len(runes) > 0; {
+		if len(runes) <= max {
+			chunks = append(chunks, string(runes))
+			break
+		}
+
+		chunk := string(runes[:max])
+		cut := strings.LastIndex(chunk, "\n")
+		if cut <= 0 {
+			cut = strings.LastIndex(chunk, " ")
+		}
+		if cut <= 0 {
+			cut = len(chunk)
+		} else {
+			cut++
+		}
+
+		chunks = append(chunks, strings.TrimRight(chunk[:cut], "\n "))
+		runes = runes[utf8.RuneCountInString(chunk[:cut]):]
+	}
+
+	return chunks
+}
+
+func (*Section) block() {}
+func (*Context) block() {}
+func (*Actions) block() {}
+func (*Divider) block() {}
+
+func (*Button) element()   {}
+func (*Overflow) element() {}
+
+// MarshalJSON func
+func (s *Section) MarshalJSON() ([]byte, error) {
+	type section Section
+	return withType("section", (*section)(s))
+}
+
+// MarshalJSON func
+func (c *Context) MarshalJSON() ([]byte, error) {
+	type context Context
+	return withType("context", (*context)(c))
+}
+
+// MarshalJSON func
+func (a *Actions) MarshalJSON() ([]byte, error) {
+	type actions Actions
+	return withType("actions", (*actions)(a))
+}
+
+// MarshalJSON func
+func (d *Divider) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"divider"}`), nil
+}
+
+// MarshalJSON func
+func (b *Button) MarshalJSON() ([]byte, error) {
+	type button Button
+	return withType("button", (*button)(b))
+}
+
+// MarshalJSON func
+func (o *Overflow) MarshalJSON() ([]byte, error) {
+	type overflow Overflow
+	return withType("overflow", (*overflow)(o))
+}
+
+// withType marshals v with a "type" key added, which Slack uses to tell
+// blocks and elements apart.
+func withType(kind string, v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte(`{"type":"` + kind + `"`)
+	if len(b) > 2 {
+		out = append(out, ',')
+	}
+
+	return append(out, b[1:]...), nil
+}
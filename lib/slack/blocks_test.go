@@ -0,0 +1,87 @@
+package slack
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNewSectionTruncates(t *testing.T) {
+	section := NewSection(strings.Repeat("é", MaxSectionText+10))
+	if n := utf8.RuneCountInString(section.Text.Text); n != MaxSectionText {
+		t.Errorf("section text has %d characters, want %d", n, MaxSectionText)
+	}
+	if !strings.HasSuffix(section.Text.Text, "…") {
+		t.Error("truncated text doesn't end with an ellipsis")
+	}
+
+	if got := NewSection("short").Text.Text; got != "short" {
+		t.Errorf("short text = %q", got)
+	}
+	if NewSection("").Text != nil {
+		t.Error("empty section has a text object")
+	}
+}
+
+func TestFieldTruncates(t *testing.T) {
+	section := NewSection("").Field("Answer", strings.Repeat("a", 5000))
+	if n := utf8.RuneCountInString(section.Fields[0].Text); n != MaxFieldText {
+		t.Errorf("field has %d characters, want %d", n, MaxFieldText)
+	}
+}
+
+func TestNewSectionsSplits(t *testing.T) {
+	paragraph := strings.Repeat("word ", 300) + "\n"
+	text := "*Question*\n" + strings.Repeat(paragraph, 5)
+
+	sections := NewSections(text)
+	if len(sections) < 3 {
+		t.Fatalf("got %d sections", len(sections))
+	}
+
+	joined := []string{}
+	for _, block := range sections {
+		chunk := block.(*Section).Text.Text
+		if n := utf8.RuneCountInString(chunk); n > MaxSectionText {
+			t.Errorf("section of %d characters", n)
+		}
+		if strings.HasPrefix(chunk, " ") || strings.HasSuffix(chunk, " ") {
+			t.Errorf("section not split at a word boundary: %q...%q", chunk[:10], chunk[len(chunk)-10:])
+		}
+		joined = append(joined, chunk)
+	}
+
+	if got, want := strings.Fields(strings.Join(joined, " ")), strings.Fields(text); len(got) != len(want) {
+		t.Errorf("split lost words: got %d, want %d", len(got), len(want))
+	}
+
+	if sections := NewSections("short"); len(sections) != 1 || sections[0].(*Section).Text.Text != "short" {
+		t.Errorf("short text split into %v", sections)
+	}
+}
+
+func TestSplitWithoutSpaces(t *testing.T) {
+	chunks := split(strings.Repeat("x", 7), 3)
+	if strings.Join(chunks, "|") != "xxx|xxx|x" {
+		t.Errorf("got %v", chunks)
+	}
+}
+
+func TestMessageJSON(t *testing.T) {
+	message := NewMessage("fallback", NewSection("hi").With(NewButton("command.0", "Book", "slot book 1").Primary())).
+		Add(NewContext("note"), &Divider{})
+
+	b, err := json.Marshal(message.Ephemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"response_type":"ephemeral","text":"fallback","blocks":[` +
+		`{"type":"section","text":{"type":"mrkdwn","text":"hi"},"accessory":{"type":"button","action_id":"command.0","text":{"type":"plain_text","text":"Book"},"value":"slot book 1","style":"primary"}},` +
+		`{"type":"context","elements":[{"type":"mrkdwn","text":"note"}]},` +
+		`{"type":"divider"}]}`
+	if string(b) != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+}
@@ -14,15 +14,21 @@ import (
 	"github.com/ramin0/submit/config"
 )
 
-const (
+var (
 	slackBaseURL = "https://slack.com/api"
+)
+
+const (
+	slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
 
 	rChatPostEphemeral = "chat.postEphemeral"
 	rChatPostMessage   = "chat.postMessage"
 	rUsersAdminInvite  = "users.admin.invite"
 	rUsersInfo         = "users.info"
+	rUsersLookup       = "users.lookupByEmail"
 	rUsersList         = "users.list"
 	rRemindersAdd      = "reminders.add"
+	rOAuthAccess       = "oauth.v2.access"
 )
 
 // ChatPostEphemeral func
@@ -92,32 +98,58 @@ func UsersInfo(user string) ([]string, error) {
 	}, nil
 }
 
-// UsersList func
-func UsersList(fn func([]string)) error {
-	json, err := post(rUsersList, nil, config.SlackBotToken)
+// UsersLookupByEmail func
+func UsersLookupByEmail(email string) (string, error) {
+	data := url.Values{}
+	data.Add("email", email)
+
+	json, err := post(rUsersLookup, data, config.SlackBotToken)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	users, _ := json.S("members").Children()
-	for _, u := range users {
-		username := u.S("name").Data()
-		email := u.S("profile", "email").Data()
+	return fmt.Sprintf("%v", json.S("user", "id").Data()), nil
+}
 
-		if email == nil {
-			continue
+// UsersList calls fn with every member that has an email, following
+// response_metadata.next_cursor through all the pages.
+func UsersList(fn func([]string)) error {
+	cursor := ""
+	for {
+		data := url.Values{}
+		data.Add("limit", "200")
+		if cursor != "" {
+			data.Add("cursor", cursor)
 		}
 
-		fn([]string{
-			fmt.Sprintf("%v", username),
-			fmt.Sprintf("%v", email),
-			fmt.Sprintf("%v", u.S("profile", "display_name").Data()),
-			fmt.Sprintf("%v", u.S("real_name").Data()),
-			fmt.Sprintf("%v", u.S("id").Data()),
-		})
-	}
+		json, err := post(rUsersList, data, config.SlackBotToken)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		users, _ := json.S("members").Children()
+		for _, u := range users {
+			username := u.S("name").Data()
+			email := u.S("profile", "email").Data()
+
+			if email == nil {
+				continue
+			}
+
+			fn([]string{
+				fmt.Sprintf("%v", username),
+				fmt.Sprintf("%v", email),
+				fmt.Sprintf("%v", u.S("profile", "display_name").Data()),
+				fmt.Sprintf("%v", u.S("real_name").Data()),
+				fmt.Sprintf("%v", u.S("id").Data()),
+			})
+		}
+
+		cursor, _ = json.S("response_metadata", "next_cursor").Data().(string)
+		if cursor == "" {
+			return nil
+		}
+	}
 }
 
 // RemindersAdd func
@@ -134,6 +166,40 @@ func RemindersAdd(user, text string, trigger time.Duration) error {
 	return nil
 }
 
+// OAuthAuthorizeURL returns where to send a user to connect their Slack
+// account; Slack redirects back to redirectURI with a code and the state.
+func OAuthAuthorizeURL(redirectURI, state string) string {
+	query := url.Values{}
+	query.Add("client_id", config.SlackClientID)
+	query.Add("user_scope", "identity.basic")
+	query.Add("redirect_uri", redirectURI)
+	query.Add("state", state)
+
+	return slackAuthorizeURL + "?" + query.Encode()
+}
+
+// OAuthAccess exchanges the code Slack redirected back with for the ID of the
+// user who authorized.
+func OAuthAccess(code, redirectURI string) (string, error) {
+	data := url.Values{}
+	data.Add("client_id", config.SlackClientID)
+	data.Add("client_secret", config.SlackClientSecret)
+	data.Add("code", code)
+	data.Add("redirect_uri", redirectURI)
+
+	json, err := post(rOAuthAccess, data, "")
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := json.S("authed_user", "id").Data().(string)
+	if !ok || id == "" {
+		return "", fmt.Errorf("missing authed user")
+	}
+
+	return id, nil
+}
+
 // WebhookResponse func
 func WebhookResponse(url string, message interface{}) error {
 	if _, err := post(url, nil, config.SlackBotToken, message); err != nil {
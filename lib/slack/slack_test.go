@@ -0,0 +1,40 @@
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUsersListFollowsCursor(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"ok":true,"members":[{"id":"U1","name":"one","profile":{"email":"one@example.com"}},{"id":"B1","name":"bot","profile":{}}],"response_metadata":{"next_cursor":"p2"}}`,
+		"p2": `{"ok":true,"members":[{"id":"U2","name":"two","profile":{"email":"two@example.com"}}],"response_metadata":{"next_cursor":""}}`,
+	}
+
+	cursors := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.FormValue("cursor")
+		cursors = append(cursors, cursor)
+		fmt.Fprint(w, pages[cursor])
+	}))
+	defer server.Close()
+
+	old := slackBaseURL
+	slackBaseURL = server.URL
+	defer func() { slackBaseURL = old }()
+
+	ids := []string{}
+	if err := UsersList(func(member []string) { ids = append(ids, member[4]) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(ids, "|") != "U1|U2" {
+		t.Errorf("got members %v, want U1|U2", ids)
+	}
+	if strings.Join(cursors, "|") != "|p2" {
+		t.Errorf("requested cursors %q", cursors)
+	}
+}
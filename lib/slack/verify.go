@@ -0,0 +1,70 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxBodySize is the largest request body read from Slack.
+	MaxBodySize = 1 << 20
+
+	signatureVersion = "v0"
+
+	headerSignature = "X-Slack-Signature"
+	headerTimestamp = "X-Slack-Request-Timestamp"
+)
+
+var (
+	// ErrInvalidSignature err
+	ErrInvalidSignature = errors.New("invalid request signature")
+	// ErrStaleRequest err
+	ErrStaleRequest = errors.New("request timestamp is too old")
+)
+
+// VerifyRequest checks the signature Slack sends along with every request
+// against the signing secret, and rejects requests whose timestamp is more
+// than maxAge away from now so a captured request can't be replayed. The body
+// is read, up to MaxBodySize, and put back, and returned for decoding.
+func VerifyRequest(r *http.Request, secret string, maxAge time.Duration) ([]byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, MaxBodySize))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	timestamp := r.Header.Get(headerTimestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > maxAge || age < -maxAge {
+		return nil, ErrStaleRequest
+	}
+
+	if !hmac.Equal([]byte(r.Header.Get(headerSignature)), []byte(Sign(secret, timestamp, body))) {
+		return nil, ErrInvalidSignature
+	}
+
+	return body, nil
+}
+
+// Sign returns the signature of a request body sent at the given timestamp,
+// in the format of the X-Slack-Signature header.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signatureVersion + ":" + timestamp + ":"))
+	mac.Write(body)
+
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
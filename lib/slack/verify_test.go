@@ -0,0 +1,93 @@
+package slack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signedRequest returns a request signed with testSecret at the given time.
+func signedRequest(body string, at time.Time) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	r.Header.Set(headerTimestamp, timestamp)
+	r.Header.Set(headerSignature, Sign(testSecret, timestamp, []byte(body)))
+
+	return r
+}
+
+// Slack's documented example request.
+func TestSign(t *testing.T) {
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	want := "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+
+	if got := Sign(testSecret, "1531420618", []byte(body)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestVerifyRequestValid(t *testing.T) {
+	r := signedRequest("command=%2Fsubmit&text=help", time.Now())
+
+	body, err := VerifyRequest(r, testSecret, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "command=%2Fsubmit&text=help" {
+		t.Errorf("body = %q", body)
+	}
+
+	// The body is put back for handlers that read it again.
+	again, _ := ioutil.ReadAll(r.Body)
+	if string(again) != string(body) {
+		t.Errorf("body read again = %q", again)
+	}
+}
+
+func TestVerifyRequestTamperedBody(t *testing.T) {
+	r := signedRequest("command=%2Fsubmit&text=help", time.Now())
+	r.Body = ioutil.NopCloser(strings.NewReader("command=%2Fsubmit&text=grades"))
+
+	if _, err := VerifyRequest(r, testSecret, 5*time.Minute); err != ErrInvalidSignature {
+		t.Errorf("VerifyRequest = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRequestWrongSecret(t *testing.T) {
+	r := signedRequest("text=help", time.Now())
+
+	if _, err := VerifyRequest(r, "another secret", 5*time.Minute); err != ErrInvalidSignature {
+		t.Errorf("VerifyRequest = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRequestStaleTimestamp(t *testing.T) {
+	for _, at := range []time.Time{time.Now().Add(-10 * time.Minute), time.Now().Add(10 * time.Minute)} {
+		r := signedRequest("text=help", at)
+		if _, err := VerifyRequest(r, testSecret, 5*time.Minute); err != ErrStaleRequest {
+			t.Errorf("VerifyRequest at %v = %v, want ErrStaleRequest", at, err)
+		}
+	}
+}
+
+func TestVerifyRequestMissingHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("text=help"))
+
+	if _, err := VerifyRequest(r, testSecret, 5*time.Minute); err != ErrInvalidSignature {
+		t.Errorf("VerifyRequest = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRequestBodyTooLarge(t *testing.T) {
+	r := signedRequest(strings.Repeat("a", MaxBodySize+1), time.Now())
+
+	if _, err := VerifyRequest(r, testSecret, 5*time.Minute); err == nil {
+		t.Error("VerifyRequest read a body over MaxBodySize")
+	}
+}
@@ -0,0 +1,331 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Each collection is a snapshot file, collection.json, plus a log of the
+// puts and deletes made since, collection.log. Writes append one line to the
+// log; the log is folded into a new snapshot once it outgrows the
+// collection.
+const (
+	compactMinEntries = 256
+)
+
+var (
+	root        string
+	collections = map[string]*coll{}
+	lock        sync.Mutex
+)
+
+type coll struct {
+	entries map[string]json.RawMessage
+	log     *os.File
+	logged  int
+}
+
+type logEntry struct {
+	Key     string          `json:"k"`
+	Value   json.RawMessage `json:"v,omitempty"`
+	Deleted bool            `json:"d,omitempty"`
+}
+
+// Open sets the directory the collections live in, creating it if needed,
+// and drops whatever was loaded from the previous one. It must be called
+// before any other function of the package.
+func Open(path string) error {
+	if path == "" {
+		return fmt.Errorf("Store path is not set")
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, c := range collections {
+		if c.log != nil {
+			c.log.Close()
+		}
+	}
+
+	root = path
+	collections = map[string]*coll{}
+
+	return nil
+}
+
+// Get func
+func Get(collection, key string, v interface{}) (bool, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return get(collection, key, v)
+}
+
+// Put func
+func Put(collection, key string, v interface{}) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return put(collection, key, v)
+}
+
+// Update func
+//
+// Update loads key into v (if present), calls fn and stores v back unless fn
+// returns an error. The collection stays locked throughout, so fn must not
+// call back into the store.
+func Update(collection, key string, v interface{}, fn func(found bool) error) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	found, err := get(collection, key, v)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(found); err != nil {
+		return err
+	}
+
+	return put(collection, key, v)
+}
+
+// Delete func
+func Delete(collection, key string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	c, err := load(collection)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := c.entries[key]; !ok {
+		return nil
+	}
+
+	if err := c.append(collection, logEntry{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+
+	delete(c.entries, key)
+	return nil
+}
+
+// Keys func
+func Keys(collection string) ([]string, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	c, err := load(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// All func
+//
+// All decodes the whole collection into v, which should be a pointer to a
+// map keyed by string.
+func All(collection string, v interface{}) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	c, err := load(collection)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func get(collection, key string, v interface{}) (bool, error) {
+	c, err := load(collection)
+	if err != nil {
+		return false, err
+	}
+
+	raw, ok := c.entries[key]
+	if !ok {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(raw, v)
+}
+
+func put(collection, key string, v interface{}) error {
+	c, err := load(collection)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := c.append(collection, logEntry{Key: key, Value: raw}); err != nil {
+		return err
+	}
+
+	c.entries[key] = raw
+	return nil
+}
+
+func load(collection string) (*coll, error) {
+	if c, ok := collections[collection]; ok {
+		return c, nil
+	}
+	if root == "" {
+		return nil, fmt.Errorf("Store is not open")
+	}
+
+	c := &coll{entries: map[string]json.RawMessage{}}
+
+	b, err := ioutil.ReadFile(snapshotPath(collection))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err = ioutil.ReadFile(logPath(collection))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// A crash can leave the last line half written; everything before it
+	// was appended whole.
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, len(b)+1)
+	for scanner.Scan() {
+		var entry logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+
+		if entry.Deleted {
+			delete(c.entries, entry.Key)
+		} else {
+			c.entries[entry.Key] = entry.Value
+		}
+		c.logged++
+	}
+
+	// Starting from a fresh snapshot also drops a torn line, rather than
+	// appending after it.
+	if len(b) > 0 {
+		if err := c.compact(collection); err != nil {
+			return nil, err
+		}
+	}
+
+	collections[collection] = c
+	return c, nil
+}
+
+func (c *coll) append(collection string, entry logEntry) error {
+	if c.logged >= compactMinEntries && c.logged > 2*len(c.entries) {
+		if err := c.compact(collection); err != nil {
+			return err
+		}
+	}
+
+	if c.log == nil {
+		f, err := os.OpenFile(logPath(collection), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		c.log = f
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.log.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	c.logged++
+	return nil
+}
+
+// compact writes the collection to a new snapshot and empties the log. A
+// crash in between only means the log is replayed over a snapshot that
+// already has its changes.
+func (c *coll) compact(collection string) error {
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(root, collection+".json.")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), snapshotPath(collection)); err != nil {
+		return err
+	}
+
+	if c.log != nil {
+		c.log.Close()
+		c.log = nil
+	}
+	if err := os.Truncate(logPath(collection), 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	c.logged = 0
+	return nil
+}
+
+func snapshotPath(collection string) string {
+	return filepath.Join(root, collection+".json")
+}
+
+func logPath(collection string) string {
+	return filepath.Join(root, collection+".log")
+}
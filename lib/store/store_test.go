@@ -0,0 +1,155 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	Name  string
+	Count int
+}
+
+func open(t *testing.T) string {
+	dir := t.TempDir()
+	if err := Open(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// reopen drops what's in memory, so the next call reads the files again.
+func reopen(t *testing.T, dir string) {
+	if err := Open(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenRequiresAPath(t *testing.T) {
+	if err := Open(""); err == nil {
+		t.Error("Open accepted an empty path")
+	}
+}
+
+func TestPersistsAcrossRestarts(t *testing.T) {
+	dir := open(t)
+
+	Put("items", "a", &item{Name: "a", Count: 1})
+	Put("items", "b", &item{Name: "b", Count: 2})
+	Update("items", "a", &item{}, func(found bool) error { return nil })
+	Update("items", "c", &item{Name: "c"}, func(found bool) error {
+		return fmt.Errorf("not stored")
+	})
+	Delete("items", "b")
+
+	reopen(t, dir)
+
+	keys, err := Keys("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "a" {
+		t.Errorf("keys after reopening = %v, want [a]", keys)
+	}
+
+	got := &item{}
+	if found, err := Get("items", "a", got); !found || err != nil || got.Count != 1 {
+		t.Errorf("Get a = %v %v %+v", found, err, got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	open(t)
+
+	for _, tc := range []struct {
+		name  string
+		fn    func(v *item) func(bool) error
+		count int
+		found bool
+	}{
+		{"create", func(v *item) func(bool) error {
+			return func(found bool) error { v.Count = 1; return nil }
+		}, 1, true},
+		{"increment", func(v *item) func(bool) error {
+			return func(found bool) error { v.Count++; return nil }
+		}, 2, true},
+		{"abort", func(v *item) func(bool) error {
+			return func(found bool) error { v.Count = 100; return fmt.Errorf("no") }
+		}, 2, true},
+	} {
+		v := &item{}
+		Update("items", "a", v, tc.fn(v))
+
+		got := &item{}
+		found, _ := Get("items", "a", got)
+		if found != tc.found || got.Count != tc.count {
+			t.Errorf("%s: found %v, count %d; want %v, %d", tc.name, found, got.Count, tc.found, tc.count)
+		}
+	}
+}
+
+func TestWritesAppendToTheLog(t *testing.T) {
+	dir := open(t)
+
+	Put("items", "a", &item{Name: "a"})
+	snapshot, _ := ioutil.ReadFile(filepath.Join(dir, "items.json"))
+
+	Put("items", "b", &item{Name: "b"})
+	if again, _ := ioutil.ReadFile(filepath.Join(dir, "items.json")); string(again) != string(snapshot) {
+		t.Error("Put rewrote the snapshot")
+	}
+
+	log, _ := ioutil.ReadFile(filepath.Join(dir, "items.log"))
+	if lines := strings.Count(string(log), "\n"); lines != 2 {
+		t.Errorf("log has %d lines, want 2:\n%s", lines, log)
+	}
+}
+
+func TestCompactsTheLog(t *testing.T) {
+	dir := open(t)
+
+	for i := 0; i < 3*compactMinEntries; i++ {
+		Put("items", "a", &item{Count: i})
+	}
+
+	log, _ := ioutil.ReadFile(filepath.Join(dir, "items.log"))
+	if lines := strings.Count(string(log), "\n"); lines > compactMinEntries+1 {
+		t.Errorf("log has %d lines after compacting", lines)
+	}
+
+	reopen(t, dir)
+	got := &item{}
+	if Get("items", "a", got); got.Count != 3*compactMinEntries-1 {
+		t.Errorf("count = %d after compacting", got.Count)
+	}
+}
+
+func TestIgnoresATornLastLine(t *testing.T) {
+	dir := open(t)
+
+	Put("items", "a", &item{Count: 1})
+	reopen(t, dir)
+	Put("items", "b", &item{Count: 2})
+
+	f, _ := os.OpenFile(filepath.Join(dir, "items.log"), os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"k":"c","v":{"Cou`)
+	f.Close()
+
+	// The torn line is dropped, not followed by the next write.
+	reopen(t, dir)
+	Put("items", "d", &item{Count: 4})
+	reopen(t, dir)
+
+	keys, err := Keys("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "a,b,d" {
+		t.Errorf("keys = %v, want [a b d]", keys)
+	}
+}
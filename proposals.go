@@ -0,0 +1,493 @@
+package submit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	proposalCollection = "proposals"
+
+	proposalDraft            = "draft"
+	proposalSubmitted        = "submitted"
+	proposalChangesRequested = "changes-requested"
+	proposalApproved         = "approved"
+	proposalRejected         = "rejected"
+
+	jobProposalSheet = "proposals.sheet"
+)
+
+// Proposal struct
+type Proposal struct {
+	Team        string
+	TeamGroup   string
+	Questions   []string
+	Answers     map[string]string
+	Status      string
+	Revision    int
+	Late        bool
+	SubmittedAt time.Time
+	SubmittedBy string
+	UpdatedAt   time.Time
+	UpdatedBy   string
+	Assignees   []string
+	Versions    []*ProposalVersion
+	Comments    []*ProposalComment
+	Timeline    []*ProposalEvent
+}
+
+// ProposalVersion struct
+type ProposalVersion struct {
+	Number      int
+	Questions   []string
+	Answers     map[string]string
+	Late        bool
+	SubmittedAt time.Time
+	SubmittedBy string
+}
+
+// ProposalComment struct
+type ProposalComment struct {
+	Version  int
+	Question string
+	Author   string
+	Text     string
+	At       time.Time
+}
+
+// ProposalEvent struct
+type ProposalEvent struct {
+	At       time.Time
+	By       string
+	Status   string
+	Note     string
+	Override bool
+}
+
+// Submitted func
+func (p *Proposal) Submitted() bool {
+	return len(p.Versions) > 0
+}
+
+// Editable func
+func (p *Proposal) Editable() bool {
+	return p.Status == proposalDraft || p.Status == proposalChangesRequested
+}
+
+// Answer func
+func (p *Proposal) Answer(question string) string {
+	return p.Answers[question]
+}
+
+// Latest func
+func (p *Proposal) Latest() *ProposalVersion {
+	if len(p.Versions) == 0 {
+		return nil
+	}
+
+	return p.Versions[len(p.Versions)-1]
+}
+
+// Assigned func
+func (p *Proposal) Assigned(userName string) bool {
+	for _, assignee := range p.Assignees {
+		if strings.EqualFold(assignee, userName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CommentsOn returns the comments left on a question of a version; an empty
+// question stands for the comments on the proposal as a whole.
+func (p *Proposal) CommentsOn(version int, question string) []*ProposalComment {
+	comments := []*ProposalComment{}
+	for _, comment := range p.Comments {
+		if comment.Version == version && comment.Question == question {
+			comments = append(comments, comment)
+		}
+	}
+
+	return comments
+}
+
+// Answer func
+func (v *ProposalVersion) Answer(question string) string {
+	return v.Answers[question]
+}
+
+// display turns the latest submitted version of a proposal into what
+// /proposal and the Slack command show, taking the notes from the sheet.
+func (p *Proposal) display(sheet map[string]interface{}) map[string]interface{} {
+	latest := p.Latest()
+
+	qas := [][]string{}
+	for _, question := range latest.Questions {
+		qas = append(qas, []string{question, latest.Answers[question]})
+	}
+
+	proposal := map[string]interface{}{
+		"QAs":      qas,
+		"Notes":    "",
+		"Late":     "",
+		"Approved": p.Status == proposalApproved,
+		"Status":   p.Status,
+		"Version":  latest.Number,
+	}
+	if p.Late {
+		proposal["Late"] = "YES"
+	}
+	if sheet != nil {
+		proposal["Notes"] = sheet["Notes"]
+	}
+
+	return proposal
+}
+
+// proposalQuestions returns the configured questions, falling back to the
+// headers of the proposals sheet.
+func proposalQuestions() []string {
+	if len(config.ProposalsQuestions) > 0 {
+		return config.ProposalsQuestions
+	}
+
+	questions, _ := google.SheetsProposalQuestions()
+	return questions
+}
+
+func proposalDeadlinePassed() bool {
+	deadline, err := time.Parse(time.RFC3339, config.ProposalsDeadline)
+	return err == nil && time.Now().After(deadline)
+}
+
+func proposalFind(teamName string) *Proposal {
+	proposal := &Proposal{}
+	if found, _ := store.Get(proposalCollection, teamName, proposal); !found {
+		return &Proposal{
+			Team:      teamName,
+			Questions: proposalQuestions(),
+			Answers:   map[string]string{},
+			Status:    proposalDraft,
+		}
+	}
+
+	return proposal
+}
+
+func proposalAll(filter func(*Proposal) bool) ([]*Proposal, error) {
+	all := map[string]*Proposal{}
+	if err := store.All(proposalCollection, &all); err != nil {
+		return nil, err
+	}
+
+	proposals := []*Proposal{}
+	for _, proposal := range all {
+		if proposal.Submitted() && (filter == nil || filter(proposal)) {
+			proposals = append(proposals, proposal)
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		return proposals[i].SubmittedAt.Before(proposals[j].SubmittedAt)
+	})
+
+	return proposals, nil
+}
+
+// proposalSave stores the answers posted by a team member. The revision posted
+// along must match the stored one, so a member can't overwrite changes a
+// teammate saved in the meantime. Submitting keeps a copy of the answers as a
+// new version.
+func proposalSave(r *http.Request, user *User) error {
+	teamName := user.TeamName()
+	if teamName == "" {
+		return fmt.Errorf("You need to be in a team to submit a proposal")
+	}
+	action := r.FormValue("action")
+
+	revision, err := strconv.Atoi(r.FormValue("proposal[revision]"))
+	if err != nil {
+		return fmt.Errorf("Invalid revision")
+	}
+
+	// The questions may come from the sheet, which mustn't be read while the
+	// store is locked.
+	questions := proposalQuestions()
+
+	proposal := proposalFind(teamName)
+	err = store.Update(proposalCollection, teamName, proposal, func(found bool) error {
+		if !proposal.Editable() {
+			return fmt.Errorf("Your proposal can't be changed while it's %s", proposal.Status)
+		}
+		if proposal.Revision != revision {
+			return fmt.Errorf("A teammate saved changes in the meantime, reload the page to see them")
+		}
+		if proposal.Answers == nil {
+			proposal.Answers = map[string]string{}
+		}
+
+		proposal.Team = teamName
+		proposal.Questions = questions
+		for i, question := range proposal.Questions {
+			proposal.Answers[question] = strings.TrimSpace(r.FormValue(fmt.Sprintf("answer[%d]", i)))
+		}
+
+		now := time.Now()
+		if action == "submit" {
+			for _, question := range proposal.Questions {
+				if proposal.Answers[question] == "" {
+					return fmt.Errorf("Please answer %q before submitting", question)
+				}
+			}
+
+			answers := map[string]string{}
+			for question, answer := range proposal.Answers {
+				answers[question] = answer
+			}
+
+			version := &ProposalVersion{
+				Number:      len(proposal.Versions) + 1,
+				Questions:   proposal.Questions,
+				Answers:     answers,
+				Late:        proposalDeadlinePassed(),
+				SubmittedAt: now,
+				SubmittedBy: user.UserName,
+			}
+			if version.Number == 1 {
+				proposal.Late = version.Late
+				proposal.TeamGroup = user.TeamGroup()
+				proposal.Assignees = config.EvaluationsGroupEvaluators[proposal.TeamGroup]
+			}
+
+			proposal.Versions = append(proposal.Versions, version)
+			proposal.Status = proposalSubmitted
+			proposal.SubmittedAt = now
+			proposal.SubmittedBy = user.UserName
+			proposal.Timeline = append(proposal.Timeline, &ProposalEvent{
+				At:     now,
+				By:     user.UserName,
+				Status: proposalSubmitted,
+				Note:   fmt.Sprintf("Version %d", version.Number),
+			})
+		}
+
+		proposal.Revision++
+		proposal.UpdatedAt = now
+		proposal.UpdatedBy = user.UserName
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if action == "submit" {
+		invalidateProposal(teamName)
+		_, err = jobs.Enqueue(jobProposalSheet, map[string]string{"Team": teamName})
+	}
+
+	return err
+}
+
+// proposalReview records the comments and decision of a reviewer on the latest
+// version of a team's proposal. The version posted along must still be the
+// latest, so a reviewer can't decide on answers the team replaced since the
+// page was rendered. Like regrades, only the assignees may decide on an
+// assigned proposal, unless the reviewer overrides it, which is recorded.
+func proposalReview(r *http.Request, teamName, reviewer string) error {
+	action := r.FormValue("action")
+	version, _ := strconv.Atoi(r.FormValue("proposal[version]"))
+	override := r.FormValue("proposal[override]") == "on"
+
+	proposal := proposalFind(teamName)
+	err := store.Update(proposalCollection, teamName, proposal, func(found bool) error {
+		if !found || !proposal.Submitted() {
+			return fmt.Errorf("Couldn't find a proposal for %s", teamName)
+		}
+
+		if action == "assign" {
+			if !proposal.Assigned(reviewer) {
+				proposal.Assignees = append(proposal.Assignees, reviewer)
+			}
+			return nil
+		}
+
+		now := time.Now()
+		latest := proposal.Latest()
+		if latest.Number != version {
+			return fmt.Errorf("The team submitted version %d in the meantime, reload the page to review it", latest.Number)
+		}
+
+		comment := func(question, text string) {
+			if text = strings.TrimSpace(text); text != "" {
+				proposal.Comments = append(proposal.Comments, &ProposalComment{
+					Version:  latest.Number,
+					Question: question,
+					Author:   reviewer,
+					Text:     text,
+					At:       now,
+				})
+			}
+		}
+		for i, question := range latest.Questions {
+			comment(question, r.FormValue(fmt.Sprintf("comment[%d]", i)))
+		}
+		comment("", r.FormValue("comment"))
+
+		var status string
+		switch action {
+		case "comment":
+		case "request-changes":
+			status = proposalChangesRequested
+		case "approve":
+			status = proposalApproved
+		case "reject":
+			status = proposalRejected
+		default:
+			return fmt.Errorf("Invalid action: %s", action)
+		}
+
+		if status != "" {
+			if proposal.Status != proposalSubmitted {
+				return fmt.Errorf("Only submitted proposals can be decided on, this one is %s", proposal.Status)
+			}
+
+			assigned := len(proposal.Assignees) == 0 || proposal.Assigned(reviewer)
+			if !assigned && !override {
+				return fmt.Errorf("This proposal is assigned to %s, check Override to decide on it anyway",
+					strings.Join(proposal.Assignees, ", "))
+			}
+
+			proposal.Status = status
+			proposal.Timeline = append(proposal.Timeline, &ProposalEvent{
+				At:       now,
+				By:       reviewer,
+				Status:   status,
+				Note:     strings.TrimSpace(r.FormValue("comment")),
+				Override: !assigned,
+			})
+		}
+
+		proposal.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if action == "approve" || action == "reject" {
+		invalidateProposal(teamName)
+		_, err = jobs.Enqueue(jobProposalSheet, map[string]string{"Team": teamName})
+	} else if action == "request-changes" {
+		invalidateProposal(teamName)
+	}
+
+	return err
+}
+
+func adminProposals() (string, http.HandlerFunc) {
+	return "/admin/proposals", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("proposals") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		user := CurrentUser(r)
+		data := map[string]interface{}{}
+
+		scope := r.URL.Query().Get("scope")
+		proposals, err := proposalAll(func(proposal *Proposal) bool {
+			switch scope {
+			case "all":
+				return true
+			case "":
+				return proposal.Status == proposalSubmitted &&
+					(len(proposal.Assignees) == 0 || proposal.Assigned(user.UserName))
+			default:
+				return proposal.Status == scope
+			}
+		})
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+
+		data["Scope"] = scope
+		data["Proposals"] = proposals
+		data["Statuses"] = []string{proposalSubmitted, proposalChangesRequested, proposalApproved, proposalRejected}
+
+		Render(w, r, "admin/proposals", data)
+	}
+}
+
+func adminProposalReview() (string, http.HandlerFunc) {
+	return "/admin/proposals/review", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("proposals") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		team := r.URL.Query().Get("team")
+		data := map[string]interface{}{}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			if err := proposalReview(r, team, CurrentUser(r).UserName); err != nil {
+				data["Flash"] = err.Error()
+			} else {
+				data["Success"] = "Saved."
+			}
+		}
+
+		proposal := proposalFind(team)
+		if !proposal.Submitted() {
+			http.NotFound(w, r)
+			return
+		}
+
+		data["Proposal"] = proposal
+
+		Render(w, r, "admin/proposal_review", data)
+	}
+}
+
+// jobProposalSheetHandler writes the latest version of a proposal, and whether
+// it was approved, to the proposals sheet.
+func jobProposalSheetHandler(args map[string]string) error {
+	proposal := proposalFind(args["Team"])
+	latest := proposal.Latest()
+	if latest == nil {
+		return nil
+	}
+
+	answers := []string{}
+	for _, question := range latest.Questions {
+		answers = append(answers, latest.Answers[question])
+	}
+
+	late, approved := "NO", "NO"
+	if proposal.Late {
+		late = "YES"
+	}
+	if proposal.Status == proposalApproved {
+		approved = "YES"
+	}
+
+	return google.SheetsSetProposal(proposal.Team, answers, late, approved)
+}
@@ -0,0 +1,163 @@
+package submit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ramin0/submit/config"
+)
+
+func setupProposals(t *testing.T) {
+	openStore(t)
+
+	oldQuestions, oldEvaluators := config.ProposalsQuestions, config.EvaluationsGroupEvaluators
+	t.Cleanup(func() { config.ProposalsQuestions, config.EvaluationsGroupEvaluators = oldQuestions, oldEvaluators })
+	config.ProposalsQuestions = []string{"Idea", "Plan"}
+	config.EvaluationsGroupEvaluators = map[string][]string{"T1": {"alice"}}
+}
+
+func formRequest(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func proposalForm(action string, revision int, answers ...string) *http.Request {
+	values := url.Values{"action": {action}, "proposal[revision]": {strconv.Itoa(revision)}}
+	for i, answer := range answers {
+		values.Set("answer["+strconv.Itoa(i)+"]", answer)
+	}
+
+	return formRequest(values)
+}
+
+func reviewForm(action string, version int, override bool) *http.Request {
+	values := url.Values{"action": {action}, "proposal[version]": {strconv.Itoa(version)}}
+	if override {
+		values.Set("proposal[override]", "on")
+	}
+
+	return formRequest(values)
+}
+
+func student(userName string) *User {
+	return &User{UserName: userName, teamName: "Team 01", teamGroup: "T1"}
+}
+
+func TestProposalSaveRevisions(t *testing.T) {
+	setupProposals(t)
+
+	tests := []struct {
+		name     string
+		user     string
+		action   string
+		revision int
+		answers  []string
+		err      string
+		status   string
+		versions int
+	}{
+		{"draft", "a", "save", 0, []string{"idea"}, "", proposalDraft, 0},
+		{"stale revision", "b", "save", 0, []string{"other idea"}, "teammate saved changes", proposalDraft, 0},
+		{"missing answer", "a", "submit", 1, []string{"idea"}, "Please answer", proposalDraft, 0},
+		{"submit", "b", "submit", 1, []string{"idea", "plan"}, "", proposalSubmitted, 1},
+		{"locked once submitted", "a", "save", 2, []string{"idea", "plan"}, "can't be changed", proposalSubmitted, 1},
+	}
+
+	for _, tt := range tests {
+		err := proposalSave(proposalForm(tt.action, tt.revision, tt.answers...), student(tt.user))
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Fatalf("%s: proposalSave() = %v, want %q", tt.name, err, tt.err)
+		}
+
+		proposal := proposalFind("Team 01")
+		if proposal.Status != tt.status || len(proposal.Versions) != tt.versions {
+			t.Fatalf("%s: proposal is %s with %d versions, want %s with %d", tt.name,
+				proposal.Status, len(proposal.Versions), tt.status, tt.versions)
+		}
+	}
+
+	proposal := proposalFind("Team 01")
+	if proposal.Answer("Idea") != "idea" || proposal.Latest().SubmittedBy != "b" {
+		t.Errorf("submitted proposal = %+v", proposal.Latest())
+	}
+	if strings.Join(proposal.Assignees, ",") != "alice" {
+		t.Errorf("assignees = %v, want the group's evaluators", proposal.Assignees)
+	}
+}
+
+func TestProposalReviewTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		reviewer string
+		action   string
+		version  int
+		override bool
+		err      string
+		status   string
+	}{
+		{"comment", "bob", "comment", 1, false, "", proposalSubmitted},
+		{"unknown action", "alice", "archive", 1, false, "Invalid action", proposalSubmitted},
+		{"stale version", "alice", "approve", 2, false, "submitted version 1", proposalSubmitted},
+		{"not assigned", "bob", "approve", 1, false, "assigned to alice", proposalSubmitted},
+		{"override", "bob", "reject", 1, true, "", proposalRejected},
+		{"assignee", "alice", "approve", 1, false, "", proposalApproved},
+		{"changes", "alice", "request-changes", 1, false, "", proposalChangesRequested},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupProposals(t)
+			if err := proposalSave(proposalForm("submit", 0, "idea", "plan"), student("a")); err != nil {
+				t.Fatal(err)
+			}
+
+			err := proposalReview(reviewForm(tt.action, tt.version, tt.override), "Team 01", tt.reviewer)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("proposalReview() = %v, want %q", err, tt.err)
+			}
+
+			proposal := proposalFind("Team 01")
+			if proposal.Status != tt.status {
+				t.Errorf("status = %s, want %s", proposal.Status, tt.status)
+			}
+
+			last := proposal.Timeline[len(proposal.Timeline)-1]
+			if tt.err == "" && tt.status != proposalSubmitted && (last.By != tt.reviewer || last.Override != tt.override) {
+				t.Errorf("last event = %+v, want one by %s with override %v", last, tt.reviewer, tt.override)
+			}
+		})
+	}
+}
+
+func TestProposalReviewOnlySubmitted(t *testing.T) {
+	setupProposals(t)
+	if err := proposalSave(proposalForm("submit", 0, "idea", "plan"), student("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := proposalReview(reviewForm("request-changes", 1, false), "Team 01", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proposalReview(reviewForm("approve", 1, false), "Team 01", "alice"); err == nil {
+		t.Error("approved a proposal waiting for changes")
+	}
+
+	// The team revises and submits again; reviews of the old version fail.
+	if err := proposalSave(proposalForm("submit", 1, "idea", "better plan"), student("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := proposalReview(reviewForm("approve", 1, false), "Team 01", "alice"); err == nil {
+		t.Error("approved a version the team replaced")
+	}
+	if err := proposalReview(reviewForm("approve", 2, false), "Team 01", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if proposal := proposalFind("Team 01"); proposal.Status != proposalApproved || proposal.Latest().Answer("Plan") != "better plan" {
+		t.Errorf("proposal = %s, %q", proposal.Status, proposal.Latest().Answer("Plan"))
+	}
+}
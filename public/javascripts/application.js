@@ -3,3 +3,17 @@ $(document).on('click', '#toggle-schedule', function(e) {
   $('#slot').toggleClass('hidden');
   $('#schedule').toggleClass('hidden');
 });
+
+$(function() {
+  if (!$('#checkins').length || !window.EventSource) {
+    return;
+  }
+
+  var events = new EventSource('/admin/evaluations/events');
+  events.addEventListener('checkin', function(e) {
+    var checkIn = JSON.parse(e.data);
+    $('[data-checkin="' + checkIn.Key + '"]')
+      .val(checkIn.Status)
+      .attr('class', 'checkin-status checkin-' + checkIn.Status);
+  });
+});
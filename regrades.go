@@ -0,0 +1,417 @@
+package submit
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	regradeCollection = "regrades"
+	auditCollection   = "grade_audit"
+
+	regradeOpen        = "open"
+	regradeUnderReview = "under-review"
+	regradeAccepted    = "accepted"
+	regradeRejected    = "rejected"
+
+	jobRegradeWrite = "grades.regrade"
+)
+
+// Regrade struct
+type Regrade struct {
+	ID            string
+	UserID        string
+	UserName      string
+	FullName      string
+	TeamGroup     string
+	Method        string
+	Mark          string
+	NewMark       string
+	Justification string
+	Status        string
+	Assignees     []string
+	Events        []*RegradeEvent
+	PreviousMark  string
+	PreviousRead  bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// RegradeEvent struct
+type RegradeEvent struct {
+	At       time.Time
+	By       string
+	Status   string
+	Comment  string
+	Override bool
+}
+
+// Closed func
+func (r *Regrade) Closed() bool {
+	return r.Status == regradeAccepted || r.Status == regradeRejected
+}
+
+// Assigned func
+func (r *Regrade) Assigned(userName string) bool {
+	for _, assignee := range r.Assignees {
+		if strings.EqualFold(assignee, userName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GradeAudit struct
+type GradeAudit struct {
+	ID     string
+	At     time.Time
+	By     string
+	UserID string
+	Method string
+	From   string
+	To     string
+	Source string
+}
+
+func regradeFind(id string) (*Regrade, error) {
+	regrade := &Regrade{}
+	found, err := store.Get(regradeCollection, id, regrade)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("Couldn't find regrade request %s", id)
+	}
+
+	return regrade, nil
+}
+
+func regradeAll(filter func(*Regrade) bool) ([]*Regrade, error) {
+	all := map[string]*Regrade{}
+	if err := store.All(regradeCollection, &all); err != nil {
+		return nil, err
+	}
+
+	regrades := []*Regrade{}
+	for _, regrade := range all {
+		if filter == nil || filter(regrade) {
+			regrades = append(regrades, regrade)
+		}
+	}
+	sort.Slice(regrades, func(i, j int) bool {
+		return regrades[i].CreatedAt.After(regrades[j].CreatedAt)
+	})
+
+	return regrades, nil
+}
+
+func regradeCreate(user *User, method, justification string) error {
+	if justification == "" {
+		return fmt.Errorf("Please explain why the mark should be reviewed")
+	}
+
+	methods, marks := user.Grades()
+	mark, found := "", false
+	for i, m := range methods {
+		if m == method {
+			found = true
+			if i < len(marks) {
+				mark = marks[i]
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("Couldn't find %s", method)
+	}
+
+	existing, err := regradeAll(func(r *Regrade) bool {
+		return r.UserID == user.ID && r.Method == method && !r.Closed()
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("You already have an open regrade request for %s", method)
+	}
+
+	now := time.Now()
+	hasher := md5.New()
+	hasher.Write([]byte(user.ID + method + strconv.FormatInt(now.UnixNano(), 10)))
+
+	regrade := &Regrade{
+		ID:            hex.EncodeToString(hasher.Sum(nil)),
+		UserID:        user.ID,
+		UserName:      user.UserName,
+		FullName:      user.FullName,
+		TeamGroup:     user.TeamGroup(),
+		Method:        method,
+		Mark:          mark,
+		Justification: justification,
+		Status:        regradeOpen,
+		Assignees:     config.EvaluationsGroupEvaluators[user.TeamGroup()],
+		Events: []*RegradeEvent{
+			{At: now, By: user.UserName, Status: regradeOpen},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	return store.Put(regradeCollection, regrade.ID, regrade)
+}
+
+// regradeUpdate records a comment and/or a status change. Accepting a request
+// requires the new mark, which is then written back by a job. Only the
+// assignees may change the status of an assigned request, unless an admin
+// overrides it, which is recorded with the change.
+func regradeUpdate(id, by, status, comment, newMark string, admin, override bool) error {
+	regrade := &Regrade{}
+	err := store.Update(regradeCollection, id, regrade, func(found bool) error {
+		if !found {
+			return fmt.Errorf("Couldn't find regrade request %s", id)
+		}
+		if regrade.Closed() {
+			return fmt.Errorf("This regrade request is closed")
+		}
+
+		if !admin {
+			status = ""
+		}
+
+		switch status {
+		case "", regradeOpen, regradeUnderReview, regradeRejected:
+		case regradeAccepted:
+			if newMark == "" {
+				return fmt.Errorf("Accepting a regrade request needs the new mark")
+			}
+			regrade.NewMark = newMark
+		default:
+			return fmt.Errorf("Invalid status: %s", status)
+		}
+
+		if status == regrade.Status {
+			status = ""
+		}
+		if status == "" && comment == "" {
+			return fmt.Errorf("Nothing to update")
+		}
+
+		assigned := len(regrade.Assignees) == 0 || regrade.Assigned(by)
+		if status != "" && !assigned && !override {
+			return fmt.Errorf("This regrade request is assigned to %s, check Override to decide it anyway",
+				strings.Join(regrade.Assignees, ", "))
+		}
+
+		if status != "" {
+			regrade.Status = status
+		}
+		regrade.Events = append(regrade.Events, &RegradeEvent{
+			At:       time.Now(),
+			By:       by,
+			Status:   status,
+			Comment:  comment,
+			Override: status != "" && !assigned,
+		})
+		regrade.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if regrade.Status == regradeAccepted {
+		_, err = jobs.Enqueue(jobRegradeWrite, map[string]string{"ID": id, "By": by})
+	}
+
+	return err
+}
+
+// jobRegradeWriteHandler writes the new mark of an accepted regrade. The mark
+// it replaces is read from the sheet, rather than taken from when the request
+// was made, and kept on the request so a retry logs the same one.
+func jobRegradeWriteHandler(args map[string]string) error {
+	regrade, err := regradeFind(args["ID"])
+	if err != nil {
+		return err
+	}
+
+	if !regrade.PreviousRead {
+		methods, marks, err := google.SheetsGrades(regrade.UserID)
+		if err != nil {
+			return err
+		}
+
+		previous := ""
+		for i, method := range methods {
+			if method == regrade.Method && i < len(marks) {
+				previous = marks[i]
+			}
+		}
+
+		err = store.Update(regradeCollection, regrade.ID, regrade, func(found bool) error {
+			if !regrade.PreviousRead {
+				regrade.PreviousMark = previous
+				regrade.PreviousRead = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := google.SheetsSetGrade(regrade.UserID, regrade.Method, regrade.NewMark); err != nil {
+		return err
+	}
+	invalidateGrades(regrade.UserID)
+
+	return gradeAuditLog(&GradeAudit{
+		ID:     regrade.ID,
+		By:     args["By"],
+		UserID: regrade.UserID,
+		Method: regrade.Method,
+		From:   regrade.PreviousMark,
+		To:     regrade.NewMark,
+		Source: "regrade",
+	})
+}
+
+// gradeAuditLog records a change written to the grades sheet. Entries are
+// keyed by their source ID so a retried write is only logged once.
+func gradeAuditLog(audit *GradeAudit) error {
+	audit.At = time.Now()
+	return store.Put(auditCollection, audit.ID, audit)
+}
+
+func gradeAudits(userID string) ([]*GradeAudit, error) {
+	all := map[string]*GradeAudit{}
+	if err := store.All(auditCollection, &all); err != nil {
+		return nil, err
+	}
+
+	audits := []*GradeAudit{}
+	for _, audit := range all {
+		if userID == "" || audit.UserID == userID {
+			audits = append(audits, audit)
+		}
+	}
+	sort.Slice(audits, func(i, j int) bool {
+		return audits[i].At.After(audits[j].At)
+	})
+
+	return audits, nil
+}
+
+func gradesRegrade() (string, http.HandlerFunc) {
+	return "/grades/regrade", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("grades") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		user := CurrentUser(r)
+		data := map[string]interface{}{
+			"Method": r.URL.Query().Get("method"),
+		}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			var err error
+			if id := r.FormValue("regrade[id]"); id != "" {
+				var regrade *Regrade
+				if regrade, err = regradeFind(id); err == nil && regrade.UserID != user.ID {
+					err = fmt.Errorf("Couldn't find regrade request %s", id)
+				}
+				if err == nil {
+					err = regradeUpdate(id, user.UserName, "", strings.TrimSpace(r.FormValue("regrade[comment]")), "", false, false)
+				}
+			} else {
+				err = regradeCreate(user, r.FormValue("regrade[method]"), strings.TrimSpace(r.FormValue("regrade[justification]")))
+			}
+
+			if err != nil {
+				data["Flash"] = err.Error()
+			} else {
+				http.Redirect(w, r, "/grades/regrade", http.StatusFound)
+				return
+			}
+		}
+
+		methods, _ := user.Grades()
+		regrades, _ := regradeAll(func(r *Regrade) bool {
+			return r.UserID == user.ID
+		})
+
+		data["Methods"] = methods
+		data["Regrades"] = regrades
+
+		Render(w, r, "regrade", data)
+	}
+}
+
+func adminRegrades() (string, http.HandlerFunc) {
+	return "/admin/regrades", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("grades") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		user := CurrentUser(r)
+		data := map[string]interface{}{}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			err := regradeUpdate(r.FormValue("regrade[id]"), user.UserName, r.FormValue("regrade[status]"),
+				strings.TrimSpace(r.FormValue("regrade[comment]")), strings.TrimSpace(r.FormValue("regrade[mark]")),
+				true, r.FormValue("regrade[override]") == "on")
+			if err != nil {
+				data["Flash"] = err.Error()
+			}
+		}
+
+		scope := r.URL.Query().Get("scope")
+		regrades, err := regradeAll(func(regrade *Regrade) bool {
+			switch scope {
+			case "all":
+				return true
+			case "closed":
+				return regrade.Closed()
+			default:
+				return !regrade.Closed() && (len(regrade.Assignees) == 0 || regrade.Assigned(user.UserName))
+			}
+		})
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+
+		audits, _ := gradeAudits("")
+
+		data["Scope"] = scope
+		data["Regrades"] = regrades
+		data["Audits"] = audits
+		data["Statuses"] = []string{regradeOpen, regradeUnderReview, regradeAccepted, regradeRejected}
+
+		Render(w, r, "admin/regrades", data)
+	}
+}
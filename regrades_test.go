@@ -0,0 +1,204 @@
+package submit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/store"
+)
+
+func TestRegradeTextRendersEscaped(t *testing.T) {
+	regrades := []*Regrade{{
+		ID:            "r1",
+		FullName:      "Student",
+		Method:        "Quiz 1",
+		Justification: "Question 2\n<script>alert(1)</script>",
+		Status:        regradeOpen,
+		Events: []*RegradeEvent{
+			{At: time.Now(), By: "student", Comment: "<img src=x onerror=alert(2)>"},
+		},
+	}}
+
+	for _, tmpl := range []string{"admin/regrades", "regrade"} {
+		w := httptest.NewRecorder()
+		Render(w, httptest.NewRequest(http.MethodGet, "/", nil), tmpl, map[string]interface{}{"Regrades": regrades})
+
+		body := w.Body.String()
+		if strings.Contains(body, "<script>alert") || strings.Contains(body, "<img src=x") {
+			t.Errorf("%s renders student text unescaped", tmpl)
+		}
+		if !strings.Contains(body, "Question 2<br />&lt;script&gt;alert(1)&lt;/script&gt;") {
+			t.Errorf("%s doesn't render the escaped justification with its line break", tmpl)
+		}
+	}
+}
+
+func gradedStudent() *User {
+	return &User{
+		ID:            "u1",
+		UserName:      "student",
+		teamGroup:     "T1",
+		gradesMethods: []string{"Quiz 1", "Quiz 2"},
+		gradesMarks:   []string{"6", "8"},
+	}
+}
+
+func TestRegradeCreate(t *testing.T) {
+	openStore(t)
+
+	oldVisibility, oldEvaluators := config.GradesDefaultVisibility, config.EvaluationsGroupEvaluators
+	t.Cleanup(func() {
+		config.GradesDefaultVisibility, config.EvaluationsGroupEvaluators = oldVisibility, oldEvaluators
+	})
+	config.GradesDefaultVisibility = releasePublished
+	config.EvaluationsGroupEvaluators = map[string][]string{"T1": {"alice"}}
+
+	if err := store.Put(releaseCollection, "Quiz 2", &Release{Method: "Quiz 2", Visibility: releaseHidden}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		justification string
+		err           string
+	}{
+		{"no justification", "Quiz 1", "", "Please explain"},
+		{"unknown method", "Final", "why", "Couldn't find Final"},
+		{"hidden method", "Quiz 2", "why", "Couldn't find Quiz 2"},
+		{"open", "Quiz 1", "why", ""},
+		{"already open", "Quiz 1", "why again", "already have an open"},
+	}
+
+	for _, tt := range tests {
+		err := regradeCreate(gradedStudent(), tt.method, tt.justification)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Fatalf("%s: regradeCreate() = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	regrades, _ := regradeAll(nil)
+	if len(regrades) != 1 {
+		t.Fatalf("got %d regrade requests, want 1", len(regrades))
+	}
+	if r := regrades[0]; r.Mark != "6" || r.Status != regradeOpen || strings.Join(r.Assignees, ",") != "alice" {
+		t.Errorf("regrade = %+v", r)
+	}
+}
+
+func TestRegradeUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    string
+		assignees []string
+		by        string
+		update    string
+		comment   string
+		mark      string
+		admin     bool
+		override  bool
+		err       string
+		want      string
+		event     bool
+	}{
+		{name: "comment", status: regradeOpen, by: "student", comment: "see Q2", want: regradeOpen, event: true},
+		{name: "student can't decide", status: regradeOpen, by: "student", update: regradeAccepted, mark: "9", err: "Nothing to update", want: regradeOpen},
+		{name: "nothing", status: regradeOpen, by: "alice", admin: true, err: "Nothing to update", want: regradeOpen},
+		{name: "same status", status: regradeUnderReview, by: "alice", update: regradeUnderReview, admin: true, err: "Nothing to update", want: regradeUnderReview},
+		{name: "invalid status", status: regradeOpen, by: "alice", update: "archived", admin: true, err: "Invalid status", want: regradeOpen},
+		{name: "review", status: regradeOpen, by: "alice", update: regradeUnderReview, admin: true, want: regradeUnderReview, event: true},
+		{name: "accept without mark", status: regradeUnderReview, by: "alice", update: regradeAccepted, admin: true, err: "needs the new mark", want: regradeUnderReview},
+		{name: "accept", status: regradeUnderReview, by: "alice", update: regradeAccepted, mark: "9", admin: true, want: regradeAccepted, event: true},
+		{name: "reject", status: regradeOpen, by: "alice", update: regradeRejected, admin: true, want: regradeRejected, event: true},
+		{name: "closed", status: regradeRejected, by: "alice", update: regradeOpen, admin: true, err: "is closed", want: regradeRejected},
+		{name: "not assigned", status: regradeOpen, assignees: []string{"alice"}, by: "bob", update: regradeRejected, admin: true, err: "assigned to alice", want: regradeOpen},
+		{name: "not assigned comment", status: regradeOpen, assignees: []string{"alice"}, by: "bob", comment: "hmm", admin: true, want: regradeOpen, event: true},
+		{name: "assignee", status: regradeOpen, assignees: []string{"alice"}, by: "Alice", update: regradeRejected, admin: true, want: regradeRejected, event: true},
+		{name: "override", status: regradeOpen, assignees: []string{"alice"}, by: "bob", update: regradeRejected, admin: true, override: true, want: regradeRejected, event: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openStore(t)
+			regrade := &Regrade{ID: "r1", UserID: "u1", Method: "Quiz 1", Status: tt.status, Assignees: tt.assignees}
+			if err := store.Put(regradeCollection, regrade.ID, regrade); err != nil {
+				t.Fatal(err)
+			}
+
+			err := regradeUpdate("r1", tt.by, tt.update, tt.comment, tt.mark, tt.admin, tt.override)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("regradeUpdate() = %v, want %q", err, tt.err)
+			}
+
+			regrade, _ = regradeFind("r1")
+			if regrade.Status != tt.want {
+				t.Errorf("status = %s, want %s", regrade.Status, tt.want)
+			}
+			if got := len(regrade.Events) == 1; got != tt.event {
+				t.Fatalf("recorded an event: %v, want %v", got, tt.event)
+			}
+			if tt.event {
+				event := regrade.Events[0]
+				if event.By != tt.by || event.Comment != tt.comment || event.Override != (tt.override && tt.update != "") {
+					t.Errorf("event = %+v", event)
+				}
+			}
+
+			all, _ := jobs.All()
+			if queued := len(all) == 1 && all[0].Kind == jobRegradeWrite; queued != (tt.want == regradeAccepted) {
+				t.Errorf("queued the mark write: %v, want %v", queued, tt.want == regradeAccepted)
+			}
+			if tt.want == regradeAccepted && regrade.NewMark != tt.mark {
+				t.Errorf("new mark = %q, want %q", regrade.NewMark, tt.mark)
+			}
+		})
+	}
+}
+
+func TestGradeAuditLog(t *testing.T) {
+	openStore(t)
+
+	audits := []*GradeAudit{
+		{ID: "r1", UserID: "u1", Method: "Quiz 1", From: "6", To: "9", Source: "regrade"},
+		// A retried write logs the same change again under the same ID.
+		{ID: "r1", UserID: "u1", Method: "Quiz 1", From: "6", To: "9", Source: "regrade"},
+		{ID: "r2", UserID: "u2", Method: "Quiz 1", From: "", To: "7", Source: "regrade"},
+		{ID: "r3", UserID: "u1", Method: "Quiz 2", From: "5", To: "8", Source: "regrade"},
+	}
+	for _, audit := range audits {
+		if err := gradeAuditLog(audit); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		userID string
+		want   []string
+	}{
+		{"u1", []string{"r3", "r1"}},
+		{"u2", []string{"r2"}},
+		{"", []string{"r3", "r2", "r1"}},
+		{"u3", []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := gradeAudits(tt.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+		for _, audit := range got {
+			ids = append(ids, audit.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("gradeAudits(%q) = %v, want %v", tt.userID, ids, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package submit
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/slack"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	releaseCollection = "grade_releases"
+
+	releaseHidden    = "hidden"
+	releasePublished = "published"
+	releaseScheduled = "scheduled"
+
+	jobGradesAnnounce = "grades.announce"
+)
+
+// Release struct
+type Release struct {
+	Method     string
+	Visibility string
+	PublishAt  time.Time
+	Announced  bool
+	UpdatedBy  string
+	UpdatedAt  time.Time
+}
+
+// Released func
+func (r *Release) Released() bool {
+	switch r.Visibility {
+	case releasePublished:
+		return true
+	case releaseScheduled:
+		return !time.Now().Before(r.PublishAt)
+	}
+
+	return false
+}
+
+// releaseFind returns the release of a method. Methods nobody set a release
+// for follow GradesDefaultVisibility, which is published so that columns that
+// were visible before releases existed stay visible.
+func releaseFind(method string) *Release {
+	release := &Release{}
+	if found, _ := store.Get(releaseCollection, method, release); !found {
+		return &Release{Method: method, Visibility: config.GradesDefaultVisibility}
+	}
+
+	return release
+}
+
+func gradeReleased(method string) bool {
+	return releaseFind(method).Released()
+}
+
+func releaseSet(method, visibility, publishAt, by string) error {
+	var at time.Time
+	switch visibility {
+	case releaseHidden, releasePublished:
+	case releaseScheduled:
+		loc, err := time.LoadLocation(config.EvaluationsTimeZone)
+		if err != nil {
+			loc = time.Local
+		}
+
+		at, err = time.ParseInLocation("2006-01-02T15:04", publishAt, loc)
+		if err != nil {
+			return fmt.Errorf("Invalid publish time: %s", publishAt)
+		}
+	default:
+		return fmt.Errorf("Invalid visibility: %s", visibility)
+	}
+
+	release := releaseFind(method)
+	err := store.Update(releaseCollection, method, release, func(found bool) error {
+		release.Method = method
+		release.Visibility = visibility
+		release.PublishAt = at
+		release.UpdatedBy = by
+		release.UpdatedAt = time.Now()
+		if visibility == releaseHidden {
+			release.Announced = false
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch visibility {
+	case releasePublished:
+		_, err = jobs.Enqueue(jobGradesAnnounce, map[string]string{"Method": method})
+	case releaseScheduled:
+		_, err = jobs.EnqueueAt(jobGradesAnnounce, map[string]string{"Method": method}, at)
+	}
+
+	return err
+}
+
+func adminGrades() (string, http.HandlerFunc) {
+	return "/admin/grades", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("grades") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		data := map[string]interface{}{}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			err := releaseSet(r.FormValue("release[method]"), r.FormValue("release[visibility]"),
+				r.FormValue("release[publish_at]"), CurrentUser(r).UserName)
+			if err != nil {
+				data["Flash"] = err.Error()
+			}
+		}
+
+		methods, err := google.SheetsGradeMethods()
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+
+		releases := []*Release{}
+		for _, method := range methods {
+			releases = append(releases, releaseFind(method))
+		}
+		data["Releases"] = releases
+
+		Render(w, r, "admin/grades", data)
+	}
+}
+
+// jobGradesAnnounceHandler announces a released assessment once. Scheduled
+// announcements that were rescheduled or hidden in the meantime are skipped.
+func jobGradesAnnounceHandler(args map[string]string) error {
+	release := releaseFind(args["Method"])
+	if !release.Released() || release.Announced {
+		return nil
+	}
+
+	if config.SlackAnnouncementsChannel != "" {
+		message := fmt.Sprintf("Grades for *%s* are out! Check them on the Grades page.", release.Method)
+		if err := slack.ChatPostMessage(config.SlackAnnouncementsChannel, message); err != nil {
+			return err
+		}
+	}
+
+	return store.Update(releaseCollection, release.Method, release, func(found bool) error {
+		release.Announced = true
+		return nil
+	})
+}
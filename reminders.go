@@ -0,0 +1,361 @@
+package submit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/slack"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	reminderCollection         = "reminders_sent"
+	reminderSettingsCollection = "reminder_settings"
+	submissionCollection       = "team_submissions"
+
+	reminderDeadline = "deadline"
+	reminderSlot     = "slot"
+
+	jobRemindersScan = "reminders.scan"
+)
+
+var (
+	// submissionsBackfilled is only touched by the scan job, which runs one at
+	// a time.
+	submissionsBackfilled bool
+)
+
+// ReminderSettings holds which reminders a user opted out of.
+type ReminderSettings struct {
+	UserName  string
+	Deadline  bool
+	Slot      bool
+	UpdatedAt time.Time
+}
+
+// Muted func
+func (s *ReminderSettings) Muted(kind string) bool {
+	switch kind {
+	case reminderDeadline:
+		return s.Deadline
+	case reminderSlot:
+		return s.Slot
+	}
+
+	return false
+}
+
+// reminder is a DM due to a student at At, ahead of an event at Due.
+type reminder struct {
+	Kind    string
+	Student map[string]string
+	At      time.Time
+	Due     time.Time
+	Text    string
+}
+
+// key identifies a reminder across scans; it changes when the deadline or the
+// slot moves, so the reminder is sent again for the new time.
+func (r *reminder) key() string {
+	return fmt.Sprintf("%s:%s:%d:%d", r.Kind, r.Student["UserName"], r.Due.Unix(), r.Due.Sub(r.At)/time.Second)
+}
+
+func reminderSettingsFind(userName string) *ReminderSettings {
+	settings := &ReminderSettings{}
+	if found, _ := store.Get(reminderSettingsCollection, userName, settings); !found {
+		return &ReminderSettings{UserName: userName}
+	}
+
+	return settings
+}
+
+func reminderSettingsSet(userName string, deadline, slot bool) error {
+	settings := reminderSettingsFind(userName)
+	return store.Update(reminderSettingsCollection, userName, settings, func(found bool) error {
+		settings.UserName = userName
+		settings.Deadline = deadline
+		settings.Slot = slot
+		settings.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// submissionRecord notes that a team submitted, so deadline reminders skip it.
+func submissionRecord(teamName string) error {
+	return store.Put(submissionCollection, teamName, time.Now())
+}
+
+func teamSubmitted(teamName string) bool {
+	var at time.Time
+	found, _ := store.Get(submissionCollection, teamName, &at)
+	return found
+}
+
+// submissionsBackfill records the teams that submitted before submissions
+// were recorded: those with a file in their Drive folder or a link on the
+// sheet. It runs once per process, before the first deadline reminders.
+func submissionsBackfill() error {
+	if submissionsBackfilled {
+		return nil
+	}
+
+	teams := map[string]bool{}
+	if config.SubmissionsFolderID != "" {
+		submissions, err := google.DriveTeamSubmissions(config.SubmissionsFolderID)
+		if err != nil {
+			return err
+		}
+		for _, submission := range submissions {
+			teams[submission["Team"]] = true
+		}
+	}
+
+	urls, err := google.SheetsSubmissions()
+	if err != nil {
+		return err
+	}
+	for teamName := range urls {
+		teams[teamName] = true
+	}
+
+	for teamName := range teams {
+		if teamSubmitted(teamName) {
+			continue
+		}
+		if err := submissionRecord(teamName); err != nil {
+			return err
+		}
+	}
+
+	submissionsBackfilled = true
+	return nil
+}
+
+// startReminders enqueues a scan every RemindersInterval. The ticker lives in
+// memory rather than as a self-rescheduling job so restarts don't pile up
+// scans.
+func startReminders() {
+	interval, err := time.ParseDuration(config.RemindersInterval)
+	if err != nil || interval <= 0 || !featureEnabled("reminders") {
+		return
+	}
+
+	go func() {
+		for range time.NewTicker(interval).C {
+			jobs.Enqueue(jobRemindersScan, map[string]string{})
+		}
+	}()
+}
+
+// reminderOffsets parses durations like "48h", skipping invalid ones.
+func reminderOffsets(offsets []string) []time.Duration {
+	durations := []time.Duration{}
+	for _, offset := range offsets {
+		if d, err := time.ParseDuration(offset); err == nil && d > 0 {
+			durations = append(durations, d)
+		}
+	}
+
+	return durations
+}
+
+// remindersDue lists the reminders whose time has come but whose event hasn't
+// happened yet: deadline reminders for members of teams that haven't
+// submitted, and slot reminders for members of teams booked into a slot. Only
+// the latest due offset of each event counts, so a scan that runs late, or an
+// event set up close to its time, sends one reminder rather than every one
+// that passed.
+func remindersDue(now time.Time, students []map[string]string) ([]*reminder, error) {
+	teams := map[string][]map[string]string{}
+	for _, student := range students {
+		if student["Team"] != "" {
+			teams[student["Team"]] = append(teams[student["Team"]], student)
+		}
+	}
+
+	due := []*reminder{}
+	add := func(kind, teamName string, offsets []time.Duration, on time.Time, text string) {
+		if !now.Before(on) {
+			return
+		}
+
+		var at time.Time
+		for _, offset := range offsets {
+			if t := on.Add(-offset); !now.Before(t) && t.After(at) {
+				at = t
+			}
+		}
+		if at.IsZero() {
+			return
+		}
+
+		for _, student := range teams[teamName] {
+			due = append(due, &reminder{Kind: kind, Student: student, At: at, Due: on, Text: text})
+		}
+	}
+
+	deadline, err := time.Parse(time.RFC3339, config.SubmissionDeadline)
+	if err == nil && featureEnabled("submissions") {
+		offsets := reminderOffsets(config.RemindersDeadline)
+		for teamName := range teams {
+			if teamSubmitted(teamName) {
+				continue
+			}
+			add(reminderDeadline, teamName, offsets, deadline, fmt.Sprintf(
+				"Reminder: %s hasn't submitted yet and the deadline is %s. You can submit on the Submit page.",
+				teamName, reminderTime(deadline)))
+		}
+	}
+
+	if featureEnabled("evaluations") && len(config.RemindersSlot) > 0 {
+		slots, err := scheduler.Get().Slots()
+		if err != nil {
+			return nil, err
+		}
+
+		offsets := reminderOffsets(config.RemindersSlot)
+		for _, s := range slots {
+			slot := newSlot(s)
+			where := ""
+			if slot.Location != "" {
+				where = " in " + slot.Location
+			}
+			if slot.VideoURL != "" {
+				where += " (" + slot.VideoURL + ")"
+			}
+
+			for _, teamName := range s.Teams {
+				add(reminderSlot, teamName, offsets, s.Start, fmt.Sprintf(
+					"Reminder: %s's evaluation is %s%s.", teamName, reminderTime(s.Start), where))
+			}
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].At.Before(due[j].At)
+	})
+
+	return due, nil
+}
+
+// reminderTime formats a time in the evaluations time zone.
+func reminderTime(t time.Time) string {
+	if loc, err := time.LoadLocation(config.EvaluationsTimeZone); err == nil {
+		t = t.In(loc)
+	}
+
+	return t.Format("Monday, January 2 at 3:04 PM")
+}
+
+// reminderSend claims a reminder and DMs it. A reminder is claimed before it is
+// sent so overlapping scans can't send it twice, and released again if Slack
+// fails so the next attempt retries it.
+func reminderSend(rem *reminder) error {
+	key := rem.key()
+
+	claimed := false
+	var sentAt time.Time
+	err := store.Update(reminderCollection, key, &sentAt, func(found bool) error {
+		if !found {
+			claimed = true
+			sentAt = time.Now()
+		}
+		return nil
+	})
+	if err != nil || !claimed {
+		return err
+	}
+
+	user := &User{UserName: rem.Student["UserName"]}
+	slackID, err := slackIDFor(rem.Student["ID"], user.Email())
+	if err != nil {
+		store.Delete(reminderCollection, key)
+		if err == errSlackUnlinked {
+			return nil
+		}
+		return err
+	}
+
+	if err := slack.ChatPostMessage(slackID, rem.Text); err != nil {
+		store.Delete(reminderCollection, key)
+		return err
+	}
+
+	return nil
+}
+
+// jobRemindersScanHandler sends the reminders that are due and haven't been
+// sent yet, skipping users who opted out.
+func jobRemindersScanHandler(args map[string]string) error {
+	deadline, err := time.Parse(time.RFC3339, config.SubmissionDeadline)
+	if err == nil && featureEnabled("submissions") && time.Now().Before(deadline) {
+		if err := submissionsBackfill(); err != nil {
+			return err
+		}
+	}
+
+	students, err := google.SheetsStudents()
+	if err != nil {
+		return err
+	}
+
+	due, err := remindersDue(time.Now(), students)
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]*ReminderSettings{}
+	for _, rem := range due {
+		userName := rem.Student["UserName"]
+		if settings[userName] == nil {
+			settings[userName] = reminderSettingsFind(userName)
+		}
+		if settings[userName].Muted(rem.Kind) {
+			continue
+		}
+
+		if err := reminderSend(rem); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func settingsReminders() (string, http.HandlerFunc) {
+	return "/settings/reminders", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("settings") || !featureEnabled("reminders") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !EnsureLoggedIn(w, r) {
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/settings", http.StatusFound)
+			return
+		}
+
+		r.ParseForm()
+
+		err := reminderSettingsSet(CurrentUser(r).UserName,
+			r.FormValue("reminders[deadline]") != "on", r.FormValue("reminders[slot]") != "on")
+
+		data := settingsData(r)
+		if err != nil {
+			data["Flash"] = err.Error()
+		} else {
+			data["Success"] = "Your reminder settings were saved."
+		}
+
+		Render(w, r, "settings", data)
+	}
+}
@@ -0,0 +1,175 @@
+package submit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/store"
+)
+
+func withReminders(t *testing.T, deadline time.Time) {
+	oldDeadline, oldOffsets, oldSlotOffsets := config.SubmissionDeadline, config.RemindersDeadline, config.RemindersSlot
+	t.Cleanup(func() {
+		config.SubmissionDeadline, config.RemindersDeadline, config.RemindersSlot = oldDeadline, oldOffsets, oldSlotOffsets
+	})
+	config.SubmissionDeadline = deadline.Format(time.RFC3339)
+	config.RemindersDeadline = []string{"48h", "24h", "1h", "bogus"}
+	config.RemindersSlot = []string{"2h", "30m"}
+}
+
+func reminderStudents() []map[string]string {
+	return []map[string]string{
+		{"ID": "1", "UserName": "a", "Team": "Team 01"},
+		{"ID": "2", "UserName": "b", "Team": "Team 01"},
+		{"ID": "3", "UserName": "c", "Team": "Team 02"},
+		{"ID": "4", "UserName": "d"},
+	}
+}
+
+func TestRemindersDueDeadline(t *testing.T) {
+	deadline := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name   string
+		before time.Duration
+		offset time.Duration
+	}{
+		{"too early", 50 * time.Hour, 0},
+		{"first offset", 30 * time.Hour, 48 * time.Hour},
+		{"only the latest offset", 10 * time.Hour, 24 * time.Hour},
+		{"exactly at an offset", time.Hour, time.Hour},
+		{"last offset", time.Minute, time.Hour},
+		{"deadline passed", -time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openStore(t)
+			withFeatures(t, map[string]bool{"submissions": true})
+			withReminders(t, deadline)
+
+			// Team 02 submitted, so only Team 01 is reminded.
+			if err := submissionRecord("Team 02"); err != nil {
+				t.Fatal(err)
+			}
+
+			due, err := remindersDue(deadline.Add(-tt.before), reminderStudents())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.offset == 0 {
+				if len(due) != 0 {
+					t.Errorf("got %d reminders, want none", len(due))
+				}
+				return
+			}
+
+			users := []string{}
+			for _, rem := range due {
+				users = append(users, rem.Student["UserName"])
+				if rem.Kind != reminderDeadline || !rem.Due.Equal(deadline) || !rem.At.Equal(deadline.Add(-tt.offset)) {
+					t.Errorf("reminder = %s due %v at %v, want the %v reminder", rem.Kind, rem.Due, rem.At, tt.offset)
+				}
+				if !strings.Contains(rem.Text, "Team 01 hasn't submitted") {
+					t.Errorf("text = %q", rem.Text)
+				}
+			}
+			if strings.Join(users, ",") != "a,b" && strings.Join(users, ",") != "b,a" {
+				t.Errorf("reminded %v, want the members of Team 01", users)
+			}
+		})
+	}
+}
+
+func TestRemindersDueSlot(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	withLocalSlots(t,
+		&scheduler.Slot{ID: "soon", Start: now.Add(20 * time.Minute), End: now.Add(80 * time.Minute), Location: "C7", Teams: []string{"Team 01"}},
+		&scheduler.Slot{ID: "later", Start: now.Add(90 * time.Minute), End: now.Add(150 * time.Minute), Teams: []string{"Team 02"}},
+		&scheduler.Slot{ID: "tomorrow", Start: now.Add(24 * time.Hour), End: now.Add(25 * time.Hour)},
+	)
+	withFeatures(t, map[string]bool{"evaluations": true})
+	withReminders(t, now)
+
+	due, err := remindersDue(now, reminderStudents())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user   string
+		offset time.Duration
+		where  string
+	}{
+		{"a", 30 * time.Minute, "in C7"},
+		{"b", 30 * time.Minute, "in C7"},
+		{"c", 2 * time.Hour, "Team 02's evaluation"},
+	}
+
+	if len(due) != len(tests) {
+		t.Fatalf("got %d reminders, want %d", len(due), len(tests))
+	}
+	for _, tt := range tests {
+		var rem *reminder
+		for _, r := range due {
+			if r.Student["UserName"] == tt.user {
+				rem = r
+			}
+		}
+		if rem == nil {
+			t.Errorf("%s wasn't reminded", tt.user)
+			continue
+		}
+		if rem.Kind != reminderSlot || !rem.At.Equal(rem.Due.Add(-tt.offset)) || !strings.Contains(rem.Text, tt.where) {
+			t.Errorf("%s: reminder = %+v, want the %v one", tt.user, rem, tt.offset)
+		}
+	}
+}
+
+func TestReminderKey(t *testing.T) {
+	deadline := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	base := &reminder{Kind: reminderDeadline, Student: map[string]string{"UserName": "a"}, Due: deadline, At: deadline.Add(-24 * time.Hour)}
+
+	tests := []struct {
+		name string
+		rem  *reminder
+		same bool
+	}{
+		{"same reminder in a later scan", &reminder{Kind: reminderDeadline, Student: map[string]string{"UserName": "a", "ID": "1"}, Due: deadline, At: deadline.Add(-24 * time.Hour), Text: "other"}, true},
+		{"other offset", &reminder{Kind: reminderDeadline, Student: map[string]string{"UserName": "a"}, Due: deadline, At: deadline.Add(-time.Hour)}, false},
+		{"deadline moved", &reminder{Kind: reminderDeadline, Student: map[string]string{"UserName": "a"}, Due: deadline.Add(time.Hour), At: deadline.Add(-23 * time.Hour)}, false},
+		{"other student", &reminder{Kind: reminderDeadline, Student: map[string]string{"UserName": "b"}, Due: deadline, At: deadline.Add(-24 * time.Hour)}, false},
+		{"other kind", &reminder{Kind: reminderSlot, Student: map[string]string{"UserName": "a"}, Due: deadline, At: deadline.Add(-24 * time.Hour)}, false},
+	}
+
+	for _, tt := range tests {
+		if same := tt.rem.key() == base.key(); same != tt.same {
+			t.Errorf("%s: same key %v, want %v", tt.name, same, tt.same)
+		}
+	}
+}
+
+func TestReminderSendOnce(t *testing.T) {
+	openStore(t)
+
+	deadline := time.Now().Add(time.Hour)
+	rem := &reminder{Kind: reminderDeadline, Student: map[string]string{"UserName": "a"}, Due: deadline, At: deadline.Add(-time.Hour)}
+	sentAt := time.Now().Add(-time.Minute)
+	if err := store.Put(reminderCollection, rem.key(), sentAt); err != nil {
+		t.Fatal(err)
+	}
+
+	// A claimed reminder isn't sent again; sending it would need Slack.
+	if err := reminderSend(rem); err != nil {
+		t.Fatal(err)
+	}
+
+	var got time.Time
+	if found, _ := store.Get(reminderCollection, rem.key(), &got); !found || !got.Equal(sentAt) {
+		t.Errorf("claim = %v, %v, want the first send at %v", got, found, sentAt)
+	}
+}
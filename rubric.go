@@ -0,0 +1,275 @@
+package submit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	evaluationCollection = "evaluations"
+
+	evaluationDraft = "draft"
+	evaluationFinal = "final"
+
+	jobGradesWrite = "grades.write"
+)
+
+// Criterion struct
+type Criterion struct {
+	Name string
+	Max  float64
+}
+
+// Evaluation struct
+type Evaluation struct {
+	Key         string
+	SlotID      string
+	Team        string
+	Scores      map[string]float64
+	Adjustments map[string]float64
+	Comments    string
+	Status      string
+	Evaluator   string
+	UpdatedAt   time.Time
+}
+
+// Final func
+func (e *Evaluation) Final() bool {
+	return e.Status == evaluationFinal
+}
+
+// Score func
+func (e *Evaluation) Score(criterion string) string {
+	score, ok := e.Scores[criterion]
+	if !ok {
+		return ""
+	}
+
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// Adjustment func
+func (e *Evaluation) Adjustment(memberID string) string {
+	if e.Adjustments[memberID] == 0 {
+		return ""
+	}
+
+	return strconv.FormatFloat(e.Adjustments[memberID], 'f', -1, 64)
+}
+
+// Total func
+func (e *Evaluation) Total() float64 {
+	total := 0.0
+	for _, score := range e.Scores {
+		total += score
+	}
+
+	return total
+}
+
+// MemberTotal func
+func (e *Evaluation) MemberTotal(memberID string) float64 {
+	total := e.Total() + e.Adjustments[memberID]
+	if total < 0 {
+		total = 0
+	}
+	if max := rubricMax(); total > max {
+		total = max
+	}
+
+	return total
+}
+
+func rubricCriteria() []*Criterion {
+	criteria := []*Criterion{}
+	for _, item := range config.EvaluationsRubric {
+		max, _ := strconv.ParseFloat(item["Max"], 64)
+		criteria = append(criteria, &Criterion{Name: item["Name"], Max: max})
+	}
+
+	return criteria
+}
+
+func rubricMax() float64 {
+	max := 0.0
+	for _, criterion := range rubricCriteria() {
+		max += criterion.Max
+	}
+
+	return max
+}
+
+func evaluationFind(slotID, team string) *Evaluation {
+	evaluation := &Evaluation{}
+	if found, _ := store.Get(evaluationCollection, slotTeamKey(slotID, team), evaluation); !found {
+		return &Evaluation{
+			Key:         slotTeamKey(slotID, team),
+			SlotID:      slotID,
+			Team:        team,
+			Scores:      map[string]float64{},
+			Adjustments: map[string]float64{},
+			Status:      evaluationDraft,
+		}
+	}
+
+	return evaluation
+}
+
+func adminEvaluate() (string, http.HandlerFunc) {
+	return "/admin/evaluate", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		slotID := r.URL.Query().Get("slot")
+		team := r.URL.Query().Get("team")
+		if slotID == "" || team == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		data := map[string]interface{}{}
+
+		members, err := google.SheetsTeamMembers(team)
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			if err := evaluationSave(r, slotID, team, members); err != nil {
+				data["Flash"] = err.Error()
+			} else {
+				data["Success"] = "Saved."
+			}
+		}
+
+		data["Criteria"] = rubricCriteria()
+		data["Max"] = rubricMax()
+		data["Members"] = members
+		data["Evaluation"] = evaluationFind(slotID, team)
+
+		Render(w, r, "admin/evaluate", data)
+	}
+}
+
+// evaluationSave records the scores posted for a team, which must still be
+// booked into the slot being evaluated.
+func evaluationSave(r *http.Request, slotID, team string, members []map[string]string) error {
+	action := r.FormValue("action")
+
+	slot, err := scheduler.Get().TeamSlot(team)
+	if err != nil {
+		return err
+	}
+	if slot == nil || slot.ID != slotID {
+		return fmt.Errorf("%s isn't booked into this slot", team)
+	}
+
+	evaluation := evaluationFind(slotID, team)
+	err = store.Update(evaluationCollection, evaluation.Key, evaluation, func(found bool) error {
+		if action == "reopen" {
+			evaluation.Status = evaluationDraft
+			return nil
+		}
+		if evaluation.Final() {
+			return fmt.Errorf("This evaluation is final, reopen it to make changes")
+		}
+		if evaluation.Scores == nil {
+			evaluation.Scores = map[string]float64{}
+		}
+		if evaluation.Adjustments == nil {
+			evaluation.Adjustments = map[string]float64{}
+		}
+
+		for _, criterion := range rubricCriteria() {
+			value := strings.TrimSpace(r.FormValue(fmt.Sprintf("score[%s]", criterion.Name)))
+			if value == "" {
+				delete(evaluation.Scores, criterion.Name)
+				continue
+			}
+
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil || score < 0 || score > criterion.Max {
+				return fmt.Errorf("%s must be between 0 and %v", criterion.Name, criterion.Max)
+			}
+			evaluation.Scores[criterion.Name] = score
+		}
+
+		for _, member := range members {
+			value := strings.TrimSpace(r.FormValue(fmt.Sprintf("adjustment[%s]", member["ID"])))
+			adjustment, err := strconv.ParseFloat(value, 64)
+			if value != "" && err != nil {
+				return fmt.Errorf("Invalid adjustment for %s", member["FullName"])
+			}
+			evaluation.Adjustments[member["ID"]] = adjustment
+		}
+
+		if action == "finalize" {
+			if len(evaluation.Scores) != len(rubricCriteria()) {
+				return fmt.Errorf("Every criterion must be scored before finalizing")
+			}
+			evaluation.Status = evaluationFinal
+		}
+
+		evaluation.Comments = strings.TrimSpace(r.FormValue("comments"))
+		evaluation.Evaluator = CurrentUser(r).UserName
+		evaluation.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reopening clears the marks written when the evaluation was finalized.
+	if action == "finalize" || action == "reopen" {
+		_, err = jobs.Enqueue(jobGradesWrite, map[string]string{
+			"SlotID": slotID,
+			"Team":   team,
+		})
+	}
+
+	return err
+}
+
+// jobGradesWriteHandler writes the member totals of a final evaluation to the
+// grades sheet, or clears them once the evaluation is reopened. It reads the
+// evaluation as it is now, so the latest of several queued writes wins.
+func jobGradesWriteHandler(args map[string]string) error {
+	evaluation := evaluationFind(args["SlotID"], args["Team"])
+
+	members, err := google.SheetsTeamMembers(evaluation.Team)
+	if err != nil {
+		return err
+	}
+
+	userIDs := []string{}
+	for _, member := range members {
+		mark := ""
+		if evaluation.Final() {
+			mark = strconv.FormatFloat(evaluation.MemberTotal(member["ID"]), 'f', -1, 64)
+		}
+		if err := google.SheetsSetGrade(member["ID"], config.EvaluationsGradeMethod, mark); err != nil {
+			return err
+		}
+		userIDs = append(userIDs, member["ID"])
+	}
+
+	invalidateGrades(userIDs...)
+	return nil
+}
@@ -0,0 +1,125 @@
+package submit
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/store"
+)
+
+// withLocalSlots switches to the local scheduler backend holding the given
+// slots, with their teams booked in.
+func withLocalSlots(t *testing.T, slots ...*scheduler.Slot) {
+	openStore(t)
+
+	oldBackend, oldStart, oldEnd := config.EvaluationsBackend, config.EvaluationsWeekStart, config.EvaluationsWeekEnd
+	t.Cleanup(func() {
+		config.EvaluationsBackend, config.EvaluationsWeekStart, config.EvaluationsWeekEnd = oldBackend, oldStart, oldEnd
+	})
+	config.EvaluationsBackend = "local"
+	config.EvaluationsWeekStart = time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+	config.EvaluationsWeekEnd = time.Now().Add(7 * 24 * time.Hour).Format(time.RFC3339)
+
+	for _, slot := range slots {
+		teams := slot.Teams
+		slot.Teams = nil
+		if err := scheduler.Get().Create(slot); err != nil {
+			t.Fatal(err)
+		}
+		for _, team := range teams {
+			if err := scheduler.Get().Reserve(team, slot.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func evaluationForm(t *testing.T, values url.Values) *http.Request {
+	r := formRequest(values)
+	for _, cookie := range loggedInRequest(t, &User{UserName: "alice", group: "admins"}).Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	return r
+}
+
+func TestEvaluationSave(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	withLocalSlots(t, &scheduler.Slot{ID: "s1", Start: start, End: start.Add(time.Hour), Capacity: 2, Teams: []string{"Team 01"}})
+
+	oldRubric := config.EvaluationsRubric
+	t.Cleanup(func() { config.EvaluationsRubric = oldRubric })
+	config.EvaluationsRubric = []map[string]string{{"Name": "Demo", "Max": "10"}, {"Name": "Code", "Max": "5"}}
+
+	members := []map[string]string{{"ID": "1", "FullName": "One"}, {"ID": "2", "FullName": "Two"}}
+
+	tests := []struct {
+		name   string
+		slot   string
+		team   string
+		values url.Values
+		err    string
+		status string
+		total  float64
+	}{
+		{"other team", "s1", "Team 02", url.Values{"action": {"save"}, "score[Demo]": {"5"}}, "isn't booked", evaluationDraft, 0},
+		{"other slot", "s2", "Team 01", url.Values{"action": {"save"}, "score[Demo]": {"5"}}, "isn't booked", evaluationDraft, 0},
+		{"out of range", "s1", "Team 01", url.Values{"action": {"save"}, "score[Demo]": {"11"}}, "between 0 and 10", evaluationDraft, 0},
+		{"bad adjustment", "s1", "Team 01", url.Values{"action": {"save"}, "adjustment[1]": {"x"}}, "Invalid adjustment", evaluationDraft, 0},
+		{"draft", "s1", "Team 01", url.Values{"action": {"save"}, "score[Demo]": {"8"}}, "", evaluationDraft, 8},
+		{"finalize unscored", "s1", "Team 01", url.Values{"action": {"finalize"}, "score[Demo]": {"8"}}, "Every criterion", evaluationDraft, 8},
+		{"finalize", "s1", "Team 01", url.Values{"action": {"finalize"}, "score[Demo]": {"8"}, "score[Code]": {"4"}}, "", evaluationFinal, 12},
+		{"edit final", "s1", "Team 01", url.Values{"action": {"save"}, "score[Demo]": {"1"}}, "is final", evaluationFinal, 12},
+		{"reopen", "s1", "Team 01", url.Values{"action": {"reopen"}}, "", evaluationDraft, 12},
+		{"edit reopened", "s1", "Team 01", url.Values{"action": {"save"}, "score[Demo]": {"9"}, "score[Code]": {"4"}}, "", evaluationDraft, 13},
+	}
+
+	for _, tt := range tests {
+		err := evaluationSave(evaluationForm(t, tt.values), tt.slot, tt.team, members)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Fatalf("%s: evaluationSave() = %v, want %q", tt.name, err, tt.err)
+		}
+
+		evaluation := evaluationFind("s1", "Team 01")
+		if evaluation.Status != tt.status || evaluation.Total() != tt.total {
+			t.Fatalf("%s: evaluation is %s with %v, want %s with %v", tt.name,
+				evaluation.Status, evaluation.Total(), tt.status, tt.total)
+		}
+	}
+
+	if keys, _ := store.Keys(evaluationCollection); len(keys) != 1 {
+		t.Errorf("stored evaluations %v, want only the booked team's", keys)
+	}
+}
+
+func TestEvaluationMemberTotal(t *testing.T) {
+	oldRubric := config.EvaluationsRubric
+	t.Cleanup(func() { config.EvaluationsRubric = oldRubric })
+	config.EvaluationsRubric = []map[string]string{{"Name": "Demo", "Max": "10"}}
+
+	evaluation := &Evaluation{
+		Scores:      map[string]float64{"Demo": 7},
+		Adjustments: map[string]float64{"up": 5, "down": -10, "some": -2},
+	}
+
+	tests := []struct {
+		member string
+		want   float64
+	}{
+		{"none", 7},
+		{"up", 10},
+		{"down", 0},
+		{"some", 5},
+	}
+
+	for _, tt := range tests {
+		if got := evaluation.MemberTotal(tt.member); got != tt.want {
+			t.Errorf("MemberTotal(%q) = %v, want %v", tt.member, got, tt.want)
+		}
+	}
+}
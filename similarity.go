@@ -0,0 +1,341 @@
+package submit
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/archive"
+	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/similarity"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	jobSimilarity = "similarity.run"
+)
+
+// similarityReport keeps the matched line spans and shared fingerprints of
+// each flagged pair, and which Drive file each team's sources came from. The
+// sources themselves are read back from those files when a pair is viewed.
+type similarityReport struct {
+	ID         string
+	FolderID   string
+	Status     string
+	Error      string
+	Teams      int
+	CreatedAt  time.Time
+	FinishedAt time.Time
+	Pairs      []*similarity.Pair
+	Archives   map[string]map[string]string
+	Skipped    map[string]string
+}
+
+// similaritySkip is the error of a submission that can't be extracted, which
+// leaves its team out of the report rather than failing the report.
+type similaritySkip struct {
+	err error
+}
+
+func (s *similaritySkip) Error() string {
+	return s.err.Error()
+}
+
+type similarityLine struct {
+	No   int
+	Text string
+	Hit  bool
+}
+
+type similarityMatch struct {
+	FileA  string
+	FileB  string
+	LinesA []*similarityLine
+	LinesB []*similarityLine
+}
+
+func adminSimilarity() (string, http.HandlerFunc) {
+	return "/admin/similarity", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("similarity") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			folderID := strings.TrimSpace(r.FormValue("report[folder]"))
+			if folderID == "" {
+				folderID = config.SubmissionsFolderID
+			}
+
+			hasher := md5.New()
+			hasher.Write([]byte(folderID + strconv.FormatInt(time.Now().UnixNano(), 10)))
+			report := &similarityReport{
+				ID:        hex.EncodeToString(hasher.Sum(nil)),
+				FolderID:  folderID,
+				Status:    jobs.StatusQueued,
+				CreatedAt: time.Now(),
+			}
+
+			if err := store.Put("similarity", report.ID, report); err != nil {
+				panic(err)
+			}
+			if _, err := jobs.Enqueue(jobSimilarity, map[string]string{"ID": report.ID}); err != nil {
+				panic(err)
+			}
+
+			http.Redirect(w, r, "/admin/similarity", http.StatusFound)
+			return
+		}
+
+		all := map[string]*similarityReport{}
+		if err := store.All("similarity", &all); err != nil {
+			panic(err)
+		}
+
+		reports := []*similarityReport{}
+		for _, report := range all {
+			reports = append(reports, report)
+		}
+		sort.Slice(reports, func(i, j int) bool {
+			return reports[i].CreatedAt.After(reports[j].CreatedAt)
+		})
+
+		Render(w, r, "admin/similarity", map[string]interface{}{
+			"Reports":  reports,
+			"FolderID": config.SubmissionsFolderID,
+		})
+	}
+}
+
+func adminSimilarityReport() (string, http.HandlerFunc) {
+	return "/admin/similarity/report", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("similarity") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		report := &similarityReport{}
+		if found, _ := store.Get("similarity", r.URL.Query().Get("id"), report); !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		pairIndex, err := strconv.Atoi(r.URL.Query().Get("pair"))
+		if err != nil || pairIndex < 0 || pairIndex >= len(report.Pairs) {
+			Render(w, r, "admin/similarity_report", map[string]interface{}{
+				"Report": report,
+			})
+			return
+		}
+
+		pair := report.Pairs[pairIndex]
+		data := map[string]interface{}{
+			"Report": report,
+			"Pair":   pair,
+		}
+
+		filesA, err := similarityArchiveFiles(report.Archives[pair.TeamA])
+		if err != nil {
+			data["Flash"] = fmt.Sprintf("Couldn't read the submission of %s: %v", pair.TeamA, err)
+		}
+		filesB, err := similarityArchiveFiles(report.Archives[pair.TeamB])
+		if err != nil {
+			data["Flash"] = fmt.Sprintf("Couldn't read the submission of %s: %v", pair.TeamB, err)
+		}
+
+		matches := []*similarityMatch{}
+		for _, m := range pair.Matches {
+			matches = append(matches, &similarityMatch{
+				FileA:  m.FileA,
+				FileB:  m.FileB,
+				LinesA: similarityLines(filesA, m.FileA, m.LinesA),
+				LinesB: similarityLines(filesB, m.FileB, m.LinesB),
+			})
+		}
+		data["Matches"] = matches
+
+		Render(w, r, "admin/similarity_pair", data)
+	}
+}
+
+func similarityLines(files []*similarity.File, name string, hits []int) []*similarityLine {
+	hit := map[int]bool{}
+	for _, line := range hits {
+		hit[line] = true
+	}
+
+	lines := []*similarityLine{}
+	for _, f := range files {
+		if f.Name != name {
+			continue
+		}
+
+		for i, text := range similarity.Lines(f.Content) {
+			lines = append(lines, &similarityLine{
+				No:   i + 1,
+				Text: text,
+				Hit:  hit[i+1],
+			})
+		}
+	}
+
+	return lines
+}
+
+func jobSimilarityHandler(args map[string]string) error {
+	report := &similarityReport{}
+	if found, err := store.Get("similarity", args["ID"], report); err != nil || !found {
+		return fmt.Errorf("Couldn't find report %s", args["ID"])
+	}
+
+	report.Status = jobs.StatusRunning
+	store.Put("similarity", report.ID, report)
+
+	docs, archives, skipped, err := similarityDocuments(report.FolderID)
+	if err != nil {
+		report.Status = "failed"
+		report.Error = err.Error()
+		report.FinishedAt = time.Now()
+		store.Put("similarity", report.ID, report)
+		return err
+	}
+
+	report.Teams = len(docs)
+	report.Skipped = skipped
+	report.Pairs = similarity.CompareAll(docs, config.SimilarityThreshold)
+	report.Archives = map[string]map[string]string{}
+	for _, pair := range report.Pairs {
+		report.Archives[pair.TeamA] = archives[pair.TeamA]
+		report.Archives[pair.TeamB] = archives[pair.TeamB]
+	}
+	report.Status = jobs.StatusDone
+	report.Error = ""
+	report.FinishedAt = time.Now()
+
+	return store.Put("similarity", report.ID, report)
+}
+
+// similarityDocuments fingerprints the latest submission of every team, and
+// returns which Drive file each team's document was read from and why the
+// teams whose archives couldn't be extracted were skipped.
+func similarityDocuments(folderID string) ([]*similarity.Document, map[string]map[string]string, map[string]string, error) {
+	submissions, err := google.DriveTeamSubmissions(folderID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	docs := []*similarity.Document{}
+	archives := map[string]map[string]string{}
+	skipped := map[string]string{}
+	for _, submission := range submissions {
+		files, err := similarityArchiveFiles(submission)
+		if skip, ok := err.(*similaritySkip); ok {
+			skipped[submission["Team"]] = skip.Error()
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		doc := &similarity.Document{Team: submission["Team"], Files: files}
+		if len(doc.Files) > 0 {
+			doc.Fingerprint(config.SimilarityKGram, config.SimilarityWindow)
+			docs = append(docs, doc)
+			archives[doc.Team] = map[string]string{"ID": submission["ID"], "Name": submission["Name"]}
+		}
+	}
+
+	return docs, archives, skipped, nil
+}
+
+// similarityArchiveFiles downloads a submission from Drive and reads the
+// source files out of it. Submissions that aren't archives are read as is;
+// archives that fail to extract are a similaritySkip, so what was partially
+// extracted is never read.
+func similarityArchiveFiles(submission map[string]string) ([]*similarity.File, error) {
+	if submission == nil {
+		return nil, fmt.Errorf("No submission recorded")
+	}
+
+	dir, err := ioutil.TempDir("", "similarity-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	teamDir := filepath.Join(dir, "files")
+	if err := os.MkdirAll(teamDir, 0700); err != nil {
+		return nil, err
+	}
+
+	downloadPath := filepath.Join(dir, filepath.Base(submission["Name"]))
+	f, err := os.Create(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	err = google.DriveDownload(submission["ID"], f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if !archive.Supported(downloadPath) {
+		if err := os.Rename(downloadPath, filepath.Join(teamDir, filepath.Base(submission["Name"]))); err != nil {
+			return nil, err
+		}
+	} else if err := archive.Extract(downloadPath, teamDir); err != nil {
+		return nil, &similaritySkip{err}
+	}
+
+	files := []*similarity.File{}
+	filepath.Walk(teamDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Size() > config.SimilarityMaxFileSize || !similaritySource(path) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		name, _ := filepath.Rel(teamDir, path)
+		files = append(files, &similarity.File{
+			Name:    name,
+			Content: string(content),
+		})
+		return nil
+	})
+
+	return files, nil
+}
+
+func similaritySource(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range config.SimilarityExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
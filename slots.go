@@ -0,0 +1,328 @@
+package submit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/scheduler"
+)
+
+const (
+	jobSlotCreate = "slots.create"
+	jobSlotUpdate = "slots.update"
+	jobSlotDelete = "slots.delete"
+)
+
+type slotBlock struct {
+	ID       string
+	From     time.Time
+	To       time.Time
+	Slots    []*scheduler.Slot
+	Reserved int
+}
+
+func adminSlots() (string, http.HandlerFunc) {
+	return "/admin/slots", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		data := map[string]interface{}{}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			var err error
+			var success string
+			switch action := r.FormValue("action"); action {
+			case "preview", "create":
+				for _, field := range []string{"from", "to", "windows", "skip", "length", "break", "capacity", "rooms", "video", "evaluators"} {
+					data[strings.Title(field)] = r.FormValue(fmt.Sprintf("slots[%s]", field))
+				}
+
+				var slots []*scheduler.Slot
+				if slots, err = slotPlanSlots(r); err != nil {
+					break
+				}
+
+				if action == "preview" {
+					data["Preview"] = newSchedule(slots)
+					data["PreviewCount"] = len(slots)
+					break
+				}
+
+				for _, slot := range slots {
+					if _, err = jobs.Enqueue(jobSlotCreate, slotArgs(slot)); err != nil {
+						break
+					}
+				}
+				success = fmt.Sprintf("Creating %d slots.", len(slots))
+			case "delete", "shift":
+				success, err = slotBlockAction(action, r.FormValue("block[id]"), r.FormValue("block[shift]"))
+			}
+
+			if err != nil {
+				data["Flash"] = err.Error()
+			} else {
+				data["Success"] = success
+			}
+		}
+
+		blocks, err := slotBlocks()
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+		data["Blocks"] = blocks
+
+		Render(w, r, "admin/slots", data)
+	}
+}
+
+func adminAgenda() (string, http.HandlerFunc) {
+	return "/admin/agenda", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("evaluations") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		evaluator := r.URL.Query().Get("evaluator")
+		if evaluator == "" {
+			evaluator = CurrentUser(r).UserName
+		}
+
+		slots, err := scheduler.Get().Slots()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		agenda := []*scheduler.Slot{}
+		for _, slot := range slots {
+			if slot.HasEvaluator(evaluator) {
+				agenda = append(agenda, slot)
+			}
+		}
+
+		Render(w, r, "admin/agenda", map[string]interface{}{
+			"Evaluator": evaluator,
+			"Schedule":  newSchedule(agenda),
+			"FeedURL":   calendarFeedURL(r, calendarFeedEvaluator, evaluator),
+		})
+	}
+}
+
+func slotPlanSlots(r *http.Request) ([]*scheduler.Slot, error) {
+	loc, err := time.LoadLocation(config.EvaluationsTimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", r.FormValue("slots[from]"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid start date")
+	}
+	to, err := time.ParseInLocation("2006-01-02", r.FormValue("slots[to]"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid end date")
+	}
+	length, err := strconv.Atoi(r.FormValue("slots[length]"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid slot length")
+	}
+	gap, _ := strconv.Atoi(r.FormValue("slots[break]"))
+	capacity, _ := strconv.Atoi(r.FormValue("slots[capacity]"))
+
+	plan := &scheduler.Plan{
+		From:       from,
+		To:         to,
+		Windows:    splitList(r.FormValue("slots[windows]")),
+		SkipDays:   splitList(r.FormValue("slots[skip]")),
+		Length:     time.Duration(length) * time.Minute,
+		Break:      time.Duration(gap) * time.Minute,
+		Rooms:      splitList(r.FormValue("slots[rooms]")),
+		VideoURL:   strings.TrimSpace(r.FormValue("slots[video]")),
+		Capacity:   capacity,
+		Evaluators: splitList(r.FormValue("slots[evaluators]")),
+	}
+
+	return plan.Generate(slotPlanBlock(r))
+}
+
+// slotPlanBlock derives the block ID from the plan, so submitting the same
+// plan again yields the same slots and the create jobs skip those that exist.
+func slotPlanBlock(r *http.Request) string {
+	hasher := sha1.New()
+	for _, field := range []string{"from", "to", "windows", "skip", "length", "break", "capacity", "rooms", "video", "evaluators"} {
+		fmt.Fprintf(hasher, "%s=%s\n", field, strings.TrimSpace(r.FormValue(fmt.Sprintf("slots[%s]", field))))
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))[:12]
+}
+
+func slotBlocks() ([]*slotBlock, error) {
+	slots, err := scheduler.Get().Slots()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*slotBlock{}
+	blocks := []*slotBlock{}
+	for _, slot := range slots {
+		if slot.Block == "" {
+			continue
+		}
+
+		block, ok := byID[slot.Block]
+		if !ok {
+			block = &slotBlock{ID: slot.Block, From: slot.Start, To: slot.End}
+			byID[slot.Block] = block
+			blocks = append(blocks, block)
+		}
+
+		block.Slots = append(block.Slots, slot)
+		if len(slot.Teams) > 0 {
+			block.Reserved++
+		}
+		if slot.Start.Before(block.From) {
+			block.From = slot.Start
+		}
+		if slot.End.After(block.To) {
+			block.To = slot.End
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].From.Before(blocks[j].From)
+	})
+
+	return blocks, nil
+}
+
+func slotBlockAction(action, blockID, shift string) (string, error) {
+	blocks, err := slotBlocks()
+	if err != nil {
+		return "", err
+	}
+
+	var block *slotBlock
+	for _, b := range blocks {
+		if b.ID == blockID {
+			block = b
+		}
+	}
+	if block == nil {
+		return "", fmt.Errorf("Couldn't find block %s", blockID)
+	}
+
+	switch action {
+	case "delete":
+		for _, slot := range block.Slots {
+			if len(slot.Teams) > 0 {
+				continue
+			}
+			if _, err := jobs.Enqueue(jobSlotDelete, map[string]string{"ID": slot.ID}); err != nil {
+				return "", err
+			}
+		}
+
+		success := fmt.Sprintf("Deleting %d slots.", len(block.Slots)-block.Reserved)
+		if block.Reserved > 0 {
+			success += fmt.Sprintf(" %d reserved slots were kept.", block.Reserved)
+		}
+		return success, nil
+	case "shift":
+		d, err := time.ParseDuration(shift)
+		if err != nil {
+			return "", fmt.Errorf("Invalid shift: %s", shift)
+		}
+
+		// Teams booked into the block are told about the new time.
+		notified := 0
+		for _, slot := range block.Slots {
+			from := slot.Start
+			slot.Start = slot.Start.Add(d)
+			slot.End = slot.End.Add(d)
+			if _, err := jobs.Enqueue(jobSlotUpdate, slotArgs(slot)); err != nil {
+				return "", err
+			}
+
+			for _, teamName := range slot.Teams {
+				notifyTeam(teamName, fmt.Sprintf("%s's evaluation was moved from %s to %s.",
+					teamName, reminderTime(from), reminderTime(slot.Start)))
+				notified++
+			}
+		}
+
+		success := fmt.Sprintf("Shifting %d slots by %v.", len(block.Slots), d)
+		if notified > 0 {
+			success += fmt.Sprintf(" %d booked teams will be notified.", notified)
+		}
+		return success, nil
+	}
+
+	return "", nil
+}
+
+func slotArgs(slot *scheduler.Slot) map[string]string {
+	return map[string]string{
+		"ID":         slot.ID,
+		"Start":      slot.Start.Format(time.RFC3339),
+		"End":        slot.End.Format(time.RFC3339),
+		"Capacity":   strconv.Itoa(slot.Capacity),
+		"Location":   slot.Location,
+		"VideoURL":   slot.VideoURL,
+		"Evaluators": strings.Join(slot.Evaluators, ","),
+		"Block":      slot.Block,
+	}
+}
+
+func slotFromArgs(args map[string]string) *scheduler.Slot {
+	slot := &scheduler.Slot{
+		ID:         args["ID"],
+		Location:   args["Location"],
+		VideoURL:   args["VideoURL"],
+		Evaluators: splitList(args["Evaluators"]),
+		Block:      args["Block"],
+	}
+	slot.Capacity, _ = strconv.Atoi(args["Capacity"])
+	slot.Start, _ = time.Parse(time.RFC3339, args["Start"])
+	slot.End, _ = time.Parse(time.RFC3339, args["End"])
+
+	return slot
+}
+
+// jobSlotCreateHandler creates a slot. Generated slots are looked up by their
+// key, so retried jobs and resubmitted plans don't duplicate them.
+func jobSlotCreateHandler(args map[string]string) error {
+	if err := scheduler.Get().Create(slotFromArgs(args)); err != nil {
+		return err
+	}
+
+	promoteWaitlist()
+	return nil
+}
+
+func jobSlotUpdateHandler(args map[string]string) error {
+	return scheduler.Get().Update(slotFromArgs(args))
+}
+
+func jobSlotDeleteHandler(args map[string]string) error {
+	return scheduler.Get().Delete(args["ID"])
+}
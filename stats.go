@@ -0,0 +1,228 @@
+package submit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/google"
+	gradestats "github.com/ramin0/submit/lib/grades"
+)
+
+var (
+	gradeBookLock     sync.Mutex
+	gradeBookCachedAt time.Time
+	gradeBookCache    *GradeBook
+)
+
+// GradeBook struct
+type GradeBook struct {
+	Methods  []string
+	Marks    map[string][]string
+	Students []map[string]string
+}
+
+// GradeStats struct
+type GradeStats struct {
+	Name string
+	*gradestats.Stats
+}
+
+// GradeRow struct
+type GradeRow struct {
+	Method     string
+	Mark       string
+	Stats      *gradestats.Stats
+	Percentile float64
+}
+
+// Column func
+func (b *GradeBook) Column(method string, filter func(student map[string]string) bool) []float64 {
+	col := -1
+	for i, m := range b.Methods {
+		if m == method {
+			col = i
+		}
+	}
+	if col == -1 {
+		return nil
+	}
+
+	marks := []string{}
+	for _, student := range b.Students {
+		if filter != nil && !filter(student) {
+			continue
+		}
+
+		if row := b.Marks[student["ID"]]; col < len(row) {
+			marks = append(marks, row[col])
+		}
+	}
+
+	return gradestats.Parse(marks)
+}
+
+// gradeBook returns the whole grades sheet joined with the students sheet,
+// cached for GradesStatsCacheTTL.
+func gradeBook() (*GradeBook, error) {
+	gradeBookLock.Lock()
+	defer gradeBookLock.Unlock()
+
+	ttl, _ := time.ParseDuration(config.GradesStatsCacheTTL)
+	if gradeBookCache != nil && time.Since(gradeBookCachedAt) < ttl {
+		return gradeBookCache, nil
+	}
+
+	methods, marks, err := google.SheetsAllGrades()
+	if err != nil {
+		return nil, err
+	}
+	students, err := google.SheetsStudents()
+	if err != nil {
+		return nil, err
+	}
+
+	gradeBookCache = &GradeBook{Methods: methods, Marks: marks, Students: students}
+	gradeBookCachedAt = time.Now()
+
+	return gradeBookCache, nil
+}
+
+func invalidateGradeBook() {
+	gradeBookLock.Lock()
+	defer gradeBookLock.Unlock()
+
+	gradeBookCache = nil
+}
+
+// gradesStats computes the class-wide stats of each method, leaving out those
+// with too few marks to stay anonymous.
+func gradesStats(methods []string) map[string]*gradestats.Stats {
+	stats := map[string]*gradestats.Stats{}
+
+	book, err := gradeBook()
+	if err != nil {
+		return stats
+	}
+
+	for _, method := range methods {
+		s := gradestats.Compute(book.Column(method, nil), config.GradesStatsBuckets)
+		if s.Count >= config.GradesStatsMinCount {
+			stats[method] = s
+		}
+	}
+
+	return stats
+}
+
+func gradeRows(methods, marks []string) []*GradeRow {
+	stats := gradesStats(methods)
+
+	rows := []*GradeRow{}
+	for i, method := range methods {
+		row := &GradeRow{Method: method, Stats: stats[method]}
+		if i < len(marks) {
+			row.Mark = marks[i]
+		}
+		if value := gradestats.Parse([]string{row.Mark}); row.Stats != nil && len(value) == 1 {
+			row.Percentile = row.Stats.Percentile(value[0])
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func adminAnalytics() (string, http.HandlerFunc) {
+	return "/admin/analytics", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("grades") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		data := map[string]interface{}{}
+
+		book, err := gradeBook()
+		if err != nil {
+			data["Flash"] = err.Error()
+			Render(w, r, "admin/analytics", data)
+			return
+		}
+
+		method := r.URL.Query().Get("method")
+		if method == "" && len(book.Methods) > 0 {
+			method = book.Methods[0]
+		}
+
+		overall := gradestats.Compute(book.Column(method, nil), config.GradesStatsBuckets)
+		groups := gradeStatsBy(book, method, "TeamGroup")
+		teams := gradeStatsBy(book, method, "Team")
+
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", method+".csv"))
+
+			out := csv.NewWriter(w)
+			out.Write([]string{"Scope", "Name", "Count", "Mean", "Median", "StdDev", "Min", "Max"})
+			write := func(scope string, s *GradeStats) {
+				out.Write([]string{scope, s.Name, strconv.Itoa(s.Count),
+					formatMark(s.Mean), formatMark(s.Median), formatMark(s.StdDev), formatMark(s.Min), formatMark(s.Max)})
+			}
+			write("All", &GradeStats{Name: method, Stats: overall})
+			for _, s := range groups {
+				write("Tutorial Group", s)
+			}
+			for _, s := range teams {
+				write("Team", s)
+			}
+			out.Flush()
+			return
+		}
+
+		data["Methods"] = book.Methods
+		data["Method"] = method
+		data["Overall"] = overall
+		data["Groups"] = groups
+		data["Teams"] = teams
+
+		Render(w, r, "admin/analytics", data)
+	}
+}
+
+func gradeStatsBy(book *GradeBook, method, field string) []*GradeStats {
+	names := map[string]bool{}
+	for _, student := range book.Students {
+		if student[field] != "" {
+			names[student[field]] = true
+		}
+	}
+
+	stats := []*GradeStats{}
+	for name := range names {
+		stats = append(stats, &GradeStats{
+			Name: name,
+			Stats: gradestats.Compute(book.Column(method, func(student map[string]string) bool {
+				return student[field] == name
+			}), config.GradesStatsBuckets),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+func formatMark(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
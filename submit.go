@@ -4,10 +4,27 @@ import (
 	"log"
 	"net/http"
 	"os"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/store"
 )
 
+// Start opens the store and starts the background jobs. Engage calls it;
+// call it before serving Mux() any other way.
+func Start() error {
+	if err := store.Open(config.StorePath); err != nil {
+		return err
+	}
+
+	return startJobs()
+}
+
 // Engage func
 func Engage(mux http.Handler) error {
+	if err := Start(); err != nil {
+		return err
+	}
+
 	if mux == nil {
 		mux = Mux()
 	}
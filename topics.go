@@ -0,0 +1,387 @@
+package submit
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	topicCollection       = "topics"
+	topicChoiceCollection = "topic_choices"
+
+	topicsFirstCome  = "first-come"
+	topicsPreference = "preference"
+
+	jobTopicsAllocate = "topics.allocate"
+)
+
+var (
+	topicsLock sync.Mutex
+)
+
+// Topic struct
+type Topic struct {
+	ID          string
+	Title       string
+	Description string
+	Capacity    int
+	Teams       []string
+	CreatedAt   time.Time
+}
+
+// Remaining func
+func (t *Topic) Remaining() int {
+	return t.Capacity - len(t.Teams)
+}
+
+// TopicChoice struct
+type TopicChoice struct {
+	Team        string
+	Preferences []string
+	Topic       string
+	SubmittedAt time.Time
+	UpdatedAt   time.Time
+	UpdatedBy   string
+	AllocatedAt time.Time
+}
+
+// Preference returns the topic a team ranked at the given 1-based rank.
+func (c *TopicChoice) Preference(rank int) string {
+	if rank > 0 && rank <= len(c.Preferences) {
+		return c.Preferences[rank-1]
+	}
+
+	return ""
+}
+
+func topicsAll() ([]*Topic, error) {
+	all := map[string]*Topic{}
+	if err := store.All(topicCollection, &all); err != nil {
+		return nil, err
+	}
+
+	topics := make([]*Topic, 0, len(all))
+	for _, topic := range all {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].CreatedAt.Before(topics[j].CreatedAt)
+	})
+
+	return topics, nil
+}
+
+func topicFind(id string) *Topic {
+	topic := &Topic{}
+	if found, _ := store.Get(topicCollection, id, topic); !found {
+		return nil
+	}
+
+	return topic
+}
+
+func topicChoiceFind(teamName string) *TopicChoice {
+	choice := &TopicChoice{}
+	if found, _ := store.Get(topicChoiceCollection, teamName, choice); !found {
+		return &TopicChoice{Team: teamName}
+	}
+
+	return choice
+}
+
+func topicChoices() ([]*TopicChoice, error) {
+	all := map[string]*TopicChoice{}
+	if err := store.All(topicChoiceCollection, &all); err != nil {
+		return nil, err
+	}
+
+	choices := make([]*TopicChoice, 0, len(all))
+	for _, choice := range all {
+		choices = append(choices, choice)
+	}
+	sort.Slice(choices, func(i, j int) bool {
+		return choices[i].firstSubmitted().Before(choices[j].firstSubmitted())
+	})
+
+	return choices, nil
+}
+
+// firstSubmitted returns when the team first sent its preferences; changing
+// them later doesn't lose the team its turn.
+func (c *TopicChoice) firstSubmitted() time.Time {
+	if c.SubmittedAt.IsZero() {
+		return c.UpdatedAt
+	}
+
+	return c.SubmittedAt
+}
+
+// teamTopic returns the topic allocated to a team, if any.
+func teamTopic(teamName string) *Topic {
+	choice := topicChoiceFind(teamName)
+	if choice.Topic == "" {
+		return nil
+	}
+
+	return topicFind(choice.Topic)
+}
+
+func topicsDeadlinePassed() bool {
+	deadline, err := time.Parse(time.RFC3339, config.ProposalsTopicsDeadline)
+	return err == nil && time.Now().After(deadline)
+}
+
+func topicCreate(title, description, capacity string) error {
+	if title == "" {
+		return fmt.Errorf("Make sure all fields are populated")
+	}
+
+	n, err := strconv.Atoi(capacity)
+	if err != nil || n < 1 {
+		return fmt.Errorf("Invalid capacity: %s", capacity)
+	}
+
+	now := time.Now()
+	hasher := md5.New()
+	hasher.Write([]byte(title + strconv.FormatInt(now.UnixNano(), 10)))
+
+	topic := &Topic{
+		ID:          hex.EncodeToString(hasher.Sum(nil)),
+		Title:       title,
+		Description: description,
+		Capacity:    n,
+		Teams:       []string{},
+		CreatedAt:   now,
+	}
+
+	return store.Put(topicCollection, topic.ID, topic)
+}
+
+func topicDelete(id string) error {
+	topicsLock.Lock()
+	defer topicsLock.Unlock()
+
+	topic := topicFind(id)
+	if topic == nil {
+		return fmt.Errorf("Couldn't find topic %s", id)
+	}
+	if len(topic.Teams) > 0 {
+		return fmt.Errorf("%s is allocated to %s", topic.Title, strings.Join(topic.Teams, ", "))
+	}
+
+	return store.Delete(topicCollection, id)
+}
+
+// topicChoose stores the ranked preferences of a team. When topics are handed
+// out first-come, the team gets its highest-ranked topic with room left right
+// away, giving up the one it had.
+func topicChoose(r *http.Request, user *User) error {
+	if topicsDeadlinePassed() {
+		return fmt.Errorf("Topic choices are closed")
+	}
+
+	topics, err := topicsAll()
+	if err != nil {
+		return err
+	}
+
+	preferences := []string{}
+	seen := map[string]bool{}
+	for i := 1; i <= len(topics); i++ {
+		id := r.FormValue(fmt.Sprintf("topic[%d]", i))
+		if id == "" || seen[id] {
+			continue
+		}
+		if topicFind(id) == nil {
+			return fmt.Errorf("Couldn't find topic %s", id)
+		}
+
+		seen[id] = true
+		preferences = append(preferences, id)
+	}
+	if len(preferences) == 0 {
+		return fmt.Errorf("Please choose at least one topic")
+	}
+
+	teamName := user.TeamName()
+	if teamName == "" {
+		return fmt.Errorf("You need to be in a team to choose a topic")
+	}
+
+	topicsLock.Lock()
+	defer topicsLock.Unlock()
+
+	choice := topicChoiceFind(teamName)
+	err = store.Update(topicChoiceCollection, teamName, choice, func(found bool) error {
+		choice.Team = teamName
+		choice.Preferences = preferences
+		if choice.SubmittedAt.IsZero() {
+			choice.SubmittedAt = time.Now()
+		}
+		choice.UpdatedAt = time.Now()
+		choice.UpdatedBy = user.UserName
+		return nil
+	})
+	if err != nil || config.ProposalsTopicAllocation != topicsFirstCome {
+		return err
+	}
+
+	for _, id := range preferences {
+		if id == choice.Topic {
+			return nil
+		}
+		if topic := topicFind(id); topic != nil && topic.Remaining() > 0 {
+			return topicAssign(teamName, id)
+		}
+	}
+
+	return fmt.Errorf("All the topics you chose are taken")
+}
+
+// topicAssign moves a team to a topic, or off any topic when id is empty. The
+// caller must hold topicsLock.
+func topicAssign(teamName, id string) error {
+	choice := topicChoiceFind(teamName)
+
+	if choice.Topic != "" {
+		old := &Topic{}
+		err := store.Update(topicCollection, choice.Topic, old, func(found bool) error {
+			teams := []string{}
+			for _, team := range old.Teams {
+				if team != teamName {
+					teams = append(teams, team)
+				}
+			}
+			old.Teams = teams
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if id != "" {
+		topic := &Topic{}
+		err := store.Update(topicCollection, id, topic, func(found bool) error {
+			if !found {
+				return fmt.Errorf("Couldn't find topic %s", id)
+			}
+			if topic.Remaining() <= 0 {
+				return fmt.Errorf("%s is full", topic.Title)
+			}
+			topic.Teams = append(topic.Teams, teamName)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return store.Update(topicChoiceCollection, teamName, choice, func(found bool) error {
+		choice.Team = teamName
+		choice.Topic = id
+		choice.AllocatedAt = time.Now()
+		return nil
+	})
+}
+
+// jobTopicsAllocateHandler hands out topics by preference: teams take turns in
+// the order they first sent their preferences, each getting its highest-ranked topic
+// with room left. Allocations made before are cleared first.
+func jobTopicsAllocateHandler(args map[string]string) error {
+	topicsLock.Lock()
+	defer topicsLock.Unlock()
+
+	choices, err := topicChoices()
+	if err != nil {
+		return err
+	}
+
+	for _, choice := range choices {
+		if err := topicAssign(choice.Team, ""); err != nil {
+			return err
+		}
+	}
+
+	for _, choice := range choices {
+		for _, id := range choice.Preferences {
+			if topic := topicFind(id); topic != nil && topic.Remaining() > 0 {
+				if err := topicAssign(choice.Team, id); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func adminTopics() (string, http.HandlerFunc) {
+	return "/admin/topics", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("proposals") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		data := map[string]interface{}{}
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+
+			var err error
+			switch r.FormValue("action") {
+			case "create":
+				err = topicCreate(strings.TrimSpace(r.FormValue("topic[title]")),
+					strings.TrimSpace(r.FormValue("topic[description]")), r.FormValue("topic[capacity]"))
+			case "delete":
+				err = topicDelete(r.FormValue("topic[id]"))
+			case "allocate":
+				if config.ProposalsTopicAllocation != topicsPreference {
+					err = fmt.Errorf("Topics are handed out first-come")
+				} else if !topicsDeadlinePassed() {
+					err = fmt.Errorf("Topics can only be allocated after the deadline")
+				} else if _, err = jobs.Enqueue(jobTopicsAllocate, map[string]string{}); err == nil {
+					data["Success"] = "Allocation started."
+				}
+			}
+			if err != nil {
+				data["Flash"] = err.Error()
+			}
+		}
+
+		topics, err := topicsAll()
+		if err != nil {
+			data["Flash"] = err.Error()
+		}
+		choices, _ := topicChoices()
+
+		titles := map[string]string{}
+		for _, topic := range topics {
+			titles[topic.ID] = topic.Title
+		}
+
+		data["Topics"] = topics
+		data["Choices"] = choices
+		data["Titles"] = titles
+		data["Mode"] = config.ProposalsTopicAllocation
+		data["DeadlinePassed"] = topicsDeadlinePassed()
+
+		Render(w, r, "admin/topics", data)
+	}
+}
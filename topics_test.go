@@ -0,0 +1,169 @@
+package submit
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/store"
+)
+
+// withTopics stores topics named after their IDs, created in the given order.
+func withTopics(t *testing.T, mode string, capacities map[string]int, order ...string) {
+	openStore(t)
+
+	oldMode, oldDeadline := config.ProposalsTopicAllocation, config.ProposalsTopicsDeadline
+	t.Cleanup(func() { config.ProposalsTopicAllocation, config.ProposalsTopicsDeadline = oldMode, oldDeadline })
+	config.ProposalsTopicAllocation = mode
+	config.ProposalsTopicsDeadline = ""
+
+	created := time.Now().Add(-time.Hour)
+	for i, id := range order {
+		topic := &Topic{ID: id, Title: id, Capacity: capacities[id], Teams: []string{}, CreatedAt: created.Add(time.Duration(i) * time.Minute)}
+		if err := store.Put(topicCollection, id, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func topicForm(preferences ...string) *http.Request {
+	values := url.Values{}
+	for i, id := range preferences {
+		values.Set("topic["+strconv.Itoa(i+1)+"]", id)
+	}
+
+	return formRequest(values)
+}
+
+func TestTopicChooseFirstCome(t *testing.T) {
+	withTopics(t, topicsFirstCome, map[string]int{"A": 1, "B": 1}, "A", "B")
+
+	tests := []struct {
+		name        string
+		team        string
+		preferences []string
+		err         string
+		want        string
+	}{
+		{"nothing chosen", "Team 01", nil, "at least one", ""},
+		{"unknown topic", "Team 01", []string{"C"}, "Couldn't find topic C", ""},
+		{"first choice", "Team 01", []string{"A", "B"}, "", "A"},
+		{"next choice", "Team 02", []string{"A", "B"}, "", "B"},
+		{"all taken", "Team 03", []string{"B", "A"}, "are taken", ""},
+		{"keeps its topic", "Team 02", []string{"A", "B"}, "", "B"},
+		{"can't move to a full topic", "Team 01", []string{"B"}, "are taken", "A"},
+		{"duplicates ignored", "Team 01", []string{"A", "A"}, "", "A"},
+	}
+
+	for _, tt := range tests {
+		user := &User{UserName: tt.team, teamName: tt.team}
+		err := topicChoose(topicForm(tt.preferences...), user)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Fatalf("%s: topicChoose() = %v, want %q", tt.name, err, tt.err)
+		}
+
+		if got := topicChoiceFind(tt.team).Topic; got != tt.want {
+			t.Errorf("%s: %s has topic %q, want %q", tt.name, tt.team, got, tt.want)
+		}
+	}
+
+	for id, want := range map[string]string{"A": "Team 01", "B": "Team 02"} {
+		if teams := topicFind(id).Teams; strings.Join(teams, ",") != want {
+			t.Errorf("topic %s holds %v, want %s", id, teams, want)
+		}
+	}
+
+	config.ProposalsTopicsDeadline = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if err := topicChoose(topicForm("A"), &User{teamName: "Team 04"}); err == nil {
+		t.Error("chose a topic after the deadline")
+	}
+}
+
+func TestTopicsAllocatePreference(t *testing.T) {
+	type choice struct {
+		team        string
+		preferences []string
+		// topic was allocated by an earlier run.
+		topic string
+	}
+
+	tests := []struct {
+		name       string
+		capacities map[string]int
+		choices    []choice
+		want       map[string]string
+	}{
+		{
+			name:       "everyone gets their first choice",
+			capacities: map[string]int{"A": 1, "B": 1},
+			choices:    []choice{{team: "T1", preferences: []string{"A"}}, {team: "T2", preferences: []string{"B"}}},
+			want:       map[string]string{"T1": "A", "T2": "B"},
+		},
+		{
+			name:       "earlier teams win",
+			capacities: map[string]int{"A": 1, "B": 1},
+			choices:    []choice{{team: "T1", preferences: []string{"A", "B"}}, {team: "T2", preferences: []string{"A", "B"}}},
+			want:       map[string]string{"T1": "A", "T2": "B"},
+		},
+		{
+			name:       "capacity shared",
+			capacities: map[string]int{"A": 2, "B": 1},
+			choices: []choice{
+				{team: "T1", preferences: []string{"A"}},
+				{team: "T2", preferences: []string{"A", "B"}},
+				{team: "T3", preferences: []string{"A", "B"}},
+			},
+			want: map[string]string{"T1": "A", "T2": "A", "T3": "B"},
+		},
+		{
+			name:       "left without a topic",
+			capacities: map[string]int{"A": 1},
+			choices:    []choice{{team: "T1", preferences: []string{"A"}}, {team: "T2", preferences: []string{"A"}}},
+			want:       map[string]string{"T1": "A", "T2": ""},
+		},
+		{
+			name:       "earlier allocation cleared",
+			capacities: map[string]int{"A": 1, "B": 1},
+			choices:    []choice{{team: "T1", preferences: []string{"A"}}, {team: "T2", preferences: []string{"B", "A"}, topic: "A"}},
+			want:       map[string]string{"T1": "A", "T2": "B"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTopics(t, topicsPreference, tt.capacities, "A", "B")
+
+			submitted := time.Now().Add(-time.Hour)
+			for i, c := range tt.choices {
+				choice := &TopicChoice{Team: c.team, Preferences: c.preferences, SubmittedAt: submitted.Add(time.Duration(i) * time.Minute)}
+				if err := store.Put(topicChoiceCollection, c.team, choice); err != nil {
+					t.Fatal(err)
+				}
+				if c.topic != "" {
+					if err := topicAssign(c.team, c.topic); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if err := jobTopicsAllocateHandler(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			for team, want := range tt.want {
+				if got := topicChoiceFind(team).Topic; got != want {
+					t.Errorf("%s got %q, want %q", team, got, want)
+				}
+			}
+			for id, capacity := range tt.capacities {
+				if topic := topicFind(id); len(topic.Teams) > capacity {
+					t.Errorf("topic %s holds %v, over its capacity of %d", id, topic.Teams, capacity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package submit
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+
+	"github.com/ramin0/submit/config"
+	gradestats "github.com/ramin0/submit/lib/grades"
+)
+
+// StudentTotal struct
+type StudentTotal struct {
+	Student map[string]string
+	*gradestats.Result
+}
+
+func gradeFormula() *gradestats.Formula {
+	formula := &gradestats.Formula{Cap: config.GradesTotalCap}
+
+	for _, item := range config.GradesComponents {
+		max, _ := strconv.ParseFloat(item["Max"], 64)
+		weight, _ := strconv.ParseFloat(item["Weight"], 64)
+		formula.Components = append(formula.Components, &gradestats.Component{
+			Method:   item["Method"],
+			Type:     item["Type"],
+			Category: item["Category"],
+			Max:      max,
+			Weight:   weight,
+		})
+	}
+
+	for _, item := range config.GradesCategories {
+		weight, _ := strconv.ParseFloat(item["Weight"], 64)
+		drop, _ := strconv.Atoi(item["DropLowest"])
+		limit, _ := strconv.ParseFloat(item["Cap"], 64)
+		formula.Categories = append(formula.Categories, &gradestats.Category{
+			Name:       item["Name"],
+			Weight:     weight,
+			DropLowest: drop,
+			Cap:        limit,
+		})
+	}
+
+	for _, item := range config.GradesLetterScale {
+		min, _ := strconv.ParseFloat(item["Min"], 64)
+		formula.Scale = append(formula.Scale, &gradestats.Letter{Letter: item["Letter"], Min: min})
+	}
+
+	return formula
+}
+
+// gradeTotal applies the configured formula to the given marks, or returns
+// nil if no components are configured.
+func gradeTotal(methods, marks []string) *gradestats.Result {
+	if len(config.GradesComponents) == 0 {
+		return nil
+	}
+
+	byMethod := map[string]string{}
+	for i, method := range methods {
+		if i < len(marks) {
+			byMethod[method] = marks[i]
+		}
+	}
+
+	return gradeFormula().Apply(byMethod)
+}
+
+func adminTotals() (string, http.HandlerFunc) {
+	return "/admin/totals", func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled("grades") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !ensureLoggedInAdmin(w, r) {
+			return
+		}
+
+		data := map[string]interface{}{}
+
+		book, err := gradeBook()
+		if err != nil {
+			data["Flash"] = err.Error()
+			Render(w, r, "admin/totals", data)
+			return
+		}
+
+		totals := []*StudentTotal{}
+		for _, student := range book.Students {
+			result := gradeTotal(book.Methods, book.Marks[student["ID"]])
+			if result == nil {
+				break
+			}
+
+			totals = append(totals, &StudentTotal{Student: student, Result: result})
+		}
+
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=\"totals.csv\"")
+
+			out := csv.NewWriter(w)
+			out.Write([]string{"ID", "Name", "Team", "Tutorial Group", "Total", "Graded", "Letter"})
+			for _, total := range totals {
+				out.Write([]string{total.Student["ID"], total.Student["FullName"], total.Student["Team"],
+					total.Student["TeamGroup"], formatMark(total.Total), formatMark(total.Graded), total.Letter})
+			}
+			out.Flush()
+			return
+		}
+
+		data["Totals"] = totals
+		data["Configured"] = len(config.GradesComponents) > 0
+
+		Render(w, r, "admin/totals", data)
+	}
+}
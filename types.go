@@ -3,6 +3,7 @@ package submit
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ramin0/submit/lib/google"
@@ -13,6 +14,11 @@ type Session struct {
 	Timestamp time.Time
 	History   []string
 	User      *User
+
+	// slackState is the one-time OAuth state handed to Slack by the connect
+	// handler and consumed by the callback.
+	slackState        string
+	slackStateExpires time.Time
 }
 
 // User struct
@@ -27,6 +33,12 @@ type User struct {
 	gradesMethods []string
 	gradesMarks   []string
 	proposal      map[string]interface{}
+
+	// cache guards the grades and proposal, which concurrent requests of the
+	// same session fill in, along with the versions they were read at.
+	cache           sync.Mutex
+	gradesVersion   int
+	proposalVersion int
 }
 
 // FirstName func
@@ -97,17 +109,48 @@ func (user *User) TeamMembers() []*User {
 
 // Grades func
 func (user *User) Grades() ([]string, []string) {
-	if len(user.gradesMethods) == 0 {
+	user.cache.Lock()
+	if version := cacheVersion("grades:" + user.ID); len(user.gradesMethods) == 0 || user.gradesVersion != version {
 		user.gradesMethods, user.gradesMarks, _ = google.SheetsGrades(user.ID)
+		user.gradesVersion = version
 	}
+	allMethods, allMarks := user.gradesMethods, user.gradesMarks
+	user.cache.Unlock()
+
+	if user.Admin() {
+		return allMethods, allMarks
+	}
+
+	var methods, marks []string
+	for i, method := range allMethods {
+		if !gradeReleased(method) {
+			continue
+		}
 
-	return user.gradesMethods, user.gradesMarks
+		methods = append(methods, method)
+		if i < len(allMarks) {
+			marks = append(marks, allMarks[i])
+		} else {
+			marks = append(marks, "")
+		}
+	}
+
+	return methods, marks
 }
 
 // Proposal func
 func (user *User) Proposal() map[string]interface{} {
-	if user.proposal == nil {
-		user.proposal, _ = google.SheetsTeamProposal(user.TeamName())
+	teamName := user.TeamName()
+
+	user.cache.Lock()
+	defer user.cache.Unlock()
+
+	if version := cacheVersion("proposal:" + teamName); user.proposal == nil || user.proposalVersion != version {
+		user.proposal, _ = google.SheetsTeamProposal(teamName)
+		if stored := proposalFind(teamName); stored.Submitted() {
+			user.proposal = stored.display(user.proposal)
+		}
+		user.proposalVersion = version
 	}
 
 	return user.proposal
@@ -146,7 +189,13 @@ func (user *User) fetchInfo() error {
 
 // Slot struct
 type Slot struct {
-	ID   string
-	Date string
-	Time string
+	ID         string
+	Date       string
+	Time       string
+	Location   string
+	VideoURL   string
+	Evaluators []string
+	Teams      []string
+	Capacity   int
+	Remaining  int
 }
@@ -3,6 +3,7 @@ package submit
 import (
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/ramin0/submit/config"
 )
@@ -10,7 +11,13 @@ import (
 var (
 	maxPostSize = int64(50 * 1024 * 1024)
 
-	sessions = map[string]*Session{}
+	sessions     = map[string]*Session{}
+	sessionsLock sync.RWMutex
+
+	// Jobs invalidate cached grades and proposals by bumping these versions
+	// rather than touching the users of other sessions.
+	cacheVersions     = map[string]int{}
+	cacheVersionsLock sync.Mutex
 )
 
 func cookieName() string {
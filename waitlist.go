@@ -0,0 +1,248 @@
+package submit
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/store"
+)
+
+const (
+	waitlistCollection = "waitlist"
+
+	jobWaitlistPromote = "waitlist.promote"
+)
+
+var (
+	waitlistLock sync.Mutex
+
+	errWaitlistLeft = fmt.Errorf("team left the waitlist")
+)
+
+type waitlistEntry struct {
+	Team      string
+	TeamGroup string
+	CreatedAt time.Time
+
+	// A freed slot offered to the team is held for it until OfferExpires.
+	OfferSlot    string
+	OfferTime    string
+	OfferExpires time.Time
+}
+
+func (e *waitlistEntry) offered() bool {
+	return e.OfferSlot != "" && time.Now().Before(e.OfferExpires)
+}
+
+func waitlistJoin(user *User) error {
+	if err := bookingOpen(); err != nil {
+		return err
+	}
+
+	entry := &waitlistEntry{}
+	return store.Update(waitlistCollection, user.TeamName(), entry, func(found bool) error {
+		if !found {
+			entry.Team = user.TeamName()
+			entry.TeamGroup = user.TeamGroup()
+			entry.CreatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+func waitlistLeave(teamName string) error {
+	return store.Delete(waitlistCollection, teamName)
+}
+
+// waitlistDecline takes the team off the waitlist, passing on any slot it was
+// offered to the next team.
+func waitlistDecline(teamName string) error {
+	offer := waitlistOffer(teamName)
+	if err := waitlistLeave(teamName); err != nil {
+		return err
+	}
+
+	if offer != nil {
+		promoteWaitlist()
+	}
+	return nil
+}
+
+// waitlistOffer returns the entry of the team if it holds an offer, or nil.
+func waitlistOffer(teamName string) *waitlistEntry {
+	entry := &waitlistEntry{}
+	if found, _ := store.Get(waitlistCollection, teamName, entry); !found || !entry.offered() {
+		return nil
+	}
+
+	return entry
+}
+
+// waitlistAccept books the team into the slot it was offered.
+func waitlistAccept(user *User) error {
+	offer := waitlistOffer(user.TeamName())
+	if offer == nil {
+		return fmt.Errorf("Your team has no slot on offer")
+	}
+
+	return reserveSlot(user, offer.OfferSlot)
+}
+
+// waitlistHeld counts, per slot, the offers held by teams other than the
+// given one. Those places can't be booked by anyone else.
+func waitlistHeld(teamName string) map[string]int {
+	held := map[string]int{}
+	entries, _ := waitlistEntries()
+	for _, entry := range entries {
+		if entry.Team != teamName && entry.offered() {
+			held[entry.OfferSlot]++
+		}
+	}
+
+	return held
+}
+
+// bookableSlots returns the free slots the user's team can book: those open
+// to its tutorial group with a place that isn't held for another team's
+// offer. held counts those offers per slot.
+func bookableSlots(user *User) (slots []*scheduler.Slot, held map[string]int, err error) {
+	free, err := scheduler.Get().FreeSlots()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	held = waitlistHeld(user.TeamName())
+	slots = []*scheduler.Slot{}
+	for _, slot := range free {
+		if slotAllowed(user.TeamGroup(), slot) && slot.Remaining() > held[slot.ID] {
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots, held, nil
+}
+
+// waitlistPosition returns the 1-based position of the team on the waitlist,
+// or 0 if it is not waiting.
+func waitlistPosition(teamName string) int {
+	entries, _ := waitlistEntries()
+	for i, entry := range entries {
+		if entry.Team == teamName {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func waitlistEntries() ([]*waitlistEntry, error) {
+	all := map[string]*waitlistEntry{}
+	if err := store.All(waitlistCollection, &all); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*waitlistEntry, 0, len(all))
+	for _, entry := range all {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+func promoteWaitlist() {
+	jobs.Enqueue(jobWaitlistPromote, map[string]string{})
+}
+
+// jobWaitlistPromoteHandler offers freed slots to waiting teams, first come
+// first served, as long as booking is still open. A team has
+// EvaluationsOfferExpiry to accept; after that it leaves the waitlist and the
+// slot is offered to the next team.
+func jobWaitlistPromoteHandler(args map[string]string) error {
+	waitlistLock.Lock()
+	defer waitlistLock.Unlock()
+
+	if bookingOpen() != nil {
+		return nil
+	}
+
+	entries, err := waitlistEntries()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	slots, err := scheduler.Get().FreeSlots()
+	if err != nil {
+		return err
+	}
+
+	expiry, err := time.ParseDuration(config.EvaluationsOfferExpiry)
+	if err != nil || expiry <= 0 {
+		expiry = 12 * time.Hour
+	}
+
+	held := waitlistHeld("")
+	for _, entry := range entries {
+		teamSlot, err := scheduler.Get().TeamSlot(entry.Team)
+		if err != nil {
+			return err
+		}
+		if teamSlot != nil {
+			waitlistLeave(entry.Team)
+			continue
+		}
+
+		if entry.offered() {
+			continue
+		}
+		if entry.OfferSlot != "" {
+			waitlistLeave(entry.Team)
+			notifyTeam(entry.Team, fmt.Sprintf("The slot offered to %s on %s wasn't accepted in time, so the team left the waitlist. "+
+				"You can join it again on the Evaluation page.", entry.Team, entry.OfferTime))
+			continue
+		}
+
+		for _, slot := range slots {
+			if slot.Remaining() <= held[slot.ID] || !slotAllowed(entry.TeamGroup, slot) || bookingNotice(slot) != nil {
+				continue
+			}
+
+			expires := time.Now().Add(expiry)
+			if expires.After(slot.Start) {
+				expires = slot.Start
+			}
+
+			// The team may have left the waitlist since it was listed.
+			err := store.Update(waitlistCollection, entry.Team, entry, func(found bool) error {
+				if !found {
+					return errWaitlistLeft
+				}
+				entry.OfferSlot = slot.ID
+				entry.OfferTime = fmt.Sprintf("%s at %s", newSlot(slot).Date, newSlot(slot).Time)
+				entry.OfferExpires = expires
+				return nil
+			})
+			if err == errWaitlistLeft {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			held[slot.ID]++
+			notifyTeam(entry.Team, fmt.Sprintf("A slot opened up for %s's evaluation on %s. "+
+				"Accept it on the Evaluation page by %s, or it goes to the next team on the waitlist.",
+				entry.Team, entry.OfferTime, reminderTime(expires)))
+			jobs.EnqueueAt(jobWaitlistPromote, map[string]string{}, expires)
+			break
+		}
+	}
+
+	return nil
+}
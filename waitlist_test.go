@@ -0,0 +1,179 @@
+package submit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/scheduler"
+	"github.com/ramin0/submit/lib/store"
+)
+
+func withWaitlistConfig(t *testing.T) {
+	oldEvaluators, oldCloses, oldExpiry := config.EvaluationsGroupEvaluators, config.EvaluationsBookingCloses, config.EvaluationsOfferExpiry
+	t.Cleanup(func() {
+		config.EvaluationsGroupEvaluators, config.EvaluationsBookingCloses, config.EvaluationsOfferExpiry = oldEvaluators, oldCloses, oldExpiry
+	})
+	config.EvaluationsGroupEvaluators = map[string][]string{"T1": {"alice"}}
+	config.EvaluationsBookingCloses = ""
+	config.EvaluationsOfferExpiry = "1h"
+}
+
+func TestWaitlistPromote(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	slot := func(id string, capacity int, teams ...string) *scheduler.Slot {
+		return &scheduler.Slot{ID: id, Start: start, End: start.Add(time.Hour), Capacity: capacity, Teams: teams}
+	}
+	waiting := func(team, group string, age time.Duration) *waitlistEntry {
+		return &waitlistEntry{Team: team, TeamGroup: group, CreatedAt: time.Now().Add(-age)}
+	}
+	offered := func(entry *waitlistEntry, slotID string, expires time.Duration) *waitlistEntry {
+		entry.OfferSlot = slotID
+		entry.OfferExpires = time.Now().Add(expires)
+		return entry
+	}
+
+	tests := []struct {
+		name    string
+		closes  string
+		slots   []*scheduler.Slot
+		entries []*waitlistEntry
+		// offers maps the teams left on the waitlist to the slot they hold.
+		offers map[string]string
+	}{
+		{
+			name:    "first come first served",
+			slots:   []*scheduler.Slot{slot("s1", 1)},
+			entries: []*waitlistEntry{waiting("B", "", time.Minute), waiting("A", "", time.Hour)},
+			offers:  map[string]string{"A": "s1", "B": ""},
+		},
+		{
+			name:    "one offer per place",
+			slots:   []*scheduler.Slot{slot("s1", 2, "X")},
+			entries: []*waitlistEntry{waiting("A", "", 2*time.Hour), waiting("B", "", time.Hour)},
+			offers:  map[string]string{"A": "s1", "B": ""},
+		},
+		{
+			name:    "several places",
+			slots:   []*scheduler.Slot{slot("s1", 2)},
+			entries: []*waitlistEntry{waiting("A", "", 2*time.Hour), waiting("B", "", time.Hour)},
+			offers:  map[string]string{"A": "s1", "B": "s1"},
+		},
+		{
+			name:    "held offer keeps its place",
+			slots:   []*scheduler.Slot{slot("s1", 1)},
+			entries: []*waitlistEntry{offered(waiting("A", "", 2*time.Hour), "s1", time.Hour), waiting("B", "", time.Hour)},
+			offers:  map[string]string{"A": "s1", "B": ""},
+		},
+		{
+			name:    "expired offer passes on",
+			slots:   []*scheduler.Slot{slot("s1", 1)},
+			entries: []*waitlistEntry{offered(waiting("A", "", 2*time.Hour), "s1", -time.Minute), waiting("B", "", time.Hour)},
+			offers:  map[string]string{"B": "s1"},
+		},
+		{
+			name:    "booked team leaves",
+			slots:   []*scheduler.Slot{slot("s1", 1), slot("s2", 1, "A")},
+			entries: []*waitlistEntry{waiting("A", "", 2*time.Hour), waiting("B", "", time.Hour)},
+			offers:  map[string]string{"B": "s1"},
+		},
+		{
+			name: "group evaluators",
+			slots: []*scheduler.Slot{
+				{ID: "s1", Start: start, End: start.Add(time.Hour), Evaluators: []string{"bob"}},
+			},
+			entries: []*waitlistEntry{waiting("A", "T1", 2*time.Hour), waiting("B", "T2", time.Hour)},
+			offers:  map[string]string{"A": "", "B": "s1"},
+		},
+		{
+			name:    "booking closed",
+			closes:  time.Now().Add(-time.Hour).Format(time.RFC3339),
+			slots:   []*scheduler.Slot{slot("s1", 1)},
+			entries: []*waitlistEntry{waiting("A", "", time.Hour)},
+			offers:  map[string]string{"A": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withLocalSlots(t, tt.slots...)
+			withWaitlistConfig(t)
+			config.EvaluationsBookingCloses = tt.closes
+
+			for _, entry := range tt.entries {
+				if err := store.Put(waitlistCollection, entry.Team, entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := jobWaitlistPromoteHandler(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, _ := waitlistEntries()
+			if len(entries) != len(tt.offers) {
+				t.Errorf("%d teams left on the waitlist, want %d", len(entries), len(tt.offers))
+			}
+			for _, entry := range entries {
+				want, ok := tt.offers[entry.Team]
+				if !ok {
+					t.Errorf("%s is still waiting", entry.Team)
+					continue
+				}
+				if got := waitlistOfferSlot(entry); got != want {
+					t.Errorf("%s holds %q, want %q", entry.Team, got, want)
+				}
+			}
+		})
+	}
+}
+
+func waitlistOfferSlot(entry *waitlistEntry) string {
+	if !entry.offered() {
+		return ""
+	}
+
+	return entry.OfferSlot
+}
+
+func TestBookableSlotsSkipsHeldPlaces(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	withLocalSlots(t,
+		&scheduler.Slot{ID: "s1", Start: start, End: start.Add(time.Hour), Capacity: 1},
+		&scheduler.Slot{ID: "s2", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), Capacity: 2},
+	)
+	withWaitlistConfig(t)
+
+	for _, team := range []string{"A", "B"} {
+		entry := &waitlistEntry{Team: team, CreatedAt: time.Now(), OfferSlot: "s2", OfferExpires: time.Now().Add(time.Hour)}
+		if team == "A" {
+			entry.OfferSlot = "s1"
+		}
+		store.Put(waitlistCollection, team, entry)
+	}
+
+	tests := []struct {
+		team string
+		want []string
+	}{
+		{"A", []string{"s1", "s2"}},
+		{"B", []string{"s2"}},
+		{"C", []string{"s2"}},
+	}
+
+	for _, tt := range tests {
+		slots, held, err := bookableSlots(&User{UserName: tt.team, teamName: tt.team, teamGroup: "T2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+		for _, slot := range slots {
+			ids = append(ids, slot.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("bookableSlots(%s) = %v, want %v (held %v)", tt.team, ids, tt.want, held)
+		}
+	}
+}
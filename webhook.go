@@ -1,25 +1,42 @@
 package submit
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
-	"github.com/go-errors/errors"
 	"github.com/ramin0/submit/config"
 	"github.com/ramin0/submit/lib/google"
+	"github.com/ramin0/submit/lib/jobs"
+	"github.com/ramin0/submit/lib/scheduler"
 	"github.com/ramin0/submit/lib/slack"
 	"github.com/ramin0/submit/lib/util"
 )
 
+const (
+	jobCommandID       = "command.id"
+	jobCommandTeam     = "command.team"
+	jobCommandProposal = "command.proposal"
+	jobCommandGrades   = "command.grades"
+	jobCommandSlot     = "command.slot"
+
+	actionCommand = "command"
+)
+
 var (
 	slackIDRegexp = regexp.MustCompile("^<@(.+)\\|.+>$")
 )
 
 type payload struct {
 	Token     string
+	Type      string
 	Challenge string
 	Event     event
 }
@@ -43,6 +60,37 @@ type event struct {
 			ID string
 		}
 	}
+	Interaction interaction
+}
+
+type interaction struct {
+	Type        string
+	Token       string
+	TriggerID   string `json:"trigger_id"`
+	ResponseURL string `json:"response_url"`
+	User        struct {
+		ID       string
+		UserName string `json:"username"`
+	}
+	Channel struct {
+		ID   string
+		Name string
+	}
+	Actions []struct {
+		ActionID       string `json:"action_id"`
+		BlockID        string `json:"block_id"`
+		Value          string
+		SelectedOption struct {
+			Value string
+		} `json:"selected_option"`
+	}
+}
+
+// actionHandlers maps the action IDs of interactive Slack messages to what
+// handles them. Anything after a dot in an action ID is ignored, so elements
+// sharing a block can have the unique IDs Slack requires.
+var actionHandlers = map[string]func(e event, value string) error{
+	actionCommand: commandAction,
 }
 
 func webhook() (string, http.HandlerFunc) {
@@ -52,19 +100,39 @@ func webhook() (string, http.HandlerFunc) {
 			return
 		}
 
-		body := decodePayload(r)
+		raw, err := verifyWebhook(r)
+		if err != nil {
+			renderJSON(w, map[string]interface{}{"ok": false}, http.StatusUnauthorized)
+			return
+		}
 
-		if body.Challenge != "" {
-			fmt.Fprint(w, body.Challenge)
+		body, err := decodePayload(r.Header.Get("Content-Type"), raw)
+		if err != nil {
+			renderJSON(w, map[string]interface{}{"ok": false, "error": err.Error()}, http.StatusBadRequest)
 			return
 		}
 
-		if body.Token != config.SlackWebhookToken {
+		if config.SlackSigningSecret == "" &&
+			subtle.ConstantTimeCompare([]byte(body.Token), []byte(config.SlackWebhookToken)) != 1 {
 			renderJSON(w, map[string]interface{}{"ok": false}, http.StatusUnauthorized)
 			return
 		}
 
-		if err := handleWebhook(body.Event); err != nil {
+		if body.Type == "url_verification" {
+			fmt.Fprint(w, body.Challenge)
+			return
+		}
+
+		if body.Event.Type == "cmd" {
+			text, err := runCommand(body.Event)
+			if err != nil {
+				text = ":warning: " + err.Error()
+			}
+			if text != "" {
+				renderJSON(w, map[string]interface{}{"response_type": "ephemeral", "text": text})
+				return
+			}
+		} else if err := handleWebhook(body.Event); err != nil {
 			renderJSON(w, map[string]interface{}{"ok": false, "error": err.Error()})
 			return
 		}
@@ -75,276 +143,396 @@ func webhook() (string, http.HandlerFunc) {
 	}
 }
 
-func decodePayload(r *http.Request) (body payload) {
-	defer r.Body.Close()
+// verifyWebhook reads the body of a request from Slack, checking its signature
+// when a signing secret is set. Without one, the deprecated verification token
+// in the payload is checked instead once it is decoded.
+func verifyWebhook(r *http.Request) ([]byte, error) {
+	if config.SlackSigningSecret == "" {
+		defer r.Body.Close()
+		return ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, slack.MaxBodySize))
+	}
+
+	maxAge, err := time.ParseDuration(config.SlackSignatureMaxAge)
+	if err != nil {
+		maxAge = 5 * time.Minute
+	}
 
-	switch contentType := r.Header.Get("Content-Type"); contentType {
+	return slack.VerifyRequest(r, config.SlackSigningSecret, maxAge)
+}
+
+// decodePayload turns slash commands, interactive payloads and Events API
+// callbacks into a payload.
+func decodePayload(contentType string, raw []byte) (body payload, err error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
 	case "application/x-www-form-urlencoded":
-		r.ParseForm()
-		body.Token = r.FormValue("token")
+		form, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return body, err
+		}
+
+		if p := form.Get("payload"); p != "" {
+			i := &body.Event.Interaction
+			if err := json.Unmarshal([]byte(p), i); err != nil {
+				return body, err
+			}
+
+			body.Token = i.Token
+			body.Event.Type = i.Type
+			body.Event.Command.ResponseURL = i.ResponseURL
+			body.Event.Command.Channel.ID = i.Channel.ID
+			body.Event.Command.Channel.Name = i.Channel.Name
+			body.Event.Command.User.ID = i.User.ID
+			return body, nil
+		}
+
+		if !strings.HasPrefix(form.Get("command"), "/") {
+			return body, fmt.Errorf("Unknown payload")
+		}
+
+		body.Token = form.Get("token")
 		body.Event.Type = "cmd"
-		body.Event.Command.Cmd = r.FormValue("command")[1:]
-		body.Event.Command.Text = r.FormValue("text")
-		body.Event.Command.ResponseURL = r.FormValue("response_url")
-		body.Event.Command.Channel.ID = r.FormValue("channel_id")
-		body.Event.Command.Channel.Name = r.FormValue("channel_name")
-		body.Event.Command.User.ID = r.FormValue("user_id")
+		body.Event.Command.Cmd = form.Get("command")[1:]
+		body.Event.Command.Text = form.Get("text")
+		body.Event.Command.ResponseURL = form.Get("response_url")
+		body.Event.Command.Channel.ID = form.Get("channel_id")
+		body.Event.Command.Channel.Name = form.Get("channel_name")
+		body.Event.Command.User.ID = form.Get("user_id")
 	case "application/json":
-		json.NewDecoder(r.Body).Decode(&body)
+		err = json.Unmarshal(raw, &body)
+	default:
+		err = fmt.Errorf("Unsupported content type: %s", contentType)
 	}
 
-	return body
+	return body, err
 }
 
 func handleWebhook(e event) error {
 	switch e.Type {
-	case "cmd":
-		switch e.Command.Cmd {
-		case "id":
-			return handleCommandID(e)
-		case "team":
-			return handleCommandTeam(e)
-		case "proposal":
-			return handleCommandProposal(e)
+	case "block_actions":
+		for _, action := range e.Interaction.Actions {
+			value := action.Value
+			if value == "" {
+				value = action.SelectedOption.Value
+			}
+
+			if fn, ok := actionHandlers[strings.SplitN(action.ActionID, ".", 2)[0]]; ok {
+				if err := fn(e, value); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
-func handleCommandID(e event) error {
-	slackID := e.Command.Text
-	if slackID == "" {
-		return fmt.Errorf("Missing User ID")
+func commandID(c *commandContext) (string, error) {
+	_, err := jobs.Enqueue(jobCommandID, map[string]string{
+		"SlackID":     slackIDRegexp.FindStringSubmatch(c.Args["@user"])[1],
+		"ResponseURL": c.Event.Command.ResponseURL,
+	})
+	return "", err
+}
+
+func jobCommandIDHandler(args map[string]string) error {
+	student, err := studentForSlackUser(args["SlackID"])
+	if err != nil {
+		return err
 	}
-	if !slackIDRegexp.MatchString(slackID) {
-		return fmt.Errorf("Invalid Argument: %v", slackID)
+
+	teamID := util.TrimTeamName(student["Team"])
+	card := slack.NewSection(fmt.Sprintf("*%s*\n%s", student["FullName"], student["Email"])).
+		Field("ID", student["ID"]).
+		Field("Tutorial Group", student["Group"]).
+		Field("Team", student["Team"]).
+		Field("Team Tutorial Group", student["TeamGroup"])
+	if teamID != "" {
+		card.With(slack.NewOverflow(actionCommand).
+			Option("Show team", "team "+teamID).
+			Option("Show proposal", "proposal "+teamID))
 	}
-	slackID = slackIDRegexp.FindStringSubmatch(slackID)[1]
 
-	if !slackAdminsRegexp().MatchString(e.Command.User.ID) {
-		if slackID != e.Command.User.ID {
-			return fmt.Errorf("Unauthorized")
-		}
+	return slack.WebhookResponse(args["ResponseURL"], slack.NewMessage(student["FullName"], card))
+}
+
+func commandTeam(c *commandContext) (string, error) {
+	_, err := jobs.Enqueue(jobCommandTeam, map[string]string{
+		"TeamID":      c.Args["team"],
+		"ResponseURL": c.Event.Command.ResponseURL,
+	})
+	return "", err
+}
+
+func jobCommandTeamHandler(args map[string]string) error {
+	teamName := util.FormatTeamName(args["TeamID"])
+
+	members, err := google.SheetsTeamMembers(teamName)
+	if err != nil {
+		return err
 	}
 
-	go func(slackID string) {
-		defer func() {
-			if err := recover(); err != nil {
-				panicHandler(nil, nil, errors.Wrap(err, 1))
-			}
-		}()
+	message := slack.NewMessage(teamName, slack.NewSection("").
+		Field("Team", teamName).
+		Field("Team Tutorial Group", members[0]["TeamGroup"]))
 
-		info, err := slack.UsersInfo(slackID)
-		if err != nil {
-			panic(err)
-		}
+	for _, m := range members {
+		message.Add(slack.NewSection(fmt.Sprintf("*[%s] %s* (%s)\n%s@student.guc.edu.eg",
+			m["ID"], m["FullName"], m["Group"], m["UserName"])))
+	}
 
-		student, err := google.SheetsUserInfoBy("Email", info[1])
-		if err != nil {
-			panic(err)
-		}
+	if featureEnabled("proposals") {
+		message.Add(slack.NewActions(
+			slack.NewButton(actionCommand, "Show proposal", "proposal "+args["TeamID"]),
+		))
+	}
 
-		slack.WebhookResponse(e.Command.ResponseURL, map[string]interface{}{
-			"attachments": []interface{}{
-				map[string]interface{}{
-					"title": student["FullName"],
-					"text":  student["Email"],
-					"fields": []map[string]interface{}{
-						map[string]interface{}{
-							"title": "ID",
-							"value": student["ID"],
-							"short": true,
-						},
-						map[string]interface{}{
-							"title": "Tutorial Group",
-							"value": student["Group"],
-							"short": true,
-						},
-						map[string]interface{}{
-							"title": "Team",
-							"value": student["Team"],
-							"short": true,
-						},
-						map[string]interface{}{
-							"title": "Team Tutorial Group",
-							"value": student["TeamGroup"],
-							"short": true,
-						},
-					},
-				},
-			},
-		})
-	}(slackID)
+	return slack.WebhookResponse(args["ResponseURL"], message)
+}
 
-	return nil
+func commandProposal(c *commandContext) (string, error) {
+	_, err := jobs.Enqueue(jobCommandProposal, map[string]string{
+		"TeamID":      c.Args["team"],
+		"ResponseURL": c.Event.Command.ResponseURL,
+	})
+	return "", err
 }
 
-func handleCommandTeam(e event) error {
-	teamID := e.Command.Text
-	if teamID == "" {
-		return fmt.Errorf("Missing Team ID")
+func jobCommandProposalHandler(args map[string]string) error {
+	teamName := util.FormatTeamName(args["TeamID"])
+
+	proposal, err := google.SheetsTeamProposal(teamName)
+	if stored := proposalFind(teamName); stored.Submitted() {
+		proposal, err = stored.display(proposal), nil
+	}
+	if err != nil {
+		return err
 	}
 
-	if !slackAdminsRegexp().MatchString(e.Command.User.ID) {
-		info, err := slack.UsersInfo(e.Command.User.ID)
-		if err != nil {
-			return err
+	var status string
+	if proposal["Approved"].(bool) {
+		status += ":ballot_box_with_check:"
+	}
+	if late := proposal["Late"]; late != "" {
+		if status != "" {
+			status += " "
 		}
-		user, err := google.SheetsUserInfoBy("Email", info[1])
-		if err != nil {
-			return err
+		switch late {
+		case "VERY":
+			for i := 1; i <= 3; i++ {
+				status += ":timer_clock:"
+			}
+		case "YES":
+			status += ":timer_clock:"
 		}
+	}
+	if status == "" {
+		status = "N/A"
+	}
 
-		if util.TrimTeamName(user["Team"]) != teamID {
-			return fmt.Errorf("Unauthorized")
-		}
+	message := slack.NewMessage(teamName+" proposal", slack.NewSection("").
+		Field("Team", teamName).
+		Field("Status", status))
+
+	if topic := teamTopic(teamName); topic != nil {
+		message.Add(slack.NewSection("").Field("Topic", topic.Title))
 	}
 
-	go func(teamID string) {
-		defer func() {
-			if err := recover(); err != nil {
-				panicHandler(nil, nil, errors.Wrap(err, 1))
-			}
-		}()
+	for _, qa := range proposal["QAs"].([][]string) {
+		message.Add(slack.NewSections(fmt.Sprintf("*%s*\n%s", qa[0], qa[1]))...)
+	}
 
-		teamName := util.FormatTeamName(teamID)
+	if notes, _ := proposal["Notes"].(string); notes != "" {
+		message.Add(slack.NewContext("*Notes:* " + notes))
+	}
 
-		members, err := google.SheetsTeamMembers(teamName)
-		if err != nil {
-			panic(err)
-		}
+	message.Add(slack.NewActions(
+		slack.NewButton(actionCommand, "Show team", "team "+args["TeamID"]),
+	))
 
-		fields := []map[string]interface{}{
-			map[string]interface{}{
-				"title": "Team",
-				"value": teamName,
-				"short": true,
-			},
-			map[string]interface{}{
-				"title": "Team Tutorial Group",
-				"value": members[0]["TeamGroup"],
-				"short": true,
-			},
-		}
+	return slack.WebhookResponse(args["ResponseURL"], message)
+}
 
-		for _, m := range members {
-			fields = append(fields, map[string]interface{}{
-				"title": fmt.Sprintf("[%s] %s (%s)", m["ID"], m["FullName"], m["Group"]),
-				"value": fmt.Sprintf("%s@student.guc.edu.eg", m["UserName"]),
-				"short": false,
-			})
+func commandGrades(c *commandContext) (string, error) {
+	id, all := c.Args["id"], "NO"
+	if id == "" {
+		student, err := c.Student()
+		if err != nil {
+			return "", err
 		}
+		id = student["ID"]
+	} else if c.Admin() {
+		all = "YES"
+	}
 
-		slack.WebhookResponse(e.Command.ResponseURL, map[string]interface{}{
-			"attachments": []interface{}{
-				map[string]interface{}{
-					"fields": fields,
-				},
-			},
-		})
-	}(teamID)
-
-	return nil
+	_, err := jobs.Enqueue(jobCommandGrades, map[string]string{
+		"StudentID":   id,
+		"All":         all,
+		"ResponseURL": c.Event.Command.ResponseURL,
+	})
+	return "", err
 }
 
-func handleCommandProposal(e event) error {
-	teamID := e.Command.Text
-	if teamID == "" {
-		return fmt.Errorf("Missing Team ID")
-	}
+// jobCommandGradesHandler replies with the grades of a student; only released
+// ones unless an admin asked.
+func jobCommandGradesHandler(args map[string]string) error {
+	user := &User{ID: args["StudentID"]}
 
-	if !slackAdminsRegexp().MatchString(e.Command.User.ID) {
-		info, err := slack.UsersInfo(e.Command.User.ID)
-		if err != nil {
-			return err
-		}
-		user, err := google.SheetsUserInfoBy("Email", info[1])
-		if err != nil {
+	methods, marks := user.Grades()
+	if args["All"] == "YES" {
+		var err error
+		if methods, marks, err = google.SheetsGrades(user.ID); err != nil {
 			return err
 		}
+	}
 
-		if util.TrimTeamName(user["Team"]) != teamID {
-			return fmt.Errorf("Unauthorized")
-		}
+	if len(methods) == 0 {
+		return slackReply(args["ResponseURL"], "No grades yet.")
 	}
 
-	go func(teamID string) {
-		defer func() {
-			if err := recover(); err != nil {
-				panicHandler(nil, nil, errors.Wrap(err, 1))
-			}
-		}()
+	message := slack.NewMessage("Grades for "+user.ID, slack.NewSection("*Grades for "+user.ID+"*"))
 
-		teamName := util.FormatTeamName(teamID)
+	var section *slack.Section
+	for i, method := range methods {
+		if i%10 == 0 {
+			section = slack.NewSection("")
+			message.Add(section)
+		}
 
-		proposal, err := google.SheetsTeamProposal(teamName)
-		if err != nil {
-			panic(err)
+		mark := "-"
+		if i < len(marks) && marks[i] != "" {
+			mark = marks[i]
 		}
+		section.Field(method, mark)
+	}
 
-		var status string
-		if proposal["Approved"].(bool) {
-			status += ":ballot_box_with_check:"
+	if total := gradeTotal(methods, marks); total != nil {
+		text := fmt.Sprintf("*Total:* %.2f%%", total.Total)
+		if total.Letter != "" {
+			text += " · " + total.Letter
 		}
-		if late := proposal["Late"]; late != "" {
-			if status != "" {
-				status += " "
-			}
-			switch late {
-			case "VERY":
-				for i := 1; i <= 3; i++ {
-					status += ":timer_clock:"
-				}
-			case "YES":
-				status += ":timer_clock:"
-			}
+		message.Add(slack.NewContext(text, fmt.Sprintf("Based on %.0f%% of the course graded so far.", total.Graded)))
+	}
+
+	return slack.WebhookResponse(args["ResponseURL"], message.Ephemeral())
+}
+
+func commandSlot(c *commandContext) (string, error) {
+	action := c.Args["show|free|book|cancel"]
+	if action == "" {
+		action = "show"
+	}
+	if action == "book" && c.Args["slot"] == "" {
+		return "", fmt.Errorf("Missing slot. Usage: `%s`", c.Command.Usage())
+	}
+
+	student, err := c.Student()
+	if err != nil {
+		return "", err
+	}
+
+	args := map[string]string{
+		"Action":      action,
+		"SlotID":      c.Args["slot"],
+		"ResponseURL": c.Event.Command.ResponseURL,
+	}
+	for _, field := range []string{"ID", "UserName", "FullName", "Group", "Team", "TeamGroup"} {
+		args[field] = student[field]
+	}
+
+	_, err = jobs.Enqueue(jobCommandSlot, args)
+	return "", err
+}
+
+// jobCommandSlotHandler shows, lists, books or cancels the evaluation slot of
+// the team of the student who asked, going through the same booking rules as
+// /evaluation. Broken rules are replied with rather than retried.
+func jobCommandSlotHandler(args map[string]string) error {
+	user := userFromSheet(args)
+
+	switch args["Action"] {
+	case "book":
+		if err := reserveSlot(user, args["SlotID"]); err != nil {
+			return slackReply(args["ResponseURL"], ":warning: "+err.Error())
 		}
-		if status == "" {
-			status = "N/A"
+	case "cancel":
+		if err := cancelSlot(user); err != nil {
+			return slackReply(args["ResponseURL"], ":warning: "+err.Error())
 		}
+		return slackReply(args["ResponseURL"], "Your reservation was cancelled.")
+	case "free":
+		return slackFreeSlots(user, args["ResponseURL"])
+	}
 
-		fields := []map[string]interface{}{
-			map[string]interface{}{
-				"title": "Team",
-				"value": teamName,
-				"short": true,
-			},
-			map[string]interface{}{
-				"title": "Status",
-				"value": status,
-				"short": true,
-			},
-		}
+	teamSlot, err := scheduler.Get().TeamSlot(user.TeamName())
+	if err != nil {
+		return err
+	}
+	if teamSlot == nil {
+		return slack.WebhookResponse(args["ResponseURL"], slack.NewMessage("No evaluation slot",
+			slack.NewSection("Your team hasn't booked an evaluation slot yet."),
+			slack.NewActions(slack.NewButton(actionCommand, "Show free slots", "slot free").Primary()),
+		).Ephemeral())
+	}
+
+	slot := newSlot(teamSlot)
+	card := slack.NewSection("*Your evaluation slot*").
+		Field("Date", slot.Date).
+		Field("Time", slot.Time)
+	if slot.Location != "" {
+		card.Field("Location", slot.Location)
+	}
+	if slot.VideoURL != "" {
+		card.Field("Video", slot.VideoURL)
+	}
+
+	return slack.WebhookResponse(args["ResponseURL"], slack.NewMessage("Your evaluation slot", card,
+		slack.NewActions(
+			slack.NewButton(actionCommand+".free", "Other slots", "slot free"),
+			slack.NewButton(actionCommand+".cancel", "Cancel", "slot cancel").Danger(),
+		),
+	).Ephemeral())
+}
+
+func slackFreeSlots(user *User, responseURL string) error {
+	allowed, held, err := bookableSlots(user)
+	if err != nil {
+		return err
+	}
+	if len(allowed) == 0 {
+		return slackReply(responseURL, "There are no free slots.")
+	}
 
-		for _, qa := range proposal["QAs"].([][]string) {
-			fields = append(fields, map[string]interface{}{
-				"title": qa[0],
-				"value": qa[1],
-				"short": false,
-			})
+	message := slack.NewMessage("Free slots", slack.NewSection("*Free slots*"))
+	for i, s := range allowed {
+		if i == 10 {
+			message.Add(slack.NewContext(fmt.Sprintf("And %d more on the Evaluation page.", len(allowed)-i)))
+			break
 		}
 
-		if notes := proposal["Notes"]; notes != "" {
-			fields = append(fields, map[string]interface{}{
-				"title": "Notes",
-				"value": notes,
-				"short": false,
-			})
+		slot := newSlot(s)
+		text := fmt.Sprintf("%s, %s", slot.Date, slot.Time)
+		if slot.Location != "" {
+			text += " · " + slot.Location
+		}
+		if slot.Capacity > 1 {
+			text += fmt.Sprintf(" (%d of %d left)", slot.Remaining-held[slot.ID], slot.Capacity)
 		}
 
-		slack.WebhookResponse(e.Command.ResponseURL, map[string]interface{}{
-			"attachments": []interface{}{
-				map[string]interface{}{
-					"fields": fields,
-				},
-			},
-		})
-	}(teamID)
+		message.Add(slack.NewSection(text).With(slack.NewButton(actionCommand, "Book", "slot book "+slot.ID).Primary()))
+	}
 
-	return nil
+	return slack.WebhookResponse(responseURL, message.Ephemeral())
 }
 
-func slackAdminsRegexp() *regexp.Regexp {
-	return regexp.MustCompile(fmt.Sprintf("(?:%s)", strings.Join(config.SlackAdmins, "|")))
+// slackAdmin reports whether a Slack user ID is one of config.SlackAdmins.
+func slackAdmin(slackID string) bool {
+	for _, admin := range config.SlackAdmins {
+		if admin != "" && admin == slackID {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,167 @@
+package submit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramin0/submit/config"
+	"github.com/ramin0/submit/lib/slack"
+)
+
+const testSigningSecret = "webhook-test-secret"
+
+func withSigningSecret(t *testing.T) {
+	old, oldMaxAge := config.SlackSigningSecret, config.SlackSignatureMaxAge
+	config.SlackSigningSecret, config.SlackSignatureMaxAge = testSigningSecret, "5m"
+	t.Cleanup(func() { config.SlackSigningSecret, config.SlackSignatureMaxAge = old, oldMaxAge })
+}
+
+// postWebhook sends a body signed at the given time to the webhook handler.
+func postWebhook(contentType, body string, at time.Time) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", slack.Sign(testSigningSecret, timestamp, []byte(body)))
+
+	w := httptest.NewRecorder()
+	_, handler := webhook()
+	handler(w, r)
+
+	return w
+}
+
+func TestWebhookURLVerification(t *testing.T) {
+	withSigningSecret(t)
+
+	w := postWebhook("application/json", `{"type":"url_verification","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`, time.Now())
+	if w.Code != http.StatusOK || w.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestWebhookRejectsBadSignatures(t *testing.T) {
+	withSigningSecret(t)
+
+	if w := postWebhook("application/json", `{"type":"url_verification"}`, time.Now().Add(-time.Hour)); w.Code != http.StatusUnauthorized {
+		t.Errorf("stale request: got %d, want 401", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"type":"url_verification"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	r.Header.Set("X-Slack-Signature", "v0=00")
+	w := httptest.NewRecorder()
+	_, handler := webhook()
+	handler(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature: got %d, want 401", w.Code)
+	}
+}
+
+func TestWebhookSlashCommand(t *testing.T) {
+	withSigningSecret(t)
+
+	form := url.Values{
+		"command":      {"/submit"},
+		"text":         {"help id"},
+		"user_id":      {"U123"},
+		"response_url": {"https://hooks.slack.com/commands/x"},
+	}
+	w := postWebhook("application/x-www-form-urlencoded", form.Encode(), time.Now())
+
+	var reply map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if reply["response_type"] != "ephemeral" || !strings.Contains(reply["text"], "/submit id <@user>") {
+		t.Errorf("got %v", reply)
+	}
+}
+
+func TestDecodeSlashCommand(t *testing.T) {
+	form := url.Values{
+		"token":        {"t0k3n"},
+		"command":      {"/slot"},
+		"text":         {"book abc"},
+		"channel_id":   {"C1"},
+		"channel_name": {"general"},
+		"user_id":      {"U123"},
+		"response_url": {"https://hooks.slack.com/commands/x"},
+	}
+
+	body, err := decodePayload("application/x-www-form-urlencoded; charset=utf-8", []byte(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := body.Event.Command
+	if body.Token != "t0k3n" || body.Event.Type != "cmd" || c.Cmd != "slot" || c.Text != "book abc" ||
+		c.Channel.ID != "C1" || c.Channel.Name != "general" || c.User.ID != "U123" || c.ResponseURL != "https://hooks.slack.com/commands/x" {
+		t.Errorf("decoded %+v", body)
+	}
+}
+
+func TestDecodeBlockActions(t *testing.T) {
+	payload := `{
+		"type": "block_actions",
+		"token": "t0k3n",
+		"trigger_id": "123.456",
+		"response_url": "https://hooks.slack.com/actions/x",
+		"user": {"id": "U123", "username": "student"},
+		"channel": {"id": "C1", "name": "general"},
+		"actions": [
+			{"action_id": "command.0", "block_id": "b", "value": "slot book abc"},
+			{"action_id": "command.1", "block_id": "b", "selected_option": {"value": "slot cancel"}}
+		]
+	}`
+
+	body, err := decodePayload("application/x-www-form-urlencoded", []byte(url.Values{"payload": {payload}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := body.Event
+	if body.Token != "t0k3n" || e.Type != "block_actions" || e.Command.User.ID != "U123" ||
+		e.Command.Channel.ID != "C1" || e.Command.ResponseURL != "https://hooks.slack.com/actions/x" {
+		t.Errorf("decoded %+v", body)
+	}
+	if len(e.Interaction.Actions) != 2 || e.Interaction.TriggerID != "123.456" {
+		t.Fatalf("decoded interaction %+v", e.Interaction)
+	}
+
+	// Actions dispatch on the part of the action ID before the dot, taking the
+	// value of buttons and of menus alike.
+	old := actionHandlers[actionCommand]
+	defer func() { actionHandlers[actionCommand] = old }()
+
+	values := []string{}
+	actionHandlers[actionCommand] = func(e event, value string) error {
+		values = append(values, value)
+		return nil
+	}
+	if err := handleWebhook(e); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(values, "|") != "slot book abc|slot cancel" {
+		t.Errorf("dispatched %v", values)
+	}
+}
+
+func TestDecodeRejectsUnknownPayloads(t *testing.T) {
+	for contentType, raw := range map[string]string{
+		"application/x-www-form-urlencoded": "text=hello",
+		"text/plain":                        "hello",
+		"application/json":                  "{",
+	} {
+		if _, err := decodePayload(contentType, []byte(raw)); err == nil {
+			t.Errorf("decoded %s %q", contentType, raw)
+		}
+	}
+}